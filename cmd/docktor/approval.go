@@ -0,0 +1,520 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultApprovalTTL = 15 * time.Minute
+	proposalRetention  = 7 * 24 * time.Hour // Finished proposals are kept this long for `proposals --all`
+	proposalLockWait   = 5 * time.Second    // How long to wait for another writer of the same proposal
+	proposalLockStale  = time.Minute        // Lock files older than this were left by a crashed writer
+)
+
+// Proposal statuses
+const (
+	proposalPending  = "pending"
+	proposalApproved = "approved"
+	proposalRejected = "rejected"
+	proposalExpired  = "expired"
+	proposalExecuted = "executed"
+	proposalFailed   = "failed"
+)
+
+// Proposal is a scale action waiting for (or decided by) an operator in manual mode
+type Proposal struct {
+	ID              string             `json:"id"`
+	Service         string             `json:"service"`
+	Action          string             `json:"action"`
+	CurrentReplicas int                `json:"current_replicas"`
+	TargetReplicas  int                `json:"target_replicas"`
+	Reason          string             `json:"reason"`
+	Observations    map[string]float64 `json:"observations,omitempty"`
+	Status          string             `json:"status"`
+	CreatedAt       time.Time          `json:"created_at"`
+	ExpiresAt       time.Time          `json:"expires_at"`
+	DecidedBy       string             `json:"decided_by,omitempty"`
+	DecidedAt       *time.Time         `json:"decided_at,omitempty"`
+	DecisionNote    string             `json:"decision_note,omitempty"`
+	ExecutedAt      *time.Time         `json:"executed_at,omitempty"`
+	Error           string             `json:"error,omitempty"`
+	Recorded        bool               `json:"recorded,omitempty"` // Outcome written to the decision log
+}
+
+// Expired reports whether a pending proposal has outlived its TTL
+func (p *Proposal) Expired(now time.Time) bool {
+	return p.Status == proposalPending && now.After(p.ExpiresAt)
+}
+
+// newProposalID returns a short random ID prefixed with the service name
+func newProposalID(service string) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return service + "-" + hex.EncodeToString(b)
+}
+
+func proposalPath(dir, id string) string {
+	return filepath.Join(dir, id+".json")
+}
+
+// saveProposal writes a proposal atomically (write to temp file, then rename)
+func saveProposal(dir string, p *Proposal) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create proposals dir: %w", err)
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := proposalPath(dir, p.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write proposal: %w", err)
+	}
+	return os.Rename(tmp, proposalPath(dir, p.ID))
+}
+
+// lockProposal serializes read-modify-write cycles of one proposal between the CLI and the
+// daemon with an exclusive lock file; the returned function releases it
+func lockProposal(dir, id string) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create proposals dir: %w", err)
+	}
+	path := proposalPath(dir, id) + ".lock"
+	deadline := time.Now().Add(proposalLockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock proposal %s: %w", id, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > proposalLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("proposal %s is locked by another process", id)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// updateProposal reloads a proposal under its lock and saves it if update returns true
+func updateProposal(dir, id string, update func(p *Proposal) bool) (*Proposal, error) {
+	unlock, err := lockProposal(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	p, err := loadProposal(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	if !update(p) {
+		return p, nil
+	}
+	return p, saveProposal(dir, p)
+}
+
+func loadProposal(dir, id string) (*Proposal, error) {
+	data, err := os.ReadFile(proposalPath(dir, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("proposal %s not found", id)
+		}
+		return nil, err
+	}
+	var p Proposal
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse proposal %s: %w", id, err)
+	}
+	return &p, nil
+}
+
+// listProposals returns all proposals, oldest first, optionally filtered by service
+func listProposals(dir, service string) ([]*Proposal, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var proposals []*Proposal
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		p, err := loadProposal(dir, strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		if service == "" || p.Service == service {
+			proposals = append(proposals, p)
+		}
+	}
+	sort.Slice(proposals, func(i, j int) bool { return proposals[i].CreatedAt.Before(proposals[j].CreatedAt) })
+	return proposals, nil
+}
+
+// currentUser identifies who approved or rejected a proposal
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// decideProposal marks a pending proposal as approved or rejected
+func decideProposal(dir, id, status, by, note string) (*Proposal, error) {
+	now := time.Now()
+	decided := false
+	p, err := updateProposal(dir, id, func(p *Proposal) bool {
+		if p.Status != proposalPending || p.Expired(now) {
+			return false
+		}
+		p.Status = status
+		p.DecidedBy = by
+		p.DecidedAt = &now
+		p.DecisionNote = note
+		decided = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !decided {
+		status := p.Status
+		if p.Expired(now) {
+			status = proposalExpired
+		}
+		return p, fmt.Errorf("proposal %s is %s, not pending", id, status)
+	}
+	return p, nil
+}
+
+// runApproval implements `docktor approve <id>` and `docktor reject <id>`
+func runApproval(status string, args []string) {
+	if len(args) < 1 || strings.HasPrefix(args[0], "--") {
+		fmt.Fprintf(os.Stderr, "Error: proposal ID required\n")
+		fmt.Fprintf(os.Stderr, "Usage: docktor %s <ID> [--by NAME] [--note TEXT]\n", map[string]string{proposalApproved: "approve", proposalRejected: "reject"}[status])
+		os.Exit(1)
+	}
+
+	id := args[0]
+	by := currentUser()
+	note := ""
+	for i := 1; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--by="):
+			by = strings.TrimPrefix(args[i], "--by=")
+		case args[i] == "--by" && i+1 < len(args):
+			by = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--note="):
+			note = strings.TrimPrefix(args[i], "--note=")
+		case args[i] == "--note" && i+1 < len(args):
+			note = args[i+1]
+			i++
+		}
+	}
+
+	p, err := decideProposal(cliStatePaths(args[1:]).Proposals, id, status, by, note)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+		os.Exit(1)
+	}
+
+	verb := map[string]string{proposalApproved: "Approved", proposalRejected: "Rejected"}[status]
+	fmt.Printf("✓ %s %s: %s %s %d→%d (by %s)\n", verb, p.ID, p.Service, p.Action, p.CurrentReplicas, p.TargetReplicas, p.DecidedBy)
+	if status == proposalApproved {
+		fmt.Println("  The daemon will execute it on the next check of this service.")
+	}
+}
+
+// runProposals implements `docktor proposals [--all] [--service NAME]`
+func runProposals(args []string) {
+	showAll := false
+	serviceFilter := ""
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--all":
+			showAll = true
+		case strings.HasPrefix(args[i], "--service="):
+			serviceFilter = strings.TrimPrefix(args[i], "--service=")
+		case args[i] == "--service" && i+1 < len(args):
+			serviceFilter = args[i+1]
+			i++
+		}
+	}
+
+	proposals, err := listProposals(cliStatePaths(args).Proposals, serviceFilter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Cannot read proposals: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	shown := 0
+	for _, p := range proposals {
+		status := p.Status
+		if p.Expired(now) {
+			status = proposalExpired
+		}
+		if !showAll && status != proposalPending {
+			continue
+		}
+		if shown == 0 {
+			fmt.Printf("%-22s %-10s %-10s %-8s %-10s %-10s %s\n", "ID", "SERVICE", "ACTION", "FROM→TO", "STATUS", "EXPIRES", "REASON")
+			fmt.Println(strings.Repeat("-", 100))
+		}
+		shown++
+		expires := "-"
+		if status == proposalPending {
+			expires = p.ExpiresAt.Sub(now).Round(time.Second).String()
+		}
+		fmt.Printf("%-22s %-10s %-10s %-8s %-10s %-10s %s\n", p.ID, p.Service, p.Action,
+			fmt.Sprintf("%d→%d", p.CurrentReplicas, p.TargetReplicas), status, expires, p.Reason)
+	}
+
+	if shown == 0 {
+		fmt.Println("No pending proposals.")
+		return
+	}
+	fmt.Println("\nApprove with: docktor approve <ID>   Reject with: docktor reject <ID>")
+}
+
+// processDecidedProposals executes approved proposals and expires stale ones for a service.
+// It is called by the daemon in manual mode at the start of every iteration.
+func processDecidedProposals(d *daemon, m *serviceMonitor) {
+	svc := m.svc
+	proposals, err := listProposals(d.state.Proposals, svc.Name)
+	if err != nil {
+		fmt.Fprintf(d.logFh, "[%s] ERROR: Cannot read proposals: %v\n", svc.Name, err)
+		return
+	}
+
+	now := time.Now()
+	for _, p := range proposals {
+		switch {
+		case p.Recorded && p.Status != proposalApproved && now.Sub(p.finishedAt()) > proposalRetention:
+			os.Remove(proposalPath(d.state.Proposals, p.ID))
+
+		case p.Expired(now):
+			// Under the lock, so an approval that lands at the same time is not overwritten
+			expired := false
+			p, err := updateProposal(d.state.Proposals, p.ID, func(p *Proposal) bool {
+				if !p.Expired(now) {
+					return false
+				}
+				p.Status = proposalExpired
+				p.Recorded = true
+				expired = true
+				return true
+			})
+			if err != nil {
+				fmt.Fprintf(d.logFh, "[%s] ERROR: Cannot expire proposal: %v\n", svc.Name, err)
+				continue
+			}
+			if expired {
+				fmt.Fprintf(d.logFh, "[%s] Proposal %s expired without a decision\n", svc.Name, p.ID)
+				d.logDecisionJSONL(svc.Name, now, "expired", p.CurrentReplicas, p.TargetReplicas, p.Reason, p.Observations,
+					map[string]interface{}{"proposal_id": p.ID})
+			}
+
+		case p.Status == proposalRejected && !p.Recorded:
+			recorded := false
+			p, err := updateProposal(d.state.Proposals, p.ID, func(p *Proposal) bool {
+				if p.Status != proposalRejected || p.Recorded {
+					return false
+				}
+				p.Recorded = true
+				recorded = true
+				return true
+			})
+			if err != nil {
+				fmt.Fprintf(d.logFh, "[%s] ERROR: Cannot record rejected proposal: %v\n", svc.Name, err)
+				continue
+			}
+			if recorded {
+				fmt.Fprintf(d.logFh, "[%s] Proposal %s rejected by %s\n", svc.Name, p.ID, p.DecidedBy)
+				d.logDecisionJSONL(svc.Name, now, "rejected", p.CurrentReplicas, p.TargetReplicas, p.Reason, p.Observations,
+					proposalDecisionFields(p))
+			}
+
+		case p.Status == proposalApproved:
+			target := p.TargetReplicas
+			if target < svc.MinReplicas {
+				target = svc.MinReplicas
+			}
+			if target > svc.MaxReplicas {
+				target = svc.MaxReplicas
+			}
+
+			if !d.isLeader() {
+				// Left approved for whichever daemon leads on the next check
+				fmt.Fprintf(d.logFh, "[%s] Not leading, leaving approved proposal %s to the leader\n", svc.Name, p.ID)
+				return
+			}
+
+			// The target was computed from the replicas at proposal time; if they changed
+			// since (e.g. a forced scale), the approved action no longer means the same thing
+			containers, err := selectServiceContainers(d.project.Load(), svc)
+			if err != nil {
+				fmt.Fprintf(d.logFh, "[%s] ERROR: Failed to select containers: %v\n", svc.Name, err)
+				return
+			}
+			if current := len(containers); current != p.CurrentReplicas {
+				changed := fmt.Sprintf("replicas changed from %d to %d since the proposal", p.CurrentReplicas, current)
+				expired := false
+				p, err := updateProposal(d.state.Proposals, p.ID, func(p *Proposal) bool {
+					if p.Status != proposalApproved {
+						return false
+					}
+					p.Status = proposalExpired
+					p.Error = changed
+					p.Recorded = true
+					expired = true
+					return true
+				})
+				if err != nil {
+					fmt.Fprintf(d.logFh, "[%s] ERROR: Cannot expire proposal: %v\n", svc.Name, err)
+					continue
+				}
+				if expired {
+					fmt.Fprintf(d.logFh, "[%s] Proposal %s expired: %s\n", svc.Name, p.ID, p.Error)
+					fields := proposalDecisionFields(p)
+					fields["error"] = p.Error
+					d.logDecisionJSONL(svc.Name, now, "expired", current, p.TargetReplicas, p.Reason, p.Observations, fields)
+				}
+				continue
+			}
+
+			// The listing may be stale: only execute what is still approved on disk
+			p, err = loadProposal(d.state.Proposals, p.ID)
+			if err != nil {
+				fmt.Fprintf(d.logFh, "[%s] ERROR: Cannot read proposal: %v\n", svc.Name, err)
+				continue
+			}
+			if p.Status != proposalApproved {
+				continue
+			}
+
+			fmt.Fprintf(d.logFh, "[%s] Executing proposal %s approved by %s: %d→%d\n",
+				svc.Name, p.ID, p.DecidedBy, p.CurrentReplicas, target)
+			fields := proposalDecisionFields(p)
+			res, scaleErr := scaleComposeService(d.project.Load(), svc.Name, target, d.logFh)
+			executedAt := time.Now()
+			if scaleErr != nil {
+				fields["error"] = scaleErr.Error()
+				fmt.Fprintf(d.logFh, "[%s] ERROR: Scaling failed: %v\n", svc.Name, scaleErr)
+				d.metrics.recordScaleAction(svc.Name, p.Action, "failed")
+			} else {
+				d.metrics.recordScaleAction(svc.Name, p.Action, "success")
+				fmt.Fprintf(d.logFh, "[%s] ✓ Scaled successfully to %d replicas\n", svc.Name, target)
+				m.state.recordAction(executedAt, p.Action, target, svc.cooldown())
+			}
+			if res != nil {
+				fields["containers_created"] = res.Created
+				fields["containers_removed"] = res.Removed
+			}
+			d.logDecisionJSONL(svc.Name, executedAt, p.Action, p.CurrentReplicas, target, p.Reason, p.Observations, fields)
+
+			stored := false
+			_, err = updateProposal(d.state.Proposals, p.ID, func(p *Proposal) bool {
+				if p.Status != proposalApproved {
+					return false
+				}
+				p.ExecutedAt = &executedAt
+				p.Recorded = true
+				p.Status = proposalExecuted
+				if scaleErr != nil {
+					p.Status = proposalFailed
+					p.Error = scaleErr.Error()
+				}
+				stored = true
+				return true
+			})
+			switch {
+			case err != nil:
+				fmt.Fprintf(d.logFh, "[%s] ERROR: Cannot store the outcome of proposal %s: %v\n", svc.Name, p.ID, err)
+			case !stored:
+				fmt.Fprintf(d.logFh, "[%s] ERROR: Proposal %s changed while it was executed, outcome not stored\n", svc.Name, p.ID)
+			}
+		}
+	}
+}
+
+// finishedAt returns when a proposal reached its final status
+func (p *Proposal) finishedAt() time.Time {
+	switch {
+	case p.ExecutedAt != nil:
+		return *p.ExecutedAt
+	case p.DecidedAt != nil:
+		return *p.DecidedAt
+	}
+	return p.ExpiresAt
+}
+
+// proposalDecisionFields returns the approval metadata recorded in the decision log
+func proposalDecisionFields(p *Proposal) map[string]interface{} {
+	verb := "approved"
+	if p.Status == proposalRejected {
+		verb = "rejected"
+	}
+	fields := map[string]interface{}{
+		"proposal_id": p.ID,
+		verb + "_by":  p.DecidedBy,
+	}
+	if p.DecidedAt != nil {
+		fields[verb+"_at"] = p.DecidedAt.Format(time.RFC3339)
+	}
+	if p.DecisionNote != "" {
+		fields["decision_note"] = p.DecisionNote
+	}
+	return fields
+}
+
+// queueProposal stores a scale action for approval unless one is already pending for the service
+func queueProposal(d *daemon, svc ServiceConfig, action string, currentReplicas, targetReplicas int, reason string, observations map[string]float64) (*Proposal, bool, error) {
+	proposals, err := listProposals(d.state.Proposals, svc.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	for _, p := range proposals {
+		if p.Status == proposalPending && !p.Expired(now) {
+			return p, false, nil
+		}
+	}
+
+	p := &Proposal{
+		ID:              newProposalID(svc.Name),
+		Service:         svc.Name,
+		Action:          action,
+		CurrentReplicas: currentReplicas,
+		TargetReplicas:  targetReplicas,
+		Reason:          reason,
+		Observations:    observations,
+		Status:          proposalPending,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(d.approvalTTL),
+	}
+	return p, true, saveProposal(d.state.Proposals, p)
+}
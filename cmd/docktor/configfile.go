@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// commentSpacing matches the whitespace before an inline comment, which the encoder
+// always writes as a single space
+var commentSpacing = regexp.MustCompile(`\s+#`)
+
+// readConfigFile parses docktor.yaml as written, without defaults, path resolution or
+// normalization, so that saving it back only changes what the caller changed
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	return nil
+}
+
+// SaveConfig saves configuration to YAML file. An existing file is updated in place:
+// comments, key order and formatting of unchanged values are kept.
+func SaveConfig(path string, cfg Config) error {
+	_, data, err := renderConfigFile(path, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// renderConfigFile returns the current contents of path and what SaveConfig would write
+func renderConfigFile(path string, cfg Config) (before, after []byte, err error) {
+	var src yaml.Node
+	if err := src.Encode(cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	before, err = os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(before, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		// Nothing to keep: write the config from scratch
+		after, err = yaml.Marshal(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal config: %w", err)
+		}
+		return before, after, nil
+	}
+
+	mergeYAML(doc.Content[0], &src)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	enc.Close()
+	return before, keepLayout(before, buf.Bytes()), nil
+}
+
+// keepLayout undoes what the YAML encoder changed beyond the values: it puts back
+// dropped blank lines and lines that only differ in the spacing before a comment. In a
+// changed block, blank lines that led it stay in front of the new lines, others follow them.
+func keepLayout(before, after []byte) []byte {
+	ops := diffLines(strings.Split(string(before), "\n"), strings.Split(string(after), "\n"))
+	var out []string
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			out = append(out, ops[k].line)
+			k++
+			continue
+		}
+		var leading, added, trailing []string
+		original := map[string]string{}
+		deleted := false
+		for ; k < len(ops) && ops[k].kind != ' '; k++ {
+			switch {
+			case ops[k].kind == '+':
+				added = append(added, ops[k].line)
+			case strings.TrimSpace(ops[k].line) != "":
+				deleted = true
+				original[commentSpacing.ReplaceAllString(ops[k].line, " #")] = ops[k].line
+			case deleted:
+				trailing = append(trailing, ops[k].line)
+			default:
+				leading = append(leading, ops[k].line)
+			}
+		}
+		for i, line := range added {
+			if orig, ok := original[line]; ok {
+				added[i] = orig
+			}
+		}
+		out = append(append(append(out, leading...), added...), trailing...)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+// mergeYAML updates dst to hold the value of src. Subtrees that decode to the same value
+// are left untouched; replaced values keep the comments of the node they replace.
+// Mapping keys missing from src are removed, new ones are added unless their value is empty.
+func mergeYAML(dst, src *yaml.Node) {
+	if yamlEqual(dst, src) {
+		return
+	}
+
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		present := map[string]bool{}
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			present[key.Value] = true
+			if j := yamlKeyIndex(dst, key.Value); j >= 0 {
+				mergeYAML(dst.Content[j+1], value)
+			} else if pruneYAML(value); !yamlEmpty(value) {
+				dst.Content = append(dst.Content, key, value)
+			}
+		}
+		content := dst.Content[:0]
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			if present[dst.Content[i].Value] {
+				content = append(content, dst.Content[i], dst.Content[i+1])
+			}
+		}
+		dst.Content = content
+
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		for i, item := range src.Content {
+			if i < len(dst.Content) {
+				mergeYAML(dst.Content[i], item)
+			} else {
+				pruneYAML(item)
+				dst.Content = append(dst.Content, item)
+			}
+		}
+		dst.Content = dst.Content[:len(src.Content)]
+
+	default:
+		head, line, foot, style := dst.HeadComment, dst.LineComment, dst.FootComment, dst.Style
+		sameKind := dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode && dst.Tag == src.Tag
+		pruneYAML(src)
+		*dst = *src
+		dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+		if sameKind {
+			dst.Style = style // e.g. keep quoting
+		}
+	}
+}
+
+// yamlKeyIndex returns the index of key in a mapping node, or -1
+func yamlKeyIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlEqual reports whether two nodes decode to the same value
+func yamlEqual(a, b *yaml.Node) bool {
+	var va, vb interface{}
+	if a.Decode(&va) != nil || b.Decode(&vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// yamlEmpty reports whether a node holds a zero value that need not be written
+func yamlEmpty(n *yaml.Node) bool {
+	switch n.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(n.Content) == 0
+	case yaml.ScalarNode:
+		var v interface{}
+		if n.Decode(&v) != nil {
+			return false
+		}
+		return v == nil || reflect.ValueOf(v).IsZero()
+	}
+	return false
+}
+
+// pruneYAML drops mapping keys without a value (null, "", empty collections) from a
+// node that is about to be added. Zero numbers and false are kept: inside a new subtree
+// they are usually meant, e.g. the value of a condition.
+func pruneYAML(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		content := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pruneYAML(n.Content[i+1])
+			v := n.Content[i+1]
+			blank := v.Kind == yaml.ScalarNode && (v.Tag == "!!null" || v.Tag == "!!str" && v.Value == "")
+			if !blank && !(v.Kind != yaml.ScalarNode && len(v.Content) == 0) {
+				content = append(content, n.Content[i], n.Content[i+1])
+			}
+		}
+		n.Content = content
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			pruneYAML(item)
+		}
+	}
+}
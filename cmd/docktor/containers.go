@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/compose"
+)
+
+// selectServiceContainers returns the running containers of a service, matched by the
+// compose project/service labels. These are the replicas `compose up --scale` manages,
+// so the replica count always uses this selection, regardless of the service's selector.
+func selectServiceContainers(project *compose.Project, svc ServiceConfig) ([]compose.Container, error) {
+	all, err := compose.ListContainers(project.Name, map[string]string{compose.LabelService: svc.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	running := make([]compose.Container, 0, len(all))
+	for _, c := range all {
+		if c.Running() {
+			running = append(running, c)
+		}
+	}
+	return running, nil
+}
+
+// metricContainers narrows a service's replicas to those carrying the extra selector
+// labels of the config (an empty value only requires the label). It only filters which
+// containers metrics are read from; replicas are always counted over the whole service.
+func metricContainers(containers []compose.Container, svc ServiceConfig) []compose.Container {
+	if len(svc.Selector) == 0 {
+		return containers
+	}
+	selected := make([]compose.Container, 0, len(containers))
+	for _, c := range containers {
+		matches := true
+		for k, v := range svc.Selector {
+			if have, ok := c.Labels[k]; !ok || (v != "" && have != v) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			selected = append(selected, c)
+		}
+	}
+	return selected
+}
+
+// toolGetContainerMetrics samples CPU% of exactly the given containers over the window.
+// It returns per-container averages keyed by container name plus cpu.avg, cpu.min and cpu.max
+// aggregates (cpu.avg_pct is kept as an alias used by legacy configs).
+func toolGetContainerMetrics(containers []compose.Container, windowSec int) (map[string]float64, error) {
+	return sampleContainerMetrics(context.Background(), containers, windowSec, nil)
+}
+
+// sampleContainerMetrics is toolGetContainerMetrics with cancellation; onSample (if set)
+// is called after every sample with the seconds elapsed in the window
+func sampleContainerMetrics(ctx context.Context, containers []compose.Container, windowSec int, onSample func(elapsed, window int)) (map[string]float64, error) {
+	if len(containers) == 0 {
+		return map[string]float64{}, nil
+	}
+
+	names := make(map[string]string, len(containers))
+	args := []string{"stats", "--no-stream", "--no-trunc", "--format", "{{.ID}} {{.CPUPerc}}"}
+	for _, c := range containers {
+		names[c.ID] = c.Name
+		args = append(args, c.ID)
+	}
+
+	type acc struct {
+		sum float64
+		n   int
+	}
+	agg := map[string]*acc{}
+
+	start := time.Now()
+	stop := start.Add(time.Duration(windowSec) * time.Second)
+	for time.Now().Before(stop) {
+		out, err := exec.Command("docker", args...).CombinedOutput()
+		if err != nil {
+			// A container may disappear during the window; keep what was sampled so far
+			if len(agg) > 0 {
+				break
+			}
+			return nil, fmt.Errorf("docker stats: %w", err)
+		}
+
+		sc := bufio.NewScanner(strings.NewReader(string(out)))
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) != 2 {
+				continue
+			}
+			name, ok := names[fields[0]]
+			if !ok {
+				continue
+			}
+			val, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+			if err != nil {
+				continue
+			}
+			if _, ok := agg[name]; !ok {
+				agg[name] = &acc{}
+			}
+			agg[name].sum += val
+			agg[name].n++
+		}
+		if onSample != nil {
+			onSample(int(time.Since(start)/time.Second), windowSec)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+
+	result := map[string]float64{}
+	var values []float64
+	for name, v := range agg {
+		if v.n > 0 {
+			result[name] = v.sum / float64(v.n)
+			values = append(values, result[name])
+		}
+	}
+
+	if len(values) > 0 {
+		sort.Float64s(values)
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		result["cpu.avg"] = sum / float64(len(values))
+		result["cpu.avg_pct"] = result["cpu.avg"]
+		result["cpu.min"] = values[0]
+		result["cpu.max"] = values[len(values)-1]
+	}
+
+	return result, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// decisionRecord is one line of the decisions JSONL log
+type decisionRecord struct {
+	Timestamp       string             `json:"timestamp"`
+	Service         string             `json:"service"`
+	Action          string             `json:"action"`
+	CurrentReplicas int                `json:"current_replicas"`
+	TargetReplicas  int                `json:"target_replicas"`
+	Reason          string             `json:"reason"`
+	Observations    map[string]float64 `json:"observations"`
+	MatchedRules    []string           `json:"matched_rules,omitempty"`
+	DryRun          bool               `json:"dry_run,omitempty"`
+	Mode            string             `json:"mode,omitempty"`      // Why a dry-run record did not scale: dry-run, shadow, follower
+	Source          string             `json:"source,omitempty"`    // Who initiated a scale outside the rules: api, llm
+	Error           string             `json:"error,omitempty"`     // Why the scale action failed
+	Guardrail       string             `json:"guardrail,omitempty"` // How the rules changed an LLM decision
+}
+
+// Time returns the parsed timestamp of the record
+func (d decisionRecord) Time() time.Time {
+	ts, _ := time.Parse(time.RFC3339, d.Timestamp)
+	return ts
+}
+
+// parseSince parses a --since value: a duration before now (e.g. 30m, 2h) or an RFC 3339 time
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		return ts, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q: want a duration (30m, 2h) or an RFC 3339 time", s)
+}
+
+// readDecisions reads all decision records, optionally filtered by service
+func readDecisions(path, service string) ([]decisionRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var decisions []decisionRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var d decisionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &d); err == nil {
+			if service == "" || d.Service == service {
+				decisions = append(decisions, d)
+			}
+		}
+	}
+	return decisions, scanner.Err()
+}
+
+// explainCompare pairs every shadow decision with the closest real decision of the
+// same service (within window) and reports where they disagree. Followers only repeat
+// the leader's checks, so their records are left out.
+func explainCompare(decisions []decisionRecord, tail int, window time.Duration) {
+	live := map[string][]decisionRecord{}
+	var shadow []decisionRecord
+	for _, d := range decisions {
+		if d.Mode == "follower" {
+			continue
+		}
+		if d.DryRun {
+			shadow = append(shadow, d)
+		} else {
+			live[d.Service] = append(live[d.Service], d)
+		}
+	}
+
+	if len(shadow) == 0 {
+		fmt.Println("No shadow (dry-run) decisions found.")
+		fmt.Println("Start one with: docktor daemon start --dry-run --config new-docktor.yaml")
+		return
+	}
+
+	type pair struct {
+		shadow decisionRecord
+		real   *decisionRecord
+	}
+	pairs := make([]pair, 0, len(shadow))
+	for _, s := range shadow {
+		p := pair{shadow: s}
+		best := window + 1
+		for i, r := range live[s.Service] {
+			delta := s.Time().Sub(r.Time())
+			if delta < 0 {
+				delta = -delta
+			}
+			if delta <= window && delta < best {
+				best = delta
+				p.real = &live[s.Service][i]
+			}
+		}
+		pairs = append(pairs, p)
+	}
+
+	// Per-service agreement over all pairs
+	type stats struct{ compared, agreed, unmatched int }
+	perService := map[string]*stats{}
+	for _, p := range pairs {
+		st, ok := perService[p.shadow.Service]
+		if !ok {
+			st = &stats{}
+			perService[p.shadow.Service] = st
+		}
+		if p.real == nil {
+			st.unmatched++
+			continue
+		}
+		st.compared++
+		if p.real.Action == p.shadow.Action && p.real.TargetReplicas == p.shadow.TargetReplicas {
+			st.agreed++
+		}
+	}
+
+	start := 0
+	if len(pairs) > tail {
+		start = len(pairs) - tail
+	}
+
+	fmt.Printf("%-12s %-10s %-20s %-20s %-6s\n", "TIME", "SERVICE", "SHADOW", "REAL", "MATCH")
+	fmt.Println(strings.Repeat("-", 72))
+	for _, p := range pairs[start:] {
+		shadowStr := fmt.Sprintf("%s %d→%d", p.shadow.Action, p.shadow.CurrentReplicas, p.shadow.TargetReplicas)
+		realStr, match := "-", "?"
+		if p.real != nil {
+			realStr = fmt.Sprintf("%s %d→%d", p.real.Action, p.real.CurrentReplicas, p.real.TargetReplicas)
+			match = "no"
+			if p.real.Action == p.shadow.Action && p.real.TargetReplicas == p.shadow.TargetReplicas {
+				match = "yes"
+			}
+		}
+		fmt.Printf("%-12s %-10s %-20s %-20s %-6s\n", p.shadow.Time().Format("15:04:05"), p.shadow.Service, shadowStr, realStr, match)
+	}
+
+	services := make([]string, 0, len(perService))
+	for name := range perService {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+
+	fmt.Println("\nAgreement (shadow vs real):")
+	for _, name := range services {
+		st := perService[name]
+		pct := 0.0
+		if st.compared > 0 {
+			pct = 100 * float64(st.agreed) / float64(st.compared)
+		}
+		fmt.Printf("  %-10s %d/%d decisions agree (%.0f%%)", name, st.agreed, st.compared, pct)
+		if st.unmatched > 0 {
+			fmt.Printf(", %d without a real decision within %s", st.unmatched, window)
+		}
+		fmt.Println()
+	}
+}
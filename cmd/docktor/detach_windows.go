@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// detachAttr starts the daemon as a detached process
+func detachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: 0x00000008} // DETACHED_PROCESS
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/leader"
+)
+
+// defaultLeaseTTL is how long a leader lease is valid without a heartbeat
+const defaultLeaseTTL = 15 * time.Second
+
+// LeaderConfig selects how daemons of the same project elect the one that may scale
+type LeaderConfig struct {
+	Kind   string `yaml:"kind,omitempty"`   // "file" (default), "nats" or "none"
+	URL    string `yaml:"url,omitempty"`    // file: lock file path; nats: server URL
+	Bucket string `yaml:"bucket,omitempty"` // nats: KV bucket (default: docktor_leader)
+	TTL    int    `yaml:"ttl,omitempty"`    // seconds a lease lasts without renewal (default: 15)
+}
+
+// leaseTTL returns the configured lease duration
+func (c LeaderConfig) leaseTTL() time.Duration {
+	if c.TTL > 0 {
+		return time.Duration(c.TTL) * time.Second
+	}
+	return defaultLeaseTTL
+}
+
+// newElector creates the leader election backend for a compose project.
+// The default lock file lives in the system temp dir rather than the state dir so
+// that every daemon on the host finds it, whatever --state-dir it was started with.
+func newElector(cfg LeaderConfig, project string) (leader.Elector, error) {
+	kind := cfg.Kind
+	if kind == "" {
+		kind = "file"
+	}
+	url := cfg.URL
+	if kind == "file" && url == "" {
+		url = filepath.Join(os.TempDir(), "docktor-leader", project+".lock")
+	}
+
+	host, _ := os.Hostname()
+	return leader.NewElector(leader.Config{
+		Kind:       kind,
+		URL:        url,
+		Key:        project,
+		Identity:   fmt.Sprintf("%s:%d", host, os.Getpid()),
+		TTL:        cfg.leaseTTL(),
+		Attributes: map[string]string{"bucket": cfg.Bucket},
+	})
+}
+
+// isLeader reports whether this daemon may execute scale actions.
+// Without leader election every daemon is its own leader.
+func (d *daemon) isLeader() bool {
+	return d.elector == nil || d.leading.Load()
+}
+
+// campaign tries to take or renew the lease and logs leadership changes
+func (d *daemon) campaign() {
+	held, err := d.elector.Acquire()
+	if err != nil {
+		// Without a working lock we cannot be sure nobody else scales: step down
+		d.logf("WARNING: Leader election failed: %v", err)
+		held = false
+	}
+
+	was := d.leading.Swap(held)
+	d.metrics.leader.Set(map[bool]float64{true: 1, false: 0}[held])
+	switch {
+	case held && !was:
+		d.logf("✓ Acquired leadership, executing scale actions")
+	case !held && was:
+		d.logf("⚠ Lost leadership, continuing in shadow mode")
+	case !held && err == nil && !d.followerLogged:
+		d.followerLogged = true
+		if lease, _ := d.elector.Current(); lease != nil {
+			d.logf("Following leader %s (lease expires %s), running in shadow mode",
+				lease.Holder, lease.ExpiresAt.Format("15:04:05"))
+		}
+	}
+	if held {
+		d.followerLogged = false
+	}
+}
+
+// runElection renews the lease (or keeps trying to get it) until stop is closed,
+// then releases it
+func (d *daemon) runElection(ttl time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if d.leading.Load() {
+				if err := d.elector.Release(); err != nil {
+					d.logf("WARNING: Cannot release leadership: %v", err)
+				}
+			}
+			d.elector.Close()
+			return
+		case <-ticker.C:
+			d.campaign()
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/compose"
+)
+
+const (
+	// daemonChildEnv marks the re-executed, detached daemon process
+	daemonChildEnv = "DOCKTOR_DAEMON_CHILD"
+
+	// shutdownTimeout bounds how long shutdown waits for in-flight iterations
+	shutdownTimeout = 2 * time.Minute
+
+	// configPollInterval is how often the config file is checked for changes
+	configPollInterval = 2 * time.Second
+)
+
+// spawnDetachedDaemon re-executes docktor in the background with --foreground, its output
+// redirected to the log file, and waits until the child has written its PID file
+func spawnDetachedDaemon(args []string, pidFile, logFile string) {
+	exe, err := os.Executable()
+	must(err)
+
+	// The parent truncates the log; the child appends to it. O_APPEND keeps the child's
+	// stdout from overwriting lines it writes through its own log handle.
+	logOut, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
+	must(err)
+	defer logOut.Close()
+
+	childArgs := append([]string{"daemon", "start"}, args...)
+	childArgs = append(childArgs, "--foreground")
+
+	cmd := exec.Command(exe, childArgs...)
+	cmd.Env = append(os.Environ(), daemonChildEnv+"=1")
+	cmd.Stdin = nil
+	cmd.Stdout = logOut
+	cmd.Stderr = logOut
+	cmd.SysProcAttr = detachAttr()
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start daemon: %v\n", err)
+		os.Exit(1)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	fmt.Printf("Starting daemon in background (PID %d)...\n", cmd.Process.Pid)
+
+	// Startup may run `docker compose up`, which can take a while (image pulls)
+	deadline := time.Now().Add(5 * time.Minute)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			fmt.Fprintf(os.Stderr, "✗ Daemon exited during startup: %v\n\n", err)
+			fmt.Fprintf(os.Stderr, "Last log lines (%s):\n", logFile)
+			tail := exec.Command("tail", "-20", logFile)
+			tail.Stdout = os.Stderr
+			_ = tail.Run()
+			os.Exit(1)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		if pidData, err := os.ReadFile(pidFile); err == nil && strings.TrimSpace(string(pidData)) == strconv.Itoa(cmd.Process.Pid) {
+			fmt.Printf("✓ Daemon started successfully\n")
+			fmt.Printf("  PID: %d\n", cmd.Process.Pid)
+			fmt.Printf("  Logs: tail -f %s\n\n", logFile)
+			fmt.Printf("Control:\n")
+			fmt.Printf("  docktor daemon status  # Check status\n")
+			fmt.Printf("  docktor daemon logs    # Follow logs\n")
+			fmt.Printf("  docktor daemon stop    # Stop daemon\n")
+			return
+		}
+	}
+
+	fmt.Printf("Daemon is still starting (PID %d); check: docktor daemon logs\n", cmd.Process.Pid)
+}
+
+// loadDaemonConfig loads docktor.yaml, applies command-line overrides and resolves the
+// compose project. It is used at startup and again on every config reload.
+func loadDaemonConfig(opts daemonOpts) (Config, *compose.Project, error) {
+	cfg, err := LoadConfig(opts.configFile)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("error loading config: %w", err)
+	}
+
+	// Normalize config to multi-service format
+	cfg.Normalize()
+	applyDaemonOverrides(&cfg, opts)
+
+	// Resolve the compose project (files, extends, profiles, .env, project name)
+	project, err := compose.Load(cfg.ComposeOptions())
+	if err != nil {
+		return cfg, nil, fmt.Errorf("cannot load compose project: %w", err)
+	}
+	for _, svc := range cfg.Services {
+		if _, ok := project.Services[svc.Name]; !ok {
+			return cfg, nil, fmt.Errorf("service '%s' not found in compose project '%s'", svc.Name, project.Name)
+		}
+	}
+
+	return cfg, project, nil
+}
+
+// applyDaemonOverrides applies the daemon's command-line flags on top of the config
+func applyDaemonOverrides(cfg *Config, opts daemonOpts) {
+	if len(opts.composeFiles) > 0 {
+		cfg.ComposeFile = opts.composeFiles[0]
+		cfg.ComposeFiles = opts.composeFiles
+	}
+	if opts.projectName != "" {
+		cfg.ProjectName = opts.projectName
+	}
+	if len(opts.profiles) > 0 {
+		cfg.Profiles = opts.profiles
+	}
+	if opts.service != "web" {
+		// Override first service name for backward compatibility
+		if len(cfg.Services) > 0 {
+			cfg.Services[0].Name = opts.service
+		}
+	}
+	if opts.checkInterval > 0 {
+		// Override check interval for all services
+		for i := range cfg.Services {
+			cfg.Services[i].CheckInterval = opts.checkInterval
+		}
+	}
+}
+
+// monitorHandle controls one running service monitor
+type monitorHandle struct {
+	cfg    atomic.Pointer[ServiceConfig] // Current config; replaced in place on reload
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	paused   atomic.Bool       // Skip scheduled iterations (set through the API)
+	trigger  chan struct{}     // Run an iteration now
+	scaleReq chan scaleRequest // Forced scale actions, executed by the monitor goroutine
+
+	statusMu sync.Mutex
+	status   serviceStatus // Snapshot for the API, updated after every iteration
+}
+
+// config returns the monitor's current service config
+func (h *monitorHandle) config() ServiceConfig {
+	return *h.cfg.Load()
+}
+
+// startMonitor launches the monitor goroutine for one service
+func (d *daemon) startMonitor(svc ServiceConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &monitorHandle{
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		trigger:  make(chan struct{}, 1),
+		scaleReq: make(chan scaleRequest),
+	}
+	h.cfg.Store(&svc)
+
+	d.monitorsMu.Lock()
+	d.monitors[svc.Name] = h
+	d.monitorsMu.Unlock()
+
+	go func() {
+		defer close(h.done)
+		monitorService(ctx, d, h)
+	}()
+}
+
+// stopMonitor stops one monitor after its current iteration and waits for it, up to timeout
+func (d *daemon) stopMonitor(name string, timeout time.Duration) bool {
+	d.monitorsMu.Lock()
+	h, ok := d.monitors[name]
+	delete(d.monitors, name)
+	d.monitorsMu.Unlock()
+	if !ok {
+		return true
+	}
+
+	h.cancel()
+	select {
+	case <-h.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// stopAllMonitors stops every monitor in parallel and reports whether all finished in time
+func (d *daemon) stopAllMonitors(timeout time.Duration) bool {
+	d.monitorsMu.Lock()
+	names := make([]string, 0, len(d.monitors))
+	for name := range d.monitors {
+		names = append(names, name)
+	}
+	d.monitorsMu.Unlock()
+
+	results := make(chan bool, len(names))
+	for _, name := range names {
+		go func(name string) { results <- d.stopMonitor(name, timeout) }(name)
+	}
+	ok := true
+	for range names {
+		ok = <-results && ok
+	}
+	return ok
+}
+
+// applyServices diffs the desired service set against the running monitors:
+// removed services are stopped, added ones started and changed ones updated in place
+func (d *daemon) applyServices(services []ServiceConfig) {
+	desired := make(map[string]ServiceConfig, len(services))
+	for _, svc := range services {
+		desired[svc.Name] = svc
+	}
+
+	d.monitorsMu.Lock()
+	running := make(map[string]*monitorHandle, len(d.monitors))
+	for name, h := range d.monitors {
+		running[name] = h
+	}
+	d.monitorsMu.Unlock()
+
+	for name := range running {
+		if _, ok := desired[name]; !ok {
+			d.logf("[%s] Service removed from config, stopping monitor", name)
+			if !d.stopMonitor(name, shutdownTimeout) {
+				d.logf("[%s] WARNING: monitor did not stop within %s", name, shutdownTimeout)
+			}
+			d.metrics.forgetService(name)
+		}
+	}
+
+	for _, svc := range services {
+		h, ok := running[svc.Name]
+		if !ok {
+			d.logf("[%s] Service added to config, starting monitor", svc.Name)
+			d.startMonitor(svc)
+			continue
+		}
+		if !reflect.DeepEqual(h.config(), svc) {
+			svc := svc
+			h.cfg.Store(&svc)
+			d.logf("[%s] Service config updated (interval=%ds, replicas=%d-%d)",
+				svc.Name, svc.CheckInterval, svc.MinReplicas, svc.MaxReplicas)
+		}
+	}
+}
+
+// runSignalLoop blocks until the daemon is told to stop.
+// SIGTERM/SIGINT finish the current iterations and shut down, SIGHUP reloads the config.
+func (d *daemon) runSignalLoop(opts daemonOpts, pidFile string) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	reloadCh := make(chan struct{}, 1)
+	if path := configPath(opts); path != "" && !opts.noWatch {
+		go d.watchConfig(path, configPollInterval, reloadCh)
+	}
+
+	for {
+		var sig os.Signal
+		select {
+		case <-reloadCh:
+			d.reload(opts)
+			continue
+		case sig = <-sigCh:
+		}
+
+		if sig == syscall.SIGHUP {
+			d.logf("Received SIGHUP, reloading configuration...")
+			d.reload(opts)
+			continue
+		}
+
+		d.logf("Received %s, finishing in-flight iterations (timeout %s)...", sig, shutdownTimeout)
+
+		// A second signal aborts the graceful shutdown
+		go func() {
+			sig := <-sigCh
+			d.logf("Received %s again, exiting immediately", sig)
+			d.finish(pidFile, 1)
+		}()
+
+		if !d.stopAllMonitors(shutdownTimeout) {
+			d.logf("WARNING: iterations still running after %s, exiting anyway", shutdownTimeout)
+		}
+		d.stopElection()
+		d.finish(pidFile, 0)
+	}
+}
+
+// reload re-reads the configuration and applies it to the running monitors.
+// An invalid configuration is rejected and the current one keeps running.
+func (d *daemon) reload(opts daemonOpts) {
+	cfg, project, err := loadDaemonConfig(opts)
+	if err != nil {
+		d.logf("ERROR: Config reload rejected, keeping current config: %v", err)
+		return
+	}
+
+	// The state dir (and with it PID/log files) is fixed for the daemon's lifetime
+	if st, err := resolveStatePaths(cfg, opts.stateDir, d.dryRun); err == nil && st.Dir != d.state.Dir {
+		d.logf("WARNING: state dir changed to %s; keeping %s until restart", st.Dir, d.state.Dir)
+	}
+
+	d.project.Store(project)
+	d.config.Store(&cfg)
+	setComposeEnv(project)
+	d.applyServices(cfg.Services)
+	d.logf("✓ Configuration reloaded (%d services)", len(cfg.Services))
+}
+
+// watchConfig polls the config file and triggers a reload whenever its content changes.
+// Polling (rather than inotify) also catches editors that replace the file on save.
+func (d *daemon) watchConfig(path string, interval time.Duration, reload chan<- struct{}) {
+	last := fileDigest(path)
+	for range time.Tick(interval) {
+		digest := fileDigest(path)
+		if digest == "" || digest == last {
+			continue
+		}
+		last = digest
+		d.logf("Config file %s changed", path)
+		reload <- struct{}{}
+	}
+}
+
+// fileDigest returns a content hash of the file, or "" if it cannot be read
+func fileDigest(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// configPath returns the config file the daemon loads, or "" when running on defaults
+func configPath(opts daemonOpts) string {
+	if opts.configFile != "" {
+		return opts.configFile
+	}
+	for _, candidate := range []string{"docktor.yaml", "docktor.yml"} {
+		if fileExists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// stopElection releases the leader lease so another daemon can take over right away
+func (d *daemon) stopElection() {
+	if d.elector == nil {
+		return
+	}
+	close(d.electionStop)
+	select {
+	case <-d.electionDone:
+	case <-time.After(5 * time.Second):
+		d.logf("WARNING: leader lease not released; it expires on its own")
+	}
+}
+
+// finish writes the final log entry, fsyncs it, removes the PID file and exits
+func (d *daemon) finish(pidFile string, code int) {
+	d.stopAPI()
+	d.logf("=== Docktor daemon stopped (PID %d) ===", os.Getpid())
+	_ = d.logFh.Sync()
+	_ = d.logFh.Close()
+	os.Remove(pidFile)
+	os.Exit(code)
+}
+
+// logf writes a timestamped line to the daemon log
+func (d *daemon) logf(format string, args ...interface{}) {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+	fmt.Fprintf(d.logFh, "[%s] %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+	_ = d.logFh.Sync()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/llm"
+)
+
+// Decision modes of a service
+const (
+	decisionRules       = "rules"        // The rules decide
+	decisionLLM         = "llm"          // The model decides within the guardrail of the rules
+	decisionLLMAdvisory = "llm_advisory" // The rules decide; the model's view is recorded next to it
+)
+
+const (
+	llmDecisionTimeout = 60 * time.Second // One conversation, including its tool calls
+	llmMaxRounds       = 6                // Model replies per conversation
+)
+
+// llmDecisionTools are the read-only MCP tools the model may call while deciding
+var llmDecisionTools = []string{"get_service_config", "get_decision_history", "simulate_rules"}
+
+// decisionMode returns the decision mode of the service
+func (s ServiceConfig) decisionMode() string {
+	if s.DecisionMode == "" {
+		return decisionRules
+	}
+	return s.DecisionMode
+}
+
+// llmDecision is the answer the model submits
+type llmDecision struct {
+	Action         string `json:"action"`
+	TargetReplicas int    `json:"target_replicas"`
+	Rationale      string `json:"rationale"`
+}
+
+// consultLLM asks the model about a check of svc. In llm mode its decision replaces the
+// rules decision after passing the guardrail; in advisory mode it is only recorded. If
+// the model is unreachable or does not answer, the rules decision stands.
+func (d *daemon) consultLLM(svc ServiceConfig, mode string, current int, observations map[string]float64, decision map[string]interface{}) {
+	cfg := d.config.Load()
+	decision["decision_mode"] = mode
+
+	ctx, cancel := context.WithTimeout(context.Background(), llmDecisionTimeout)
+	defer cancel()
+	client, err := newLLMClient(cfg.LLM)
+	var dec *llmDecision
+	if err == nil {
+		dec, err = askLLM(ctx, client, svc, current, observations, decision, mode == decisionLLMAdvisory)
+	}
+	if err != nil {
+		fmt.Fprintf(d.logFh, "[%s] WARNING: LLM decision failed, using the rules: %v\n", svc.Name, err)
+		decision["llm_error"] = err.Error()
+		return
+	}
+	decision["llm_model"] = cfg.LLM.Model
+	decision["llm_action"] = dec.Action
+	decision["llm_target_replicas"] = dec.TargetReplicas
+	decision["llm_rationale"] = dec.Rationale
+	fmt.Fprintf(d.logFh, "[%s] LLM: %s to %d (%s)\n", svc.Name, dec.Action, dec.TargetReplicas, dec.Rationale)
+	if mode == decisionLLMAdvisory {
+		return
+	}
+
+	up, down := cfg.Scaling.steps()
+	action, target, note, overruled := guardLLMDecision(svc, current, up, down, decision, dec)
+	reason := "llm: " + dec.Rationale
+	if overruled {
+		reason = fmt.Sprint(decision["reason"])
+	}
+	if note != "" {
+		decision["guardrail"] = note
+		reason = fmt.Sprintf("%s (guardrail: %s)", reason, note)
+		fmt.Fprintf(d.logFh, "[%s] Guardrail: %s\n", svc.Name, note)
+	}
+	decision["rules_action"], decision["rules_target_replicas"] = decision["action"], decision["target_replicas"]
+	decision["action"], decision["target_replicas"], decision["reason"] = action, target, reason
+}
+
+// guardLLMDecision holds the model's decision to the rules result and the bounds: it
+// may hold or scale less than the rules, but never against them or past their target.
+// When the rules hold it may scale by at most one step. The note says what was changed;
+// overruled means the model's decision was dropped for the rules decision.
+func guardLLMDecision(svc ServiceConfig, current, up, down int, rules map[string]interface{}, dec *llmDecision) (action string, target int, note string, overruled bool) {
+	rulesAction, _ := rules["action"].(string)
+	rulesTarget, _ := rules["target_replicas"].(int)
+
+	target = dec.TargetReplicas
+	switch dec.Action {
+	case "hold":
+		return "hold", current, "", false
+	case "scale_up", "scale_down":
+	default:
+		return rulesAction, rulesTarget, fmt.Sprintf("unknown action %q, using the rules", dec.Action), true
+	}
+	if (dec.Action == "scale_up") != (target > current) || target == current {
+		return rulesAction, rulesTarget, fmt.Sprintf("%s to %d from %d is inconsistent, using the rules", dec.Action, target, current), true
+	}
+
+	limit := func(n int, why string) {
+		if n != target {
+			note = fmt.Sprintf("%s to %d limited to %d (%s)", dec.Action, dec.TargetReplicas, n, why)
+			target = n
+		}
+	}
+	switch {
+	case rulesAction != "hold" && rulesAction != dec.Action:
+		return rulesAction, rulesTarget, fmt.Sprintf("%s is against the rules (%s), using the rules", dec.Action, rulesAction), true
+	case rulesAction == "scale_up":
+		limit(min(target, rulesTarget), "rules target")
+	case rulesAction == "scale_down":
+		limit(max(target, rulesTarget), "rules target")
+	case dec.Action == "scale_up":
+		limit(min(target, current+up), "one step while the rules hold")
+	default:
+		limit(max(target, current-down), "one step while the rules hold")
+	}
+	if target > svc.MaxReplicas {
+		limit(svc.MaxReplicas, "max_replicas")
+	} else if target < svc.MinReplicas {
+		limit(svc.MinReplicas, "min_replicas")
+	}
+	if target == current {
+		return "hold", current, note, false
+	}
+	return dec.Action, target, note, false
+}
+
+// askLLM runs one conversation about a check: the model sees the observations and the
+// rules decision, may call read-only tools and must answer with submit_decision
+func askLLM(ctx context.Context, client llm.Client, svc ServiceConfig, current int, observations map[string]float64, rules map[string]interface{}, advisory bool) (*llmDecision, error) {
+	submit := objectSchema(schema{
+		"action":          schema{"type": "string", "enum": []string{"scale_up", "scale_down", "hold"}},
+		"target_replicas": replicasSchema,
+		"rationale":       schema{"type": "string"},
+	}, "action", "target_replicas", "rationale")
+	tools := []llm.Tool{{
+		Name:        "submit_decision",
+		Description: "Submit your scaling decision for this check. Call exactly once, as your last step.",
+		Parameters:  submit,
+	}}
+	for _, name := range llmDecisionTools {
+		if t := lookupTool(name); t != nil {
+			tools = append(tools, llm.Tool{Name: t.Name, Description: t.Description, Parameters: t.InputSchema})
+		}
+	}
+
+	role := "Your decision is executed after a guardrail check: you may hold or scale less than the rules, " +
+		"but not against their direction, past their target or outside the replica bounds; while the rules hold you may scale by one step."
+	if advisory {
+		role = "Your decision is advisory: the rules decision is executed and yours is recorded next to it for operators."
+	}
+	check, _ := json.MarshalIndent(map[string]interface{}{
+		"service":          svc.Name,
+		"current_replicas": current,
+		"min_replicas":     svc.MinReplicas,
+		"max_replicas":     svc.MaxReplicas,
+		"cooldown_sec":     svc.Cooldown,
+		"observations":     observations,
+		"rules":            svc.Rules,
+		"rules_decision": map[string]interface{}{
+			"action": rules["action"], "target_replicas": rules["target_replicas"], "reason": rules["reason"],
+		},
+	}, "", "  ")
+	messages := []llm.Message{
+		{Role: "system", Content: "You are Docktor, the autoscaler of a Docker Compose service. For every check you get the " +
+			"observed metrics and the decision of the configured rules. Look at the decision history or the config if it helps, " +
+			"then call submit_decision with action, target_replicas and a one-sentence rationale. " + role},
+		{Role: "user", Content: "Check:\n" + string(check)},
+	}
+
+	var answer *llmDecision
+	handle := func(ctx context.Context, call llm.ToolCall) (string, bool) {
+		args := json.RawMessage(call.Function.Arguments)
+		if call.Function.Name == "submit_decision" {
+			var dec llmDecision
+			if err := validateArguments(submit, args); err != nil {
+				return "invalid decision: " + err.Error(), false
+			}
+			if err := json.Unmarshal(args, &dec); err != nil {
+				return "invalid decision: " + err.Error(), false
+			}
+			answer = &dec
+			return "decision recorded", true
+		}
+		if !slices.Contains(llmDecisionTools, call.Function.Name) {
+			return "unknown tool: " + call.Function.Name, false
+		}
+		tool := lookupTool(call.Function.Name)
+		if err := validateArguments(tool.InputSchema, args); err != nil {
+			return "invalid arguments: " + err.Error(), false
+		}
+		res, err := tool.call(ctx, args, func(float64, float64, string) {})
+		if err != nil {
+			return "error: " + err.Error(), false
+		}
+		return toJSON(res), false
+	}
+
+	transcript, err := llm.Run(ctx, client, messages, tools, handle, llmMaxRounds)
+	if err != nil {
+		return nil, err
+	}
+	if answer == nil {
+		last := []rune(strings.TrimSpace(transcript[len(transcript)-1].Content))
+		if len(last) > 200 {
+			last = append(last[:200], '…')
+		}
+		return nil, fmt.Errorf("model answered without submit_decision: %q", string(last))
+	}
+	return answer, nil
+}
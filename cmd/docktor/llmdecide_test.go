@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hwclass/docktor/pkg/llm"
+)
+
+func TestGuardLLMDecision(t *testing.T) {
+	svc := ServiceConfig{Name: "web", MinReplicas: 1, MaxReplicas: 5}
+	rules := func(action string, target int) map[string]interface{} {
+		return map[string]interface{}{"action": action, "target_replicas": target, "reason": "rules"}
+	}
+
+	tests := []struct {
+		name          string
+		current       int
+		up, down      int // Step sizes; 0 means 1
+		rules         map[string]interface{}
+		dec           llmDecision
+		wantAction    string
+		wantTarget    int
+		wantOverruled bool
+		wantNote      string
+	}{
+		{
+			name: "hold is always allowed", current: 2, rules: rules("scale_up", 4),
+			dec: llmDecision{Action: "hold"}, wantAction: "hold", wantTarget: 2,
+		},
+		{
+			name: "within the rules target", current: 2, rules: rules("scale_up", 4),
+			dec: llmDecision{Action: "scale_up", TargetReplicas: 3}, wantAction: "scale_up", wantTarget: 3,
+		},
+		{
+			name: "direction against the rules", current: 3, rules: rules("scale_up", 4),
+			dec:        llmDecision{Action: "scale_down", TargetReplicas: 2},
+			wantAction: "scale_up", wantTarget: 4, wantOverruled: true, wantNote: "against the rules",
+		},
+		{
+			name: "action inconsistent with target", current: 3, rules: rules("hold", 3),
+			dec:        llmDecision{Action: "scale_up", TargetReplicas: 2},
+			wantAction: "hold", wantTarget: 3, wantOverruled: true, wantNote: "inconsistent",
+		},
+		{
+			name: "unknown action", current: 3, rules: rules("hold", 3),
+			dec:        llmDecision{Action: "restart", TargetReplicas: 3},
+			wantAction: "hold", wantTarget: 3, wantOverruled: true, wantNote: "unknown action",
+		},
+		{
+			name: "scale up beyond the rules target", current: 2, rules: rules("scale_up", 3),
+			dec:        llmDecision{Action: "scale_up", TargetReplicas: 5},
+			wantAction: "scale_up", wantTarget: 3, wantNote: "rules target",
+		},
+		{
+			name: "scale down beyond the rules target", current: 4, rules: rules("scale_down", 3),
+			dec:        llmDecision{Action: "scale_down", TargetReplicas: 1},
+			wantAction: "scale_down", wantTarget: 3, wantNote: "rules target",
+		},
+		{
+			name: "one step up while the rules hold", current: 2, rules: rules("hold", 2),
+			dec:        llmDecision{Action: "scale_up", TargetReplicas: 5},
+			wantAction: "scale_up", wantTarget: 3, wantNote: "one step while the rules hold",
+		},
+		{
+			name: "one step down while the rules hold", current: 4, rules: rules("hold", 4),
+			dec:        llmDecision{Action: "scale_down", TargetReplicas: 1},
+			wantAction: "scale_down", wantTarget: 3, wantNote: "one step while the rules hold",
+		},
+		{
+			name: "one configured step while the rules hold", current: 2, up: 2, rules: rules("hold", 2),
+			dec:        llmDecision{Action: "scale_up", TargetReplicas: 5},
+			wantAction: "scale_up", wantTarget: 4, wantNote: "one step while the rules hold",
+		},
+		{
+			name: "within a configured step while the rules hold", current: 5, down: 3, rules: rules("hold", 5),
+			dec:        llmDecision{Action: "scale_down", TargetReplicas: 3},
+			wantAction: "scale_down", wantTarget: 3,
+		},
+		{
+			name: "max_replicas", current: 5, rules: rules("scale_up", 7),
+			dec:        llmDecision{Action: "scale_up", TargetReplicas: 6},
+			wantAction: "hold", wantTarget: 5, wantNote: "max_replicas",
+		},
+		{
+			name: "min_replicas", current: 1, rules: rules("scale_down", 0),
+			dec:        llmDecision{Action: "scale_down", TargetReplicas: 0},
+			wantAction: "hold", wantTarget: 1, wantNote: "min_replicas",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := tt.dec
+			up, down := max(tt.up, 1), max(tt.down, 1)
+			action, target, note, overruled := guardLLMDecision(svc, tt.current, up, down, tt.rules, &dec)
+			if action != tt.wantAction || target != tt.wantTarget || overruled != tt.wantOverruled {
+				t.Errorf("got %s to %d (overruled=%v), want %s to %d (overruled=%v)",
+					action, target, overruled, tt.wantAction, tt.wantTarget, tt.wantOverruled)
+			}
+			if tt.wantNote == "" && note != "" {
+				t.Errorf("note = %q, want none", note)
+			}
+			if !strings.Contains(note, tt.wantNote) {
+				t.Errorf("note = %q, want it to mention %q", note, tt.wantNote)
+			}
+		})
+	}
+}
+
+// The rules and the guardrail must agree on what one step is
+func TestDecideScaleMultiSteps(t *testing.T) {
+	rules := Rules{
+		ScaleUpWhen:   []Condition{{Metric: "cpu.avg", Op: ">", Value: 80}},
+		ScaleDownWhen: []Condition{{Metric: "cpu.avg", Op: "<", Value: 20}},
+	}
+	up, down := ScalingConfig{ScaleUpBy: 3, ScaleDownBy: 2}.steps()
+
+	tests := []struct {
+		cpu        float64
+		current    int
+		wantAction string
+		wantTarget int
+	}{
+		{cpu: 90, current: 2, wantAction: "scale_up", wantTarget: 5},
+		{cpu: 90, current: 8, wantAction: "scale_up", wantTarget: 10}, // capped at max_replicas
+		{cpu: 10, current: 6, wantAction: "scale_down", wantTarget: 4},
+		{cpu: 10, current: 2, wantAction: "scale_down", wantTarget: 1}, // capped at min_replicas
+		{cpu: 50, current: 4, wantAction: "hold", wantTarget: 4},
+	}
+	for _, tt := range tests {
+		decision, err := toolDecideScaleMulti("web", tt.current, 1, 10, up, down, rules, map[string]float64{"cpu.avg": tt.cpu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision["action"] != tt.wantAction || decision["target_replicas"] != tt.wantTarget {
+			t.Errorf("cpu %v at %d replicas: got %v to %v, want %s to %d", tt.cpu, tt.current,
+				decision["action"], decision["target_replicas"], tt.wantAction, tt.wantTarget)
+		}
+	}
+}
+
+// runScalingIteration reads target_replicas back with a type assertion to int, for
+// every action; a float64 there panicked on each scale
+func TestDecideScaleMultiTargetIsInt(t *testing.T) {
+	rules := Rules{
+		ScaleUpWhen:   []Condition{{Metric: "cpu.avg", Op: ">", Value: 80}},
+		ScaleDownWhen: []Condition{{Metric: "cpu.avg", Op: "<", Value: 20}},
+	}
+	for _, cpu := range []float64{90, 50, 10} {
+		decision, err := toolDecideScaleMulti("web", 3, 1, 10, 1, 1, rules, map[string]float64{"cpu.avg": cpu})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := decision["target_replicas"].(int); !ok {
+			t.Errorf("cpu %v: target_replicas is %T, want int", cpu, decision["target_replicas"])
+		}
+	}
+}
+
+// fakeChat serves /chat/completions from a script of assistant replies and records
+// the requests it got
+type fakeChat struct {
+	mu       sync.Mutex
+	replies  []llm.Message
+	requests []struct {
+		Messages []llm.Message            `json:"messages"`
+		Tools    []map[string]interface{} `json:"tools"`
+	}
+}
+
+func (f *fakeChat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/chat/completions" {
+		http.NotFound(w, r)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, struct {
+		Messages []llm.Message            `json:"messages"`
+		Tools    []map[string]interface{} `json:"tools"`
+	}{})
+	if err := json.NewDecoder(r.Body).Decode(&f.requests[len(f.requests)-1]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(f.replies) == 0 {
+		http.Error(w, "script exhausted", http.StatusInternalServerError)
+		return
+	}
+	reply := f.replies[0]
+	f.replies = f.replies[1:]
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []map[string]interface{}{{"message": reply}},
+	})
+}
+
+func toolCall(id, name, args string) llm.Message {
+	return llm.Message{Role: "assistant", ToolCalls: []llm.ToolCall{{
+		ID: id, Type: "function", Function: llm.FunctionCall{Name: name, Arguments: args},
+	}}}
+}
+
+func TestAskLLMAgainstFakeServer(t *testing.T) {
+	fake := &fakeChat{replies: []llm.Message{
+		toolCall("1", "apply_scale", `{"service":"web","target_replicas":9}`),
+		toolCall("2", "submit_decision", `{"action":"scale_up","target_replicas":"three","rationale":"x"}`),
+		toolCall("3", "submit_decision", `{"action":"scale_up","target_replicas":3,"rationale":"Queue backlog keeps growing."}`),
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc := ServiceConfig{Name: "web", MinReplicas: 1, MaxReplicas: 5}
+	rules := map[string]interface{}{"action": "hold", "target_replicas": 2, "reason": "no rule matched"}
+	dec, err := askLLM(context.Background(), llm.NewOpenAI(srv.URL, "", "test-model"), svc, 2,
+		map[string]float64{"queue.backlog": 120}, rules, false)
+	if err != nil {
+		t.Fatalf("askLLM: %v", err)
+	}
+	if dec.Action != "scale_up" || dec.TargetReplicas != 3 || dec.Rationale != "Queue backlog keeps growing." {
+		t.Errorf("decision = %+v", dec)
+	}
+
+	if len(fake.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(fake.requests))
+	}
+	var offered []string
+	for _, tool := range fake.requests[0].Tools {
+		fn, _ := tool["function"].(map[string]interface{})
+		offered = append(offered, fmt.Sprint(fn["name"]))
+	}
+	if !strings.Contains(strings.Join(offered, ","), "submit_decision") || strings.Contains(strings.Join(offered, ","), "apply_scale") {
+		t.Errorf("offered tools %v, want submit_decision and only read-only tools", offered)
+	}
+	if check := fake.requests[0].Messages[1].Content; !strings.Contains(check, `"queue.backlog": 120`) || !strings.Contains(check, "no rule matched") {
+		t.Errorf("check message lacks the observations or the rules decision:\n%s", check)
+	}
+
+	// Each refused call is answered with a tool message before the model's next turn
+	toolResult := func(req int) string {
+		msgs := fake.requests[req].Messages
+		return msgs[len(msgs)-1].Content
+	}
+	if got := toolResult(1); !strings.Contains(got, "unknown tool: apply_scale") {
+		t.Errorf("apply_scale result = %q, want it refused", got)
+	}
+	if got := toolResult(2); !strings.Contains(got, "invalid decision") {
+		t.Errorf("invalid submit_decision result = %q, want it rejected", got)
+	}
+}
+
+func TestAskLLMWithoutSubmitDecision(t *testing.T) {
+	fake := &fakeChat{replies: []llm.Message{{Role: "assistant", Content: "I would scale up to 3."}}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	svc := ServiceConfig{Name: "web", MinReplicas: 1, MaxReplicas: 5}
+	rules := map[string]interface{}{"action": "hold", "target_replicas": 2, "reason": "no rule matched"}
+	_, err := askLLM(context.Background(), llm.NewOpenAI(srv.URL, "", "test-model"), svc, 2, nil, rules, true)
+	if err == nil || !strings.Contains(err.Error(), "without submit_decision") {
+		t.Errorf("err = %v, want an error about the missing submit_decision", err)
+	}
+}
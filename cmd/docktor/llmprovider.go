@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/llm"
+)
+
+const (
+	apiKeyTimeout  = 10 * time.Second // For api_key_command
+	apiKeyCacheTTL = 5 * time.Minute  // Keys are re-read after this, e.g. after rotation
+)
+
+var apiKeyCache struct {
+	sync.Mutex
+	source  llm.KeySource
+	key     string
+	expires time.Time
+}
+
+// provider returns the configured provider; LoadConfig has checked that it exists
+func (c LLMConfig) provider() llm.Provider {
+	p, _ := llm.Lookup(c.Provider)
+	return p
+}
+
+// baseURL returns the configured base URL or the provider's default
+func (c LLMConfig) baseURL() string {
+	if c.BaseURL != "" {
+		return c.BaseURL
+	}
+	return c.provider().DefaultBaseURL
+}
+
+// keySource returns where the API key is read from: the configured command, file or env
+// var, else the provider's default env var
+func (c LLMConfig) keySource() llm.KeySource {
+	env := c.APIKeyEnv
+	if env == "" {
+		env = c.provider().KeyEnv
+	}
+	return llm.KeySource{Env: env, File: c.APIKeyFile, Command: c.APIKeyCommand}
+}
+
+// llmAPIKey returns the API key for the configured provider. Keys are cached for a few
+// minutes, so a key command doesn't run on every check.
+func llmAPIKey(cfg LLMConfig) (string, error) {
+	src := cfg.keySource()
+	apiKeyCache.Lock()
+	defer apiKeyCache.Unlock()
+	if apiKeyCache.source == src && time.Now().Before(apiKeyCache.expires) {
+		return apiKeyCache.key, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyTimeout)
+	defer cancel()
+	key, err := src.Key(ctx)
+	if err != nil {
+		return "", err
+	}
+	if key == "" && cfg.provider().KeyRequired {
+		return "", fmt.Errorf("no API key for provider %s: set %s, llm.api_key_file or llm.api_key_command", cfg.Provider, src)
+	}
+	apiKeyCache.source, apiKeyCache.key, apiKeyCache.expires = src, key, time.Now().Add(apiKeyCacheTTL)
+	return key, nil
+}
+
+// newLLMClient returns a client for the configured provider
+func newLLMClient(cfg LLMConfig) (llm.Client, error) {
+	key, err := llmAPIKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return llm.New(llm.Config{Provider: cfg.Provider, BaseURL: cfg.BaseURL, APIKey: key, Model: cfg.Model})
+}
+
+// cagentEnv returns the .env.cagent contents for the configured provider. cagent talks to
+// OpenAI-compatible endpoints through OPENAI_*; Ollama serves one under /v1.
+func cagentEnv(cfg LLMConfig, apiKey string) string {
+	baseURL := cfg.baseURL()
+	key := apiKey
+	switch cfg.Provider {
+	case "dmr":
+		key = "dummy"
+	case "ollama":
+		baseURL = strings.TrimRight(baseURL, "/") + "/v1"
+		if key == "" {
+			key = "ollama"
+		}
+	}
+	env := fmt.Sprintf("OPENAI_BASE_URL=%s\nOPENAI_API_KEY=%s\nOPENAI_MODEL=%s\n", baseURL, key, cfg.Model)
+	if cfg.Provider == "anthropic" {
+		env += fmt.Sprintf("ANTHROPIC_API_KEY=%s\n", apiKey)
+	}
+	return env
+}
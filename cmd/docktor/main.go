@@ -2,21 +2,32 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hwclass/docktor/pkg/compose"
+	"github.com/hwclass/docktor/pkg/leader"
+	"github.com/hwclass/docktor/pkg/llm"
 	"github.com/hwclass/docktor/pkg/queue"
 	_ "github.com/hwclass/docktor/pkg/queue" // Import queue plugins for auto-registration
+	"github.com/hwclass/docktor/pkg/source"
 	"gopkg.in/yaml.v3"
 )
 
@@ -61,32 +72,71 @@ func usage() {
 	fmt.Println(`docktor CLI
 Usage:
   docktor daemon <start|stop|status|logs> [options]
-  docktor config <list-models|set-model|validate> [options]
-  docktor explain [--tail N] [--service NAME]
+  docktor config <list-models|set-model|validate|suggest> [options]
+  docktor explain [--tail N] [--service NAME] [--since D] [--dry-run] [--compare] [--narrate] [--config FILE]
+  docktor proposals [--all] [--service NAME] [--config FILE]
+  docktor approve <ID> | reject <ID> [--by NAME] [--note TEXT]
   docktor ai up [--debug] [--no-install] [--skip-compose] [--headless]
 
 Commands:
   daemon    Autonomous autoscaling daemon
-    start   Start daemon (autonomous by default)
+    start   Start daemon in the background (autonomous by default)
+            --foreground: Stay in the foreground (for systemd, supervisord, containers)
+            --no-watch: Don't reload automatically when the config file changes (SIGHUP still works)
             --config: Path to docktor.yaml config file
-            --manual: Require approval for each action
-            --compose-file: Path to compose file (overrides config)
+            --metrics: Serve Prometheus /metrics on host:port (also available on the API at /metrics)
+            --api: API listen address, unix:///path.sock or host:port (default: socket in state dir, "none" disables)
+            --state-dir: Base dir for PID, log, decisions and proposals
+                         (default: state_dir, $DOCKTOR_STATE_DIR or ~/.local/state/docktor)
+            --manual: Require approval for each action (see 'docktor proposals')
+            --approval-ttl: How long a proposal waits for approval (default: 15m)
+            --dry-run: Shadow mode - evaluate and log decisions, never scale
+                       (uses its own PID/log file so it can run next to a live daemon)
+            --compose-file: Path to compose file (overrides config, repeatable)
+            --project-name: Compose project name (overrides config)
+            --profile: Compose profile to enable (repeatable)
             --service: Service name to monitor (overrides config)
             --interval: Check interval in seconds (overrides config, e.g., 30)
-    stop    Stop running daemon
-    status  Check daemon status
-    logs    Follow daemon logs
+    stop    Stop running daemon (--dry-run: stop the shadow daemon)
+    status  Check daemon status (--dry-run: shadow daemon)
+    logs    Follow daemon logs (--dry-run: shadow daemon)
+            stop/status/logs take the same --config, --state-dir and --project-name
+            as start, so they find the daemon of the same project
+
+  State files live in <state dir>/<compose project>/, so daemons for different
+  projects can run side by side. explain, proposals, approve and reject accept
+  --config, --state-dir and --project-name to select the project.
 
   config    Configure LLM model selection
-    list-models       List available models from Docker Model Runner
+    list-models       List the models of the configured provider
     set-model <ID>    Set the active model
-            --provider=dmr|openai: LLM provider (default: keeps current)
-            --base-url=<URL>: API base URL (default: keeps current)
+            --provider=NAME: dmr, openai, openai_compatible, ollama or anthropic (default: keeps current)
+            --base-url=<URL>: API base URL (default: keeps current, or the new provider's)
+            --api-key-env=VAR | --api-key-file=PATH | --api-key-command=CMD:
+                              Where the API key comes from (default: the provider's env var)
     validate          Validate configuration and connectivity
+    suggest           Suggest rules and replica bounds from the recorded observations,
+                      show the change to docktor.yaml and apply it after confirmation
+            --service NAME: Service to tune (required with more than one service)
+            --since D: Only use checks of the last D (e.g. 24h) or after an RFC 3339 time
+            --llm: Ask the configured LLM (falls back to the built-in analysis)
+            --yes: Apply without asking
+            --config, --state-dir, --project-name: Select the project as for explain
 
   explain   Show scaling decision history
             --tail N: Show last N decisions (default: 10)
             --service NAME: Filter by service name
+            --dry-run: Show only shadow (dry-run) decisions
+            --compare: Compare shadow decisions against real ones
+            --window DURATION: Max time between paired decisions (default: 60s)
+            --since D: Only decisions of the last D (e.g. 1h) or after an RFC 3339 time
+            --narrate: Summarize the decisions with the configured LLM (what scaled, why,
+                       flapping or misconfiguration); a built-in summary if it is unreachable
+
+  proposals List scale actions waiting for approval (manual mode)
+            --all: Include decided and expired proposals
+  approve   Approve a pending proposal; the daemon executes it on its next check
+  reject    Reject a pending proposal
 
   ai up     Launch AI autoscaling agent (legacy interactive mode)
             --debug: Enable verbose logging
@@ -105,6 +155,8 @@ Examples:
 
   # Start manual daemon (requires user approval)
   docktor daemon start --manual
+  docktor proposals
+  docktor approve web-1a2b3c4d
 
   # Check every 30 seconds instead of default 10
   docktor daemon start --interval 30
@@ -116,9 +168,14 @@ Examples:
   docktor daemon status
   docktor daemon logs
 
-Internal:
+MCP:
   docktor mcp
-            MCP stdio server (called internally by cagent, not for direct use)`)
+            MCP stdio server (called internally by cagent)
+  docktor mcp --http :8765 [--token T] [--insecure] [--config docktor.yaml]
+            MCP streamable HTTP server on /mcp for remote agents and IDEs
+            --token: Require "Authorization: Bearer T" (default: $DOCKTOR_MCP_TOKEN)
+            --insecure: Serve without a token on a non-loopback address
+            --config: Compose project to act on when DOCKTOR_COMPOSE_FILE is not set`)
 }
 
 type opts struct {
@@ -130,7 +187,16 @@ type opts struct {
 
 type daemonOpts struct {
 	manual        bool
-	composeFile   string
+	dryRun        bool
+	foreground    bool
+	noWatch       bool
+	stateDir      string
+	apiAddr       string
+	metricsAddr   string
+	approvalTTL   time.Duration
+	composeFiles  []string
+	projectName   string
+	profiles      []string
 	service       string
 	configFile    string
 	checkInterval int
@@ -138,12 +204,21 @@ type daemonOpts struct {
 
 // Config represents docktor.yaml configuration
 type Config struct {
-	Version     string          `yaml:"version"`
-	Service     string          `yaml:"service,omitempty"` // Legacy: single service name (backward compatible)
-	ComposeFile string          `yaml:"compose_file"`
-	Scaling     ScalingConfig   `yaml:"scaling,omitempty"` // Legacy: single service scaling config
-	LLM         LLMConfig       `yaml:"llm"`
-	Services    []ServiceConfig `yaml:"services,omitempty"` // New: multi-service configuration
+	Version      string          `yaml:"version"`
+	Service      string          `yaml:"service,omitempty"` // Legacy: single service name (backward compatible)
+	ComposeFile  string          `yaml:"compose_file"`
+	ComposeFiles []string        `yaml:"compose_files,omitempty"`   // Multiple compose files, merged in order (like repeated -f)
+	ProjectName  string          `yaml:"project_name,omitempty"`    // Compose project name (default: same resolution as docker compose)
+	Profiles     []string        `yaml:"profiles,omitempty"`        // Compose profiles to enable
+	EnvFile      string          `yaml:"env_file,omitempty"`        // Env file for compose interpolation (default: .env next to the compose file)
+	StateDir     string          `yaml:"state_dir,omitempty"`       // Base dir for PID, log, decisions and proposals (default: XDG state dir)
+	Leader       LeaderConfig    `yaml:"leader_election,omitempty"` // Only the elected daemon of a project scales
+	API          APIConfig       `yaml:"api,omitempty"`             // HTTP API for status and control
+	Metrics      MetricsConfig   `yaml:"metrics,omitempty"`         // Prometheus endpoint
+	MCP          MCPConfig       `yaml:"mcp,omitempty"`             // Limits on what the LLM may do through MCP tools
+	Scaling      ScalingConfig   `yaml:"scaling,omitempty"`         // Legacy: single service scaling config
+	LLM          LLMConfig       `yaml:"llm"`
+	Services     []ServiceConfig `yaml:"services,omitempty"` // New: multi-service configuration
 }
 
 // ScalingConfig holds scaling thresholds and parameters
@@ -158,24 +233,32 @@ type ScalingConfig struct {
 	MetricsWindow int     `yaml:"metrics_window"`
 }
 
+// steps returns how many replicas one scale up or down adds or removes (at least 1)
+func (s ScalingConfig) steps() (up, down int) {
+	return max(s.ScaleUpBy, 1), max(s.ScaleDownBy, 1)
+}
+
 // LLMConfig holds LLM provider settings
 type LLMConfig struct {
-	Provider string `yaml:"provider"` // "dmr" or "openai"
-	BaseURL  string `yaml:"base_url"`
-	Model    string `yaml:"model"`
+	Provider      string `yaml:"provider"` // "dmr", "openai", "openai_compatible", "ollama" or "anthropic"
+	BaseURL       string `yaml:"base_url"` // Default: the provider's
+	Model         string `yaml:"model"`
+	APIKeyEnv     string `yaml:"api_key_env,omitempty"`     // Env var holding the API key (default: the provider's, e.g. OPENAI_API_KEY)
+	APIKeyFile    string `yaml:"api_key_file,omitempty"`    // File containing the API key
+	APIKeyCommand string `yaml:"api_key_command,omitempty"` // Shell command printing the API key
 }
 
 // Condition represents a single rule condition for scaling
 type Condition struct {
-	Metric string  `yaml:"metric"` // e.g., "cpu.avg_pct", "queue.backlog"
-	Op     string  `yaml:"op"`     // ">", ">=", "<", "<=", "==", "!="
-	Value  float64 `yaml:"value"`
+	Metric string  `yaml:"metric" json:"metric"` // e.g., "cpu.avg_pct", "queue.backlog"
+	Op     string  `yaml:"op" json:"op"`         // ">", ">=", "<", "<=", "==", "!="
+	Value  float64 `yaml:"value" json:"value"`
 }
 
 // Rules defines when to scale up or down
 type Rules struct {
-	ScaleUpWhen   []Condition `yaml:"scale_up_when"`   // Scale up if ANY condition matches (OR)
-	ScaleDownWhen []Condition `yaml:"scale_down_when"` // Scale down if ALL conditions match (AND)
+	ScaleUpWhen   []Condition `yaml:"scale_up_when" json:"scale_up_when"`     // Scale up if ANY condition matches (OR)
+	ScaleDownWhen []Condition `yaml:"scale_down_when" json:"scale_down_when"` // Scale down if ALL conditions match (AND)
 }
 
 // QueueConfig holds queue/messaging system configuration
@@ -191,13 +274,30 @@ type QueueConfig struct {
 
 // ServiceConfig holds per-service monitoring and scaling configuration
 type ServiceConfig struct {
-	Name          string       `yaml:"name"`
-	MinReplicas   int          `yaml:"min_replicas"`
-	MaxReplicas   int          `yaml:"max_replicas"`
-	MetricsWindow int          `yaml:"metrics_window"` // seconds
-	CheckInterval int          `yaml:"check_interval"` // seconds
-	Rules         Rules        `yaml:"rules"`
-	Queue         *QueueConfig `yaml:"queue,omitempty"` // Optional queue configuration
+	Name          string            `yaml:"name"`
+	MinReplicas   int               `yaml:"min_replicas"`
+	MaxReplicas   int               `yaml:"max_replicas"`
+	MetricsWindow int               `yaml:"metrics_window"` // seconds
+	CheckInterval int               `yaml:"check_interval"` // seconds
+	Rules         Rules             `yaml:"rules"`
+	Queue         *QueueConfig      `yaml:"queue,omitempty"`         // Optional queue configuration
+	Selector      map[string]string `yaml:"selector,omitempty"`      // Extra container labels limiting which replicas metrics are read from
+	Mode          string            `yaml:"mode,omitempty"`          // "active" (default) or "shadow": decide and log, never scale
+	Cooldown      int               `yaml:"cooldown,omitempty"`      // seconds after a scale action during which no other action is taken
+	DecisionMode  string            `yaml:"decision_mode,omitempty"` // "rules" (default), "llm" or "llm_advisory"
+	Prometheus    *PrometheusConfig `yaml:"prometheus,omitempty"`    // Optional application metrics (prom.*)
+	Probe         *ProbeConfig      `yaml:"probe,omitempty"`         // Optional synthetic HTTP probe (http.*)
+	Sources       []source.Config   `yaml:"sources,omitempty"`       // Metric sources (default: cpu); queue/prometheus/probe above are shorthands
+}
+
+// Shadow reports whether decisions for this service are only logged, never executed
+func (s ServiceConfig) Shadow() bool {
+	return s.Mode == "shadow"
+}
+
+// cooldown returns the minimum time between two scale actions
+func (s ServiceConfig) cooldown() time.Duration {
+	return time.Duration(s.Cooldown) * time.Second
 }
 
 // DefaultConfig returns config with sensible defaults
@@ -249,12 +349,30 @@ func LoadConfig(path string) (Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return cfg, fmt.Errorf("failed to parse config: %w", err)
 	}
+	// The default base URL is Docker Model Runner's; other providers bring their own
+	if cfg.LLM.Provider != DefaultConfig().LLM.Provider && cfg.LLM.BaseURL == DefaultConfig().LLM.BaseURL {
+		cfg.LLM.BaseURL = ""
+	}
 
 	// Resolve relative paths in config relative to config file location
 	configDir := filepath.Dir(path)
 	if !filepath.IsAbs(cfg.ComposeFile) {
 		cfg.ComposeFile = filepath.Join(configDir, cfg.ComposeFile)
 	}
+	for i, f := range cfg.ComposeFiles {
+		if !filepath.IsAbs(f) {
+			cfg.ComposeFiles[i] = filepath.Join(configDir, f)
+		}
+	}
+	if cfg.EnvFile != "" && !filepath.IsAbs(cfg.EnvFile) {
+		cfg.EnvFile = filepath.Join(configDir, cfg.EnvFile)
+	}
+	if cfg.StateDir != "" && !filepath.IsAbs(cfg.StateDir) {
+		cfg.StateDir = filepath.Join(configDir, cfg.StateDir)
+	}
+	if cfg.LLM.APIKeyFile != "" && !filepath.IsAbs(cfg.LLM.APIKeyFile) && !strings.HasPrefix(cfg.LLM.APIKeyFile, "~/") {
+		cfg.LLM.APIKeyFile = filepath.Join(configDir, cfg.LLM.APIKeyFile)
+	}
 
 	// Validate
 	if cfg.Scaling.MinReplicas < 1 {
@@ -267,9 +385,60 @@ func LoadConfig(path string) (Config, error) {
 		return cfg, fmt.Errorf("cpu_high must be > cpu_low")
 	}
 
+	provider, ok := llm.Lookup(cfg.LLM.Provider)
+	if !ok {
+		return cfg, fmt.Errorf("llm.provider must be one of %s, got '%s'", strings.Join(llm.Providers(), ", "), cfg.LLM.Provider)
+	}
+	keySources := 0
+	for _, v := range []string{cfg.LLM.APIKeyEnv, cfg.LLM.APIKeyFile, cfg.LLM.APIKeyCommand} {
+		if v != "" {
+			keySources++
+		}
+	}
+	if keySources > 1 {
+		return cfg, fmt.Errorf("llm: set only one of api_key_env, api_key_file and api_key_command")
+	}
+	if keySources == 0 && provider.KeyExplicit {
+		return cfg, fmt.Errorf("llm.provider %s requires api_key_env, api_key_file or api_key_command", cfg.LLM.Provider)
+	}
+
+	switch cfg.Leader.Kind {
+	case "", "file", "nats", "none":
+	default:
+		return cfg, fmt.Errorf("leader_election.kind must be 'file', 'nats' or 'none', got '%s'", cfg.Leader.Kind)
+	}
+	if cfg.Leader.Kind == "nats" && cfg.Leader.URL == "" {
+		return cfg, fmt.Errorf("leader_election.url is required for kind 'nats'")
+	}
+
 	// Normalize: convert legacy single-service format to multi-service format
 	cfg.Normalize()
 
+	for _, svc := range cfg.Services {
+		if svc.Mode != "" && svc.Mode != "active" && svc.Mode != "shadow" {
+			return cfg, fmt.Errorf("service %s: mode must be 'active' or 'shadow', got '%s'", svc.Name, svc.Mode)
+		}
+		if svc.Cooldown < 0 {
+			return cfg, fmt.Errorf("service %s: cooldown must be >= 0", svc.Name)
+		}
+		switch svc.DecisionMode {
+		case "", decisionRules, decisionLLM, decisionLLMAdvisory:
+		default:
+			return cfg, fmt.Errorf("service %s: decision_mode must be 'rules', 'llm' or 'llm_advisory', got '%s'", svc.Name, svc.DecisionMode)
+		}
+		// Creating the sources validates their settings; connections are only opened on first use
+		sources, err := source.NewSet(svc.metricSources())
+		if err != nil {
+			return cfg, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		sources.Close()
+	}
+	for _, name := range cfg.MCP.AllowServices {
+		if _, ok := cfg.service(name); !ok {
+			return cfg, fmt.Errorf("mcp.allow_services: unknown service %s", name)
+		}
+	}
+
 	return cfg, nil
 }
 
@@ -278,25 +447,52 @@ func (c *Config) Normalize() {
 	// If services array is empty but we have legacy Service/Scaling, convert it
 	if len(c.Services) == 0 && c.Service != "" {
 		// Convert legacy format to multi-service format
-		c.Services = []ServiceConfig{
-			{
-				Name:          c.Service,
-				MinReplicas:   c.Scaling.MinReplicas,
-				MaxReplicas:   c.Scaling.MaxReplicas,
-				MetricsWindow: c.Scaling.MetricsWindow,
-				CheckInterval: c.Scaling.CheckInterval,
-				Rules: Rules{
-					ScaleUpWhen: []Condition{
-						{Metric: "cpu.avg_pct", Op: ">", Value: c.Scaling.CPUHigh},
-					},
-					ScaleDownWhen: []Condition{
-						{Metric: "cpu.avg_pct", Op: "<", Value: c.Scaling.CPULow},
-					},
-				},
-				Queue: nil, // No queue in legacy format
+		c.Services = []ServiceConfig{c.legacyService()}
+	}
+}
+
+// legacyService returns the services entry equivalent to the legacy service/scaling fields
+func (c *Config) legacyService() ServiceConfig {
+	return ServiceConfig{
+		Name:          c.Service,
+		MinReplicas:   c.Scaling.MinReplicas,
+		MaxReplicas:   c.Scaling.MaxReplicas,
+		MetricsWindow: c.Scaling.MetricsWindow,
+		CheckInterval: c.Scaling.CheckInterval,
+		Rules: Rules{
+			ScaleUpWhen: []Condition{
+				{Metric: "cpu.avg_pct", Op: ">", Value: c.Scaling.CPUHigh},
+			},
+			ScaleDownWhen: []Condition{
+				{Metric: "cpu.avg_pct", Op: "<", Value: c.Scaling.CPULow},
 			},
+		},
+		Queue: nil, // No queue in legacy format
+	}
+}
+
+// service returns the config of a service by name
+func (c *Config) service(name string) (ServiceConfig, bool) {
+	for _, svc := range c.Services {
+		if svc.Name == name {
+			return svc, true
 		}
 	}
+	return ServiceConfig{}, false
+}
+
+// ComposeOptions returns the compose files and project settings selected by the config
+func (c *Config) ComposeOptions() compose.Options {
+	files := c.ComposeFiles
+	if len(files) == 0 && c.ComposeFile != "" {
+		files = []string{c.ComposeFile}
+	}
+	return compose.Options{
+		Files:       files,
+		ProjectName: c.ProjectName,
+		Profiles:    c.Profiles,
+		EnvFile:     c.EnvFile,
+	}
 }
 
 func parseFlags(args []string) opts {
@@ -317,14 +513,11 @@ func parseFlags(args []string) opts {
 }
 
 func parseDaemonFlags(args []string) daemonOpts {
-	const (
-		defaultComposeFile = "examples/docker-compose.yaml"
-		defaultService     = "web"
-	)
+	const defaultService = "web"
 
 	opts := daemonOpts{
-		composeFile: defaultComposeFile,
 		service:     defaultService,
+		approvalTTL: defaultApprovalTTL,
 	}
 
 	for idx := 0; idx < len(args); idx++ {
@@ -332,14 +525,52 @@ func parseDaemonFlags(args []string) daemonOpts {
 		switch arg {
 		case "--manual":
 			opts.manual = true
+		case "--dry-run":
+			opts.dryRun = true
+		case "--foreground":
+			opts.foreground = true
+		case "--no-watch":
+			opts.noWatch = true
+		case "--approval-ttl":
+			if idx+1 < len(args) {
+				if ttl, err := time.ParseDuration(args[idx+1]); err == nil && ttl > 0 {
+					opts.approvalTTL = ttl
+				}
+				idx++
+			}
 		case "--config":
 			if idx+1 < len(args) {
 				opts.configFile = args[idx+1]
 				idx++
 			}
+		case "--state-dir":
+			if idx+1 < len(args) {
+				opts.stateDir = args[idx+1]
+				idx++
+			}
+		case "--api":
+			if idx+1 < len(args) {
+				opts.apiAddr = args[idx+1]
+				idx++
+			}
+		case "--metrics":
+			if idx+1 < len(args) {
+				opts.metricsAddr = args[idx+1]
+				idx++
+			}
 		case "--compose-file":
 			if idx+1 < len(args) {
-				opts.composeFile = args[idx+1]
+				opts.composeFiles = append(opts.composeFiles, args[idx+1])
+				idx++
+			}
+		case "--project-name":
+			if idx+1 < len(args) {
+				opts.projectName = args[idx+1]
+				idx++
+			}
+		case "--profile":
+			if idx+1 < len(args) {
+				opts.profiles = append(opts.profiles, args[idx+1])
 				idx++
 			}
 		case "--service":
@@ -385,28 +616,41 @@ func main() {
 		runConfig(os.Args[2], os.Args[3:])
 	case "explain":
 		runExplain(os.Args[2:])
+	case "proposals":
+		runProposals(os.Args[2:])
+	case "approve":
+		runApproval(proposalApproved, os.Args[2:])
+	case "reject":
+		runApproval(proposalRejected, os.Args[2:])
 	case "mcp":
-		runMCP()
+		runMCP(os.Args[2:])
 	default:
 		usage()
 	}
 }
 
 func runDaemon(action string, args []string) {
-	const (
-		pidFile = "/tmp/docktor-daemon.pid"
-		logFile = "/tmp/docktor-daemon.log"
-	)
+	opts := parseDaemonFlags(args)
+
+	// Resolve the per-project state dir the same way for every action. Config errors
+	// are reported by `start`; stop/status/logs must keep working with a broken config.
+	cfg, _ := LoadConfig(opts.configFile)
+	applyDaemonOverrides(&cfg, opts)
+	st, err := resolveStatePaths(cfg, opts.stateDir, opts.dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	switch action {
 	case "start":
-		daemonStart(args, pidFile, logFile)
+		daemonStart(args, opts, st)
 	case "stop":
-		daemonStop(pidFile)
+		daemonStop(st.PIDFile)
 	case "status":
-		daemonStatus(pidFile, logFile)
+		daemonStatus(st, cfg.API.Token)
 	case "logs":
-		daemonLogs(logFile)
+		daemonLogs(st.LogFile)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown daemon action: %s\n", action)
 		usage()
@@ -421,15 +665,17 @@ func runConfig(action string, args []string) {
 	case "set-model":
 		if len(args) < 1 {
 			fmt.Fprintf(os.Stderr, "Error: model ID required\n")
-			fmt.Fprintf(os.Stderr, "Usage: docktor config set-model <MODEL_ID> [--provider=dmr|openai] [--base-url=<URL>]\n")
+			fmt.Fprintf(os.Stderr, "Usage: docktor config set-model <MODEL_ID> [--provider=NAME] [--base-url=<URL>] [--api-key-env|file|command=VALUE]\n")
 			os.Exit(1)
 		}
 		configSetModel(args)
 	case "validate":
 		configValidate()
+	case "suggest":
+		configSuggest(args)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown config action: %s\n", action)
-		fmt.Fprintf(os.Stderr, "Available actions: list-models, set-model, validate\n")
+		fmt.Fprintf(os.Stderr, "Available actions: list-models, set-model, validate, suggest\n")
 		os.Exit(1)
 	}
 }
@@ -437,6 +683,11 @@ func runConfig(action string, args []string) {
 func runExplain(args []string) {
 	tail := 10
 	serviceFilter := ""
+	dryRunOnly := false
+	compare := false
+	narrate := false
+	var since time.Time
+	window := 60 * time.Second
 
 	// Parse flags
 	for i := 0; i < len(args); i++ {
@@ -450,39 +701,56 @@ func runExplain(args []string) {
 		} else if args[i] == "--service" && i+1 < len(args) {
 			serviceFilter = args[i+1]
 			i++
+		} else if args[i] == "--dry-run" {
+			dryRunOnly = true
+		} else if args[i] == "--compare" {
+			compare = true
+		} else if args[i] == "--narrate" {
+			narrate = true
+		} else if strings.HasPrefix(args[i], "--since") {
+			value := strings.TrimPrefix(args[i], "--since=")
+			if args[i] == "--since" && i+1 < len(args) {
+				value = args[i+1]
+				i++
+			}
+			var err error
+			if since, err = parseSince(value, time.Now()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		} else if args[i] == "--window" && i+1 < len(args) {
+			if w, err := time.ParseDuration(args[i+1]); err == nil {
+				window = w
+			}
+			i++
 		}
 	}
 
 	// Read JSONL file
-	f, err := os.Open("/tmp/docktor-decisions.jsonl")
+	cfg, st := cliConfig(args)
+	decisions, err := readDecisions(st.Decisions, serviceFilter)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Cannot open decision log: %v\n", err)
 		fmt.Fprintf(os.Stderr, "The daemon may not have run yet or no decisions have been logged.\n")
 		os.Exit(1)
 	}
-	defer f.Close()
+	if !since.IsZero() {
+		decisions = slices.DeleteFunc(decisions, func(d decisionRecord) bool { return d.Time().Before(since) })
+	}
 
-	// Parse all lines
-	type Decision struct {
-		Timestamp       string             `json:"timestamp"`
-		Service         string             `json:"service"`
-		Action          string             `json:"action"`
-		CurrentReplicas int                `json:"current_replicas"`
-		TargetReplicas  int                `json:"target_replicas"`
-		Reason          string             `json:"reason"`
-		Observations    map[string]float64 `json:"observations"`
-	}
-
-	var decisions []Decision
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		var d Decision
-		if err := json.Unmarshal(scanner.Bytes(), &d); err == nil {
-			// Filter by service if specified
-			if serviceFilter == "" || d.Service == serviceFilter {
-				decisions = append(decisions, d)
+	if compare {
+		explainCompare(decisions, tail, window)
+		return
+	}
+
+	if dryRunOnly {
+		shadow := decisions[:0]
+		for _, d := range decisions {
+			if d.DryRun {
+				shadow = append(shadow, d)
 			}
 		}
+		decisions = shadow
 	}
 
 	if len(decisions) == 0 {
@@ -490,6 +758,11 @@ func runExplain(args []string) {
 		return
 	}
 
+	if narrate {
+		explainNarrate(cfg, decisions, since)
+		return
+	}
+
 	// Take last N decisions
 	start := 0
 	if len(decisions) > tail {
@@ -502,10 +775,9 @@ func runExplain(args []string) {
 	fmt.Println(strings.Repeat("-", 100))
 
 	// Print decisions
+	hasDryRun := false
 	for _, d := range decisions {
-		// Parse timestamp
-		ts, _ := time.Parse(time.RFC3339, d.Timestamp)
-		timeStr := ts.Format("15:04:05")
+		timeStr := d.Time().Format("15:04:05")
 
 		// Format replica change
 		replicaChange := fmt.Sprintf("%d→%d", d.CurrentReplicas, d.TargetReplicas)
@@ -516,7 +788,13 @@ func runExplain(args []string) {
 			reason = reason[:47] + "..."
 		}
 
-		fmt.Printf("%-12s %-10s %-10s %-8s %-50s\n", timeStr, d.Service, d.Action, replicaChange, reason)
+		action := d.Action
+		if d.DryRun {
+			action += "*"
+			hasDryRun = true
+		}
+
+		fmt.Printf("%-12s %-10s %-10s %-8s %-50s\n", timeStr, d.Service, action, replicaChange, reason)
 	}
 
 	fmt.Printf("\nShowing %d of %d total decisions", len(decisions), len(decisions)+start)
@@ -524,6 +802,9 @@ func runExplain(args []string) {
 		fmt.Printf(" (filtered by service: %s)", serviceFilter)
 	}
 	fmt.Println()
+	if hasDryRun {
+		fmt.Println("* dry-run (shadow) decision, not executed")
+	}
 }
 
 func runAIUp(args []string) {
@@ -652,23 +933,42 @@ type rpcErr struct {
 	Message string `json:"message"`
 }
 
-func writeRes(id json.RawMessage, result interface{}) {
+// mcpWriter delivers JSON-RPC messages to one MCP client, whatever the transport
+type mcpWriter interface {
+	write(msg interface{}) error
+}
+
+// stdioWriter writes newline-delimited JSON to stdout
+type stdioWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (s *stdioWriter) write(msg interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(msg)
+}
+
+func writeRes(w mcpWriter, id json.RawMessage, result interface{}) {
 	res := rpcRes{Jsonrpc: "2.0", ID: id, Result: result}
 	resJSON, _ := json.Marshal(res)
 	log.Printf("→ Response: %s", string(resJSON))
-	enc := json.NewEncoder(os.Stdout)
-	_ = enc.Encode(res)
+	_ = w.write(res)
 }
-func writeErr(id json.RawMessage, code int, msg string) {
+func writeErr(w mcpWriter, id json.RawMessage, code int, msg string) {
+	if id == nil {
+		id = json.RawMessage("null") // Request could not be read
+	}
 	res := rpcRes{Jsonrpc: "2.0", ID: id, Error: &rpcErr{Code: code, Message: msg}}
 	resJSON, _ := json.Marshal(res)
 	log.Printf("→ Error Response: %s", string(resJSON))
-	enc := json.NewEncoder(os.Stdout)
-	_ = enc.Encode(res)
+	_ = w.write(res)
 }
 
 type GetMetricsParams struct {
 	ContainerRegex string `json:"container_regex"`
+	Service        string `json:"service"`
 	WindowSec      int    `json:"window_sec"`
 }
 type DetectParams struct {
@@ -688,20 +988,19 @@ type ApplyParams struct {
 	Reason         string `json:"reason"`
 }
 
-func mcpInitialize(id json.RawMessage, params json.RawMessage) {
+func mcpInitialize(w mcpWriter, id json.RawMessage, params json.RawMessage) {
 	var in struct {
 		ProtocolVersion string          `json:"protocolVersion"`
 		ClientInfo      json.RawMessage `json:"clientInfo"`
 	}
 	_ = json.Unmarshal(params, &in)
-	pv := strings.TrimSpace(in.ProtocolVersion)
-	if pv == "" {
-		pv = "2024-06-01"
-	}
-	writeRes(id, map[string]interface{}{
+	pv := negotiateProtocolVersion(strings.TrimSpace(in.ProtocolVersion))
+	writeRes(w, id, map[string]interface{}{
 		"protocolVersion": pv,
 		"capabilities": map[string]interface{}{
-			"tools": map[string]interface{}{},
+			"tools":     map[string]interface{}{},
+			"resources": map[string]interface{}{},
+			"prompts":   map[string]interface{}{},
 		},
 		"serverInfo": map[string]interface{}{
 			"name":    "docktor-mcp",
@@ -710,335 +1009,12 @@ func mcpInitialize(id json.RawMessage, params json.RawMessage) {
 	})
 }
 
-func mcpToolsList(id json.RawMessage) {
-	type tool struct {
-		Name        string                 `json:"name"`
-		Description string                 `json:"description"`
-		InputSchema map[string]interface{} `json:"inputSchema"`
-	}
-	tools := []tool{
-		{
-			Name:        "get_metrics",
-			Description: "Return avg CPU% over window for containers matching regex",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"container_regex": map[string]interface{}{"type": "string"},
-					"window_sec":      map[string]interface{}{"type": "integer"},
-				},
-				"required": []string{"container_regex"},
-			},
-		},
-		{
-			Name:        "get_current_replicas",
-			Description: "Get the current number of running replicas for a service from Docker Compose",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"service": map[string]interface{}{"type": "string"},
-				},
-				"required": []string{"service"},
-			},
-		},
-		{
-			Name:        "calculate_target_replicas",
-			Description: "Calculate target replicas based on scaling recommendation and current count. Handles all arithmetic logic per config.",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"recommendation":   map[string]interface{}{"type": "string", "enum": []string{"scale_up", "scale_down", "hold"}},
-					"current_replicas": map[string]interface{}{"type": "integer"},
-				},
-				"required": []string{"recommendation", "current_replicas"},
-			},
-		},
-		{
-			Name:        "detect_anomalies",
-			Description: "Recommend scale_up/scale_down based on CPU thresholds",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"metrics": map[string]interface{}{"type": "object"},
-					"rules": map[string]interface{}{
-						"type":                 "object",
-						"additionalProperties": false,
-						"properties": map[string]interface{}{
-							"cpu_high_pct": map[string]interface{}{"type": "number"},
-							"cpu_low_pct":  map[string]interface{}{"type": "number"},
-						},
-						"required": []string{"cpu_high_pct", "cpu_low_pct"},
-					},
-				},
-				"required": []string{"metrics", "rules"},
-			},
-		},
-		{
-			Name:        "propose_scale",
-			Description: "Echo the docker compose scaling command for validation",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"service":         map[string]interface{}{"type": "string"},
-					"target_replicas": map[string]interface{}{"type": "integer"},
-				},
-				"required": []string{"service", "target_replicas"},
-			},
-		},
-		{
-			Name:        "apply_scale",
-			Description: "Run docker compose --scale",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"service":         map[string]interface{}{"type": "string"},
-					"target_replicas": map[string]interface{}{"type": "integer"},
-					"reason":          map[string]interface{}{"type": "string"},
-				},
-				"required": []string{"service", "target_replicas"},
-			},
-		},
-		{
-			Name:        "get_queue_metrics",
-			Description: "Collect queue metrics from NATS JetStream (backlog, lag, rates)",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"queue_config": map[string]interface{}{
-						"type": "object",
-						"properties": map[string]interface{}{
-							"kind":      map[string]interface{}{"type": "string"},
-							"url":       map[string]interface{}{"type": "string"},
-							"jetstream": map[string]interface{}{"type": "boolean"},
-							"stream":    map[string]interface{}{"type": "string"},
-							"consumer":  map[string]interface{}{"type": "string"},
-							"subject":   map[string]interface{}{"type": "string"},
-						},
-						"required": []string{"kind", "url"},
-					},
-					"window_sec": map[string]interface{}{"type": "integer"},
-				},
-				"required": []string{"queue_config", "window_sec"},
-			},
-		},
-		{
-			Name:        "decide_scale_multi",
-			Description: "Evaluate multi-metric scaling rules and decide action (scale_up/scale_down/hold)",
-			InputSchema: map[string]interface{}{
-				"type":                 "object",
-				"additionalProperties": false,
-				"properties": map[string]interface{}{
-					"service_name":     map[string]interface{}{"type": "string"},
-					"current_replicas": map[string]interface{}{"type": "integer"},
-					"min_replicas":     map[string]interface{}{"type": "integer"},
-					"max_replicas":     map[string]interface{}{"type": "integer"},
-					"rules": map[string]interface{}{
-						"type": "object",
-						"properties": map[string]interface{}{
-							"scale_up_when":   map[string]interface{}{"type": "array"},
-							"scale_down_when": map[string]interface{}{"type": "array"},
-						},
-					},
-					"observations": map[string]interface{}{"type": "object"},
-				},
-				"required": []string{"service_name", "current_replicas", "min_replicas", "max_replicas", "rules", "observations"},
-			},
-		},
-	}
-	writeRes(id, map[string]interface{}{
-		"tools":      tools,
-		"nextCursor": nil,
-	})
-}
-
-func mcpToolsCall(id json.RawMessage, params json.RawMessage) {
-	var p struct {
-		Name      string          `json:"name"`
-		Arguments json.RawMessage `json:"arguments"`
-	}
-	if err := json.Unmarshal(params, &p); err != nil {
-		writeErr(id, -32602, "bad params")
-		return
-	}
-
-	switch p.Name {
-	case "get_metrics":
-		var in GetMetricsParams
-		_ = json.Unmarshal(p.Arguments, &in)
-		if in.WindowSec <= 0 {
-			in.WindowSec = 60
-		}
-		log.Printf("[MCP] get_metrics(container_regex=%q, window_sec=%d)", in.ContainerRegex, in.WindowSec)
-		res, err := toolGetMetrics(in.ContainerRegex, in.WindowSec)
-		if err != nil {
-			log.Printf("[MCP] get_metrics ERROR: %v", err)
-			writeErr(id, 1, err.Error())
-			return
-		}
-		log.Printf("[MCP] get_metrics RESULT: %v", res)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(map[string]interface{}{"metrics": res})},
-			},
-			"isError": false,
-		})
-	case "get_current_replicas":
-		var in struct {
-			Service string `json:"service"`
-		}
-		_ = json.Unmarshal(p.Arguments, &in)
-		log.Printf("[MCP] get_current_replicas(service=%s)", in.Service)
-		count, err := toolGetCurrentReplicas(in.Service)
-		if err != nil {
-			log.Printf("[MCP] get_current_replicas ERROR: %v", err)
-			writeErr(id, 1, err.Error())
-			return
-		}
-		log.Printf("[MCP] get_current_replicas RESULT: %d", count)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(map[string]interface{}{"current_replicas": count})},
-			},
-			"isError": false,
-		})
-	case "calculate_target_replicas":
-		var in struct {
-			Recommendation  string `json:"recommendation"`
-			CurrentReplicas int    `json:"current_replicas"`
-		}
-		_ = json.Unmarshal(p.Arguments, &in)
-		log.Printf("[MCP] calculate_target_replicas(recommendation=%s, current_replicas=%d)", in.Recommendation, in.CurrentReplicas)
-		result, err := toolCalculateTargetReplicas(in.Recommendation, in.CurrentReplicas)
-		if err != nil {
-			log.Printf("[MCP] calculate_target_replicas ERROR: %v", err)
-			writeErr(id, 1, err.Error())
-			return
-		}
-		log.Printf("[MCP] calculate_target_replicas RESULT: %v", result)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(result)},
-			},
-			"isError": false,
-		})
-	case "detect_anomalies":
-		var in DetectParams
-		_ = json.Unmarshal(p.Arguments, &in)
-		log.Printf("[MCP] detect_anomalies(metrics=%v, cpu_high=%.1f, cpu_low=%.1f)", in.Metrics, in.Rules.CPUHighPct, in.Rules.CPULowPct)
-		action, reason := toolDetect(in.Metrics, in.Rules.CPUHighPct, in.Rules.CPULowPct)
-		log.Printf("[MCP] detect_anomalies RESULT: action=%s, reason=%s", action, reason)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(map[string]interface{}{"recommendation": action, "reason": reason})},
-			},
-			"isError": false,
-		})
-	case "propose_scale":
-		var in ProposeParams
-		_ = json.Unmarshal(p.Arguments, &in)
-		cmd := fmt.Sprintf("docker compose -f %q up -d --scale %s=%d",
-			os.Getenv("DOCKTOR_COMPOSE_FILE"), in.Service, in.TargetReplicas)
-		log.Printf("[MCP] propose_scale(service=%s, target_replicas=%d) → %s", in.Service, in.TargetReplicas, cmd)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(map[string]interface{}{"valid": true, "message": "proposal valid", "command": cmd})},
-			},
-			"isError": false,
-		})
-	case "apply_scale":
-		var in ApplyParams
-		_ = json.Unmarshal(p.Arguments, &in)
-		compose := os.Getenv("DOCKTOR_COMPOSE_FILE")
-		if compose == "" {
-			log.Printf("[MCP] apply_scale ERROR: DOCKTOR_COMPOSE_FILE not set")
-			writeErr(id, 2, "DOCKTOR_COMPOSE_FILE not set")
-			return
-		}
-		log.Printf("[MCP] apply_scale(service=%s, target_replicas=%d, reason=%s) EXECUTING...", in.Service, in.TargetReplicas, in.Reason)
-		err := run("docker", "compose", "-f", compose, "up", "-d", "--scale", fmt.Sprintf("%s=%d", in.Service, in.TargetReplicas))
-		if err != nil {
-			log.Printf("[MCP] apply_scale FAILED: %v", err)
-			writeRes(id, map[string]interface{}{
-				"content": []map[string]interface{}{
-					{"type": "text", "text": toJSON(map[string]interface{}{"valid": false, "message": "failed to scale: " + err.Error()})},
-				},
-				"isError": false,
-			})
-			return
-		}
-		log.Printf("[MCP] apply_scale SUCCESS: scaled %s to %d (reason: %s)", in.Service, in.TargetReplicas, in.Reason)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(map[string]interface{}{"valid": true, "message": fmt.Sprintf("scaled %s to %d. reason: %s", in.Service, in.TargetReplicas, in.Reason)})},
-			},
-			"isError": false,
-		})
-	case "get_queue_metrics":
-		var in struct {
-			QueueConfig QueueConfig `json:"queue_config"`
-			WindowSec   int         `json:"window_sec"`
-		}
-		_ = json.Unmarshal(p.Arguments, &in)
-		if in.WindowSec <= 0 {
-			in.WindowSec = 5
-		}
-		log.Printf("[MCP] get_queue_metrics(kind=%s, stream=%s, consumer=%s, window_sec=%d)",
-			in.QueueConfig.Kind, in.QueueConfig.Stream, in.QueueConfig.Consumer, in.WindowSec)
-		res, err := toolGetQueueMetrics(in.QueueConfig, in.WindowSec)
-		if err != nil {
-			log.Printf("[MCP] get_queue_metrics ERROR: %v", err)
-			writeErr(id, 1, err.Error())
-			return
-		}
-		log.Printf("[MCP] get_queue_metrics RESULT: %v", res)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(res)},
-			},
-			"isError": false,
-		})
-	case "decide_scale_multi":
-		var in struct {
-			ServiceName     string             `json:"service_name"`
-			CurrentReplicas int                `json:"current_replicas"`
-			MinReplicas     int                `json:"min_replicas"`
-			MaxReplicas     int                `json:"max_replicas"`
-			Rules           Rules              `json:"rules"`
-			Observations    map[string]float64 `json:"observations"`
-		}
-		_ = json.Unmarshal(p.Arguments, &in)
-		log.Printf("[MCP] decide_scale_multi(service=%s, current=%d, min=%d, max=%d, observations=%v)",
-			in.ServiceName, in.CurrentReplicas, in.MinReplicas, in.MaxReplicas, in.Observations)
-		res, err := toolDecideScaleMulti(in.ServiceName, in.CurrentReplicas, in.MinReplicas, in.MaxReplicas, in.Rules, in.Observations)
-		if err != nil {
-			log.Printf("[MCP] decide_scale_multi ERROR: %v", err)
-			writeErr(id, 1, err.Error())
-			return
-		}
-		log.Printf("[MCP] decide_scale_multi RESULT: %v", res)
-		writeRes(id, map[string]interface{}{
-			"content": []map[string]interface{}{
-				{"type": "text", "text": toJSON(res)},
-			},
-			"isError": false,
-		})
-	default:
-		writeErr(id, -32601, "unknown tool")
-	}
-}
-
 func toJSON(v interface{}) string {
 	b, _ := json.Marshal(v)
 	return string(b)
 }
 
-func toolGetMetrics(containerRegex string, windowSec int) (map[string]float64, error) {
+func toolGetMetrics(ctx context.Context, containerRegex string, windowSec int, onSample func(elapsed, window int)) (map[string]float64, error) {
 	re, err := regexp.Compile(containerRegex)
 	if err != nil {
 		return nil, fmt.Errorf("bad regex: %w", err)
@@ -1050,9 +1026,10 @@ func toolGetMetrics(containerRegex string, windowSec int) (map[string]float64, e
 	}
 	agg := map[string]*acc{}
 
-	stop := time.Now().Add(time.Duration(windowSec) * time.Second)
+	start := time.Now()
+	stop := start.Add(time.Duration(windowSec) * time.Second)
 	for time.Now().Before(stop) {
-		out, err := exec.Command("bash", "-lc",
+		out, err := exec.CommandContext(ctx, "bash", "-lc",
 			`docker stats --no-stream --format '{{.Name}} {{.CPUPerc}}'`).CombinedOutput()
 		if err != nil {
 			return nil, fmt.Errorf("docker stats: %w", err)
@@ -1079,7 +1056,14 @@ func toolGetMetrics(containerRegex string, windowSec int) (map[string]float64, e
 			agg[name].sum += val
 			agg[name].n++
 		}
-		time.Sleep(1 * time.Second)
+		if onSample != nil {
+			onSample(int(time.Since(start)/time.Second), windowSec)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
 
 	avg := map[string]float64{}
@@ -1091,37 +1075,61 @@ func toolGetMetrics(containerRegex string, windowSec int) (map[string]float64, e
 	return avg, nil
 }
 
-func toolGetCurrentReplicas(service string) (int, error) {
-	composeFile := os.Getenv("DOCKTOR_COMPOSE_FILE")
-	if composeFile == "" {
-		return 0, fmt.Errorf("DOCKTOR_COMPOSE_FILE not set")
+// composeProjectFromEnv loads the compose project selected by the DOCKTOR_COMPOSE_* variables
+// (DOCKTOR_COMPOSE_FILE may list several files separated by the OS path list separator)
+func composeProjectFromEnv() (*compose.Project, error) {
+	files := os.Getenv("DOCKTOR_COMPOSE_FILE")
+	if files == "" {
+		return nil, fmt.Errorf("DOCKTOR_COMPOSE_FILE not set")
+	}
+	opts := compose.Options{
+		Files:       filepath.SplitList(files),
+		ProjectName: os.Getenv("DOCKTOR_COMPOSE_PROJECT"),
+		EnvFile:     os.Getenv("DOCKTOR_COMPOSE_ENV_FILE"),
 	}
+	if profiles := os.Getenv("DOCKTOR_COMPOSE_PROFILES"); profiles != "" {
+		opts.Profiles = strings.Split(profiles, ",")
+	}
+	return compose.Load(opts)
+}
 
-	// Use docker compose ps to count running containers for the service
-	out, err := exec.Command("docker", "compose", "-f", composeFile, "ps", service, "--format", "{{.Name}}").CombinedOutput()
+// setComposeEnv exports the project selection for MCP tools and child processes
+func setComposeEnv(project *compose.Project) {
+	os.Setenv("DOCKTOR_COMPOSE_FILE", strings.Join(project.Files, string(os.PathListSeparator)))
+	os.Setenv("DOCKTOR_COMPOSE_PROJECT", project.Name)
+	os.Setenv("DOCKTOR_COMPOSE_PROFILES", strings.Join(project.Profiles, ","))
+	os.Setenv("DOCKTOR_COMPOSE_ENV_FILE", project.EnvFile)
+}
+
+func toolGetCurrentReplicas(service string) (int, error) {
+	project, err := composeProjectFromEnv()
 	if err != nil {
-		return 0, fmt.Errorf("docker compose ps: %w", err)
+		return 0, err
 	}
 
-	// Count non-empty lines
-	count := 0
-	scanner := bufio.NewScanner(strings.NewReader(string(out)))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			count++
-		}
+	// Count running containers carrying the project and service labels
+	containers, err := selectServiceContainers(project, ServiceConfig{Name: service})
+	if err != nil {
+		return 0, err
 	}
+	return len(containers), nil
+}
 
-	return count, nil
+// toolGetServiceMetrics samples CPU of a service's containers, selected by compose labels
+func toolGetServiceMetrics(ctx context.Context, service string, windowSec int, onSample func(elapsed, window int)) (map[string]float64, error) {
+	project, err := composeProjectFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := selectServiceContainers(project, ServiceConfig{Name: service})
+	if err != nil {
+		return nil, err
+	}
+	return sampleContainerMetrics(ctx, containers, windowSec, onSample)
 }
 
-func toolCalculateTargetReplicas(recommendation string, currentReplicas int) (map[string]interface{}, error) {
-	// Get config values from environment
-	minReplicas, _ := strconv.Atoi(os.Getenv("DOCKTOR_MIN_REPLICAS"))
-	maxReplicas, _ := strconv.Atoi(os.Getenv("DOCKTOR_MAX_REPLICAS"))
-	scaleUpBy, _ := strconv.Atoi(os.Getenv("DOCKTOR_SCALE_UP_BY"))
-	scaleDownBy, _ := strconv.Atoi(os.Getenv("DOCKTOR_SCALE_DOWN_BY"))
+// toolCalculateTargetReplicas applies a recommendation within the configured bounds and steps
+func toolCalculateTargetReplicas(recommendation string, currentReplicas, minReplicas, maxReplicas, scaleUpBy, scaleDownBy int) (map[string]interface{}, error) {
 
 	var targetReplicas int
 	var action string
@@ -1191,7 +1199,24 @@ func toolDetect(metrics map[string]float64, hi, lo float64) (string, string) {
 }
 
 // toolGetQueueMetrics collects queue metrics using the queue plugin architecture
-func toolGetQueueMetrics(queueCfg QueueConfig, windowSec int) (map[string]float64, error) {
+func toolGetQueueMetrics(ctx context.Context, queueCfg QueueConfig, windowSec int) (map[string]float64, error) {
+	provider, err := newQueueProvider(queueCfg)
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+
+	// Get metrics
+	metrics, err := provider.GetMetrics(ctx, windowSec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue metrics: %w", err)
+	}
+
+	return queueObservations(metrics, queueCfg.Metrics), nil
+}
+
+// newQueueProvider creates and connects the queue provider for a queue config
+func newQueueProvider(queueCfg QueueConfig) (queue.Provider, error) {
 	// Convert QueueConfig to queue.Config
 	cfg := queue.Config{
 		Kind: queueCfg.Kind,
@@ -1209,19 +1234,20 @@ func toolGetQueueMetrics(queueCfg QueueConfig, windowSec int) (map[string]float6
 	if err != nil {
 		return nil, fmt.Errorf("failed to create queue provider: %w", err)
 	}
-	defer provider.Close()
 
 	// Connect
 	if err := provider.Connect(); err != nil {
+		provider.Close()
 		return nil, fmt.Errorf("failed to connect to queue: %w", err)
 	}
 
-	// Get metrics
-	metrics, err := provider.GetMetrics(windowSec)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get queue metrics: %w", err)
-	}
+	return provider, nil
+}
 
+// queueObservations converts queue metrics to observations with the queue. prefix
+// queueObservations converts queue metrics to queue.<name> observations, keeping only
+// the names in keep (e.g. backlog) unless it is empty
+func queueObservations(metrics *queue.Metrics, keep []string) map[string]float64 {
 	// Convert to map[string]float64 for MCP
 	result := map[string]float64{
 		"queue.backlog":  metrics.Backlog,
@@ -1235,11 +1261,19 @@ func toolGetQueueMetrics(queueCfg QueueConfig, windowSec int) (map[string]float6
 		result["queue."+k] = v
 	}
 
-	return result, nil
+	if len(keep) > 0 {
+		for name := range result {
+			if !slices.Contains(keep, strings.TrimPrefix(name, "queue.")) {
+				delete(result, name)
+			}
+		}
+	}
+	return result
 }
 
-// toolDecideScaleMulti evaluates multi-metric rules and decides scaling action
-func toolDecideScaleMulti(serviceName string, currentReplicas, minReplicas, maxReplicas int, rules Rules, observations map[string]float64) (map[string]interface{}, error) {
+// toolDecideScaleMulti evaluates multi-metric rules and decides scaling action; a scale
+// up adds up replicas and a scale down removes down (see ScalingConfig.steps)
+func toolDecideScaleMulti(serviceName string, currentReplicas, minReplicas, maxReplicas, up, down int, rules Rules, observations map[string]float64) (map[string]interface{}, error) {
 	// Helper to evaluate a single condition
 	evaluateCondition := func(cond Condition) bool {
 		value, exists := observations[cond.Metric]
@@ -1295,7 +1329,7 @@ func toolDecideScaleMulti(serviceName string, currentReplicas, minReplicas, maxR
 	if len(scaleUpMatches) > 0 {
 		// Scale up: ANY condition matched
 		action = "scale_up"
-		targetReplicas = currentReplicas + 2 // TODO: make configurable via scale_up_by
+		targetReplicas = currentReplicas + up
 		if targetReplicas > maxReplicas {
 			targetReplicas = maxReplicas
 		}
@@ -1304,7 +1338,7 @@ func toolDecideScaleMulti(serviceName string, currentReplicas, minReplicas, maxR
 	} else if allScaleDownMatch {
 		// Scale down: ALL conditions matched
 		action = "scale_down"
-		targetReplicas = currentReplicas - 1 // TODO: make configurable via scale_down_by
+		targetReplicas = currentReplicas - down
 		if targetReplicas < minReplicas {
 			targetReplicas = minReplicas
 		}
@@ -1336,36 +1370,114 @@ func toolDecideScaleMulti(serviceName string, currentReplicas, minReplicas, maxR
 	}, nil
 }
 
-func runMCP() {
+// runMCP serves the MCP tools over stdio, or over streamable HTTP with --http
+func runMCP(args []string) {
 	inMCP = true
 	log.SetOutput(os.Stderr)
 
+	var httpAddr, configPath string
+	var insecure bool
+	token := os.Getenv("DOCKTOR_MCP_TOKEN")
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--http" && i+1 < len(args):
+			httpAddr = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--http="):
+			httpAddr = strings.TrimPrefix(args[i], "--http=")
+		case args[i] == "--token" && i+1 < len(args):
+			token = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--token="):
+			token = strings.TrimPrefix(args[i], "--token=")
+		case args[i] == "--insecure":
+			insecure = true
+		case args[i] == "--config" && i+1 < len(args):
+			configPath = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--config="):
+			configPath = strings.TrimPrefix(args[i], "--config=")
+		}
+	}
+	if httpAddr != "" {
+		if configPath != "" {
+			if abs, err := filepath.Abs(configPath); err == nil {
+				os.Setenv(configEnv, abs)
+			}
+		}
+		// Started by hand rather than by cagent: take the compose project from the config
+		if os.Getenv("DOCKTOR_COMPOSE_FILE") == "" {
+			cfg, err := LoadConfig(configPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			project, err := compose.Load(cfg.ComposeOptions())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			setComposeEnv(project)
+		}
+		if err := serveMCPHTTP(httpAddr, token, insecure); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Messages are handled concurrently so a cancellation can reach a running tool call;
+	// at end of input, in-flight requests still get their responses
+	w := &stdioWriter{enc: json.NewEncoder(os.Stdout)}
+	conn := newMCPConn()
 	dec := json.NewDecoder(os.Stdin)
+	var wg sync.WaitGroup
+	defer wg.Wait()
 	for {
-		var req rpcReq
-		if err := dec.Decode(&req); err != nil {
-			log.Printf("ERROR decoding request: %v", err)
+		var msg json.RawMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err != io.EOF {
+				log.Printf("ERROR decoding request: %v", err)
+			}
 			return
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.serve(context.Background(), w, msg)
+		}()
+	}
+}
 
-		reqJSON, _ := json.Marshal(req)
-		log.Printf("← %s (full request: %s)", req.Method, string(reqJSON))
-
-		switch req.Method {
-		case "initialize":
-			mcpInitialize(req.ID, req.Params)
-		case "notifications/initialized":
-			log.Printf("DEBUG: Client initialized notification received")
-		case "tools/list":
-			log.Printf("DEBUG: tools/list params=%s", string(req.Params))
-			mcpToolsList(req.ID)
-		case "tools/call":
-			mcpToolsCall(req.ID, req.Params)
-		default:
-			log.Printf("WARN: Unknown method: %s", req.Method)
-			if len(req.ID) > 0 {
-				writeErr(req.ID, -32601, "unknown method: "+req.Method)
-			}
+// handleMCP dispatches one JSON-RPC message; responses go to w
+func handleMCP(ctx context.Context, w mcpWriter, req rpcReq) {
+	reqJSON, _ := json.Marshal(req)
+	log.Printf("← %s (full request: %s)", req.Method, string(reqJSON))
+
+	switch req.Method {
+	case "initialize":
+		mcpInitialize(w, req.ID, req.Params)
+	case "notifications/initialized":
+		log.Printf("DEBUG: Client initialized notification received")
+	case "tools/list":
+		log.Printf("DEBUG: tools/list params=%s", string(req.Params))
+		mcpToolsList(w, req.ID)
+	case "tools/call":
+		mcpToolsCall(ctx, w, req.ID, req.Params)
+	case "ping":
+		writeRes(w, req.ID, map[string]interface{}{})
+	case "resources/list":
+		mcpResourcesList(w, req.ID)
+	case "resources/read":
+		mcpResourcesRead(w, req.ID, req.Params)
+	case "prompts/list":
+		mcpPromptsList(w, req.ID)
+	case "prompts/get":
+		mcpPromptsGet(w, req.ID, req.Params)
+	default:
+		log.Printf("WARN: Unknown method: %s", req.Method)
+		if len(req.ID) > 0 {
+			writeErr(w, req.ID, -32601, "unknown method: "+req.Method)
 		}
 	}
 }
@@ -1400,7 +1512,23 @@ func generateAgentConfig(sourceFile, targetFile string, cfg Config) error {
 		return fmt.Errorf("invalid agent file: missing instruction")
 	}
 
-	// Substitute config values into instruction
+	docktor["instruction"] = substituteAgentVars(instruction, cfg)
+
+	// Write modified config
+	output, err := yaml.Marshal(agentYAML)
+	if err != nil {
+		return fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+
+	if err := os.WriteFile(targetFile, output, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// substituteAgentVars fills the $DOCKTOR_* placeholders of an agent instruction from the config
+func substituteAgentVars(instruction string, cfg Config) string {
 	instruction = strings.ReplaceAll(instruction, "$DOCKTOR_SERVICE", cfg.Service)
 	instruction = strings.ReplaceAll(instruction, "$DOCKTOR_METRICS_WINDOW", fmt.Sprintf("%d", cfg.Scaling.MetricsWindow))
 	instruction = strings.ReplaceAll(instruction, "$DOCKTOR_CPU_HIGH", fmt.Sprintf("%.0f", cfg.Scaling.CPUHigh))
@@ -1411,24 +1539,81 @@ func generateAgentConfig(sourceFile, targetFile string, cfg Config) error {
 	instruction = strings.ReplaceAll(instruction, "$DOCKTOR_SCALE_DOWN_BY", fmt.Sprintf("%d", cfg.Scaling.ScaleDownBy))
 	instruction = strings.ReplaceAll(instruction, "$DOCKTOR_LLM_PROVIDER", cfg.LLM.Provider)
 	instruction = strings.ReplaceAll(instruction, "$DOCKTOR_LLM_MODEL", cfg.LLM.Model)
+	return instruction
+}
 
-	docktor["instruction"] = instruction
+// daemon holds the state shared by all service monitors
+type daemon struct {
+	logFh       *os.File
+	logMu       sync.Mutex
+	project     atomic.Pointer[compose.Project] // Replaced on config reload
+	config      atomic.Pointer[Config]          // Replaced on config reload
+	manual      bool                            // Queue scale actions for approval instead of executing them
+	dryRun      bool                            // Shadow mode for all services: decide and log, never scale
+	approvalTTL time.Duration                   // How long a proposal waits for a decision
+	state       statePaths                      // Per-project PID, log, decision and proposal files
+
+	elector        leader.Elector // nil when leader election is disabled
+	leading        atomic.Bool    // Holds the lease; followers run in shadow mode
+	followerLogged bool
+	electionStop   chan struct{}
+	electionDone   chan struct{}
+
+	startedAt time.Time
+	apiServer *http.Server
+	metrics   *daemonMetrics
+
+	monitorsMu sync.Mutex
+	monitors   map[string]*monitorHandle // Running monitors by service name
+}
 
-	// Write modified config
-	output, err := yaml.Marshal(agentYAML)
-	if err != nil {
-		return fmt.Errorf("failed to marshal YAML: %w", err)
-	}
+// serviceMonitor holds the per-service state of a running monitor
+type serviceMonitor struct {
+	svc     ServiceConfig
+	state   *serviceState // Persisted across restarts (iteration, cooldown, history)
+	sources *source.Set   // Metric sources, created on first use and rebuilt when their config changes
 
-	if err := os.WriteFile(targetFile, output, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	replicas     int                    // Running replicas seen by the last iteration
+	lastCheck    time.Time              // When the last iteration ran
+	lastDecision map[string]interface{} // Decision log entry of the last iteration
+}
+
+// metricSources returns the service's metric sources, creating them on first use
+func (m *serviceMonitor) metricSources() (*source.Set, error) {
+	if m.sources == nil {
+		set, err := source.NewSet(m.svc.metricSources())
+		if err != nil {
+			return nil, err
+		}
+		m.sources = set
 	}
+	return m.sources, nil
+}
 
-	return nil
+// closeSources closes the metric sources (e.g. queue connections), if any
+func (m *serviceMonitor) closeSources() {
+	if m.sources != nil {
+		m.sources.Close()
+		m.sources = nil
+	}
 }
 
-// monitorService runs the scaling loop for a single service
-func monitorService(svc ServiceConfig, logFh *os.File, composeFile string) {
+// monitorService runs the scaling loop for a single service until ctx is cancelled.
+// Cancellation never interrupts an iteration; the loop exits once the current one is done.
+// The service config is re-read before every iteration so reloads apply in place.
+func monitorService(ctx context.Context, d *daemon, h *monitorHandle) {
+	svc := h.config()
+	state, err := loadServiceState(d.state.Services, svc.Name)
+	if err != nil {
+		d.logf("[%s] WARNING: Cannot load saved state, starting fresh: %v", svc.Name, err)
+	} else if state.Iteration > 0 {
+		d.logf("[%s] Resuming at iteration %d (last action: %s)", svc.Name, state.Iteration, describeLastAction(state))
+	}
+	m := &serviceMonitor{svc: svc, state: state}
+	defer m.closeSources()
+	h.paused.Store(state.Paused)
+	h.publish(d, m)
+
 	checkInterval := time.Duration(svc.CheckInterval) * time.Second
 	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop()
@@ -1436,89 +1621,221 @@ func monitorService(svc ServiceConfig, logFh *os.File, composeFile string) {
 	log.Printf("[%s] Monitor started (interval=%ds, replicas=%d-%d)\n",
 		svc.Name, svc.CheckInterval, svc.MinReplicas, svc.MaxReplicas)
 
-	iteration := 0
-	for range ticker.C {
-		iteration++
-		runScalingIteration(svc, iteration, logFh, composeFile)
+	// finish persists the state and publishes it to the API after any change
+	finish := func() {
+		m.state.Paused = h.paused.Load()
+		if err := saveServiceState(d.state.Services, m.state); err != nil {
+			d.logf("[%s] WARNING: Cannot save state: %v", m.svc.Name, err)
+		}
+		h.publish(d, m)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[%s] Monitor stopped\n", svc.Name)
+			return
+		case req := <-h.scaleReq:
+			req.reply <- d.forceScale(m, req)
+			finish()
+		case <-h.trigger:
+			// Also used to persist a pause/resume right away; paused services are not evaluated
+			if !h.paused.Load() {
+				m.state.Iteration++
+				runScalingIteration(d, m)
+			}
+			finish()
+		case <-ticker.C:
+			if latest := h.config(); !reflect.DeepEqual(latest, m.svc) {
+				if !reflect.DeepEqual(latest.metricSources(), m.svc.metricSources()) {
+					m.closeSources() // Recreate (and reconnect) with the new source settings
+				}
+				if latest.CheckInterval != m.svc.CheckInterval {
+					ticker.Reset(time.Duration(latest.CheckInterval) * time.Second)
+				}
+				m.svc = latest
+			}
+			if h.paused.Load() {
+				continue
+			}
+			m.state.Iteration++
+			runScalingIteration(d, m)
+			finish()
+		}
 	}
 }
 
 // runScalingIteration performs one scaling check for a service
-func runScalingIteration(svc ServiceConfig, iteration int, logFh *os.File, composeFile string) {
+func runScalingIteration(d *daemon, m *serviceMonitor) {
+	svc := m.svc
+	logFh := d.logFh
 	timestamp := time.Now()
-	fmt.Fprintf(logFh, "\n=== [%s] Iteration %d (%s) ===\n", svc.Name, iteration, timestamp.Format("15:04:05"))
+	fmt.Fprintf(logFh, "\n=== [%s] Iteration %d (%s) ===\n", svc.Name, m.state.Iteration, timestamp.Format("15:04:05"))
 	logFh.Sync()
+	defer func() {
+		d.metrics.iterationDuration.Observe(time.Since(timestamp).Seconds(), svc.Name)
+	}()
 
-	// 1. Get current replica count
-	currentReplicas, err := toolGetCurrentReplicas(svc.Name)
+	// Followers decide and log like a shadow daemon but never scale
+	follower := !d.isLeader()
+	shadow := d.dryRun || svc.Shadow() || follower
+
+	// In manual mode, act on operator decisions before evaluating again
+	if d.manual && !shadow {
+		processDecidedProposals(d, m)
+	}
+
+	// 1. Select the service's containers by compose labels; all of them count as
+	// replicas, metrics are read from those matching the selector
+	containers, err := selectServiceContainers(d.project.Load(), svc)
 	if err != nil {
-		fmt.Fprintf(logFh, "[%s] ERROR: Failed to get current replicas: %v\n", svc.Name, err)
+		fmt.Fprintf(logFh, "[%s] ERROR: Failed to select containers: %v\n", svc.Name, err)
+		d.metrics.iterationErrors.Inc(svc.Name, "containers")
 		return
 	}
+	currentReplicas := len(containers)
+	m.replicas, m.lastCheck = currentReplicas, timestamp
+	d.metrics.replicas.Set(float64(currentReplicas), svc.Name)
 	fmt.Fprintf(logFh, "[%s] Current replicas: %d\n", svc.Name, currentReplicas)
 
-	// 2. Get CPU metrics
-	cpuMetrics, err := toolGetMetrics(svc.Name, svc.MetricsWindow)
+	// 2. Collect all metric sources in parallel over the metrics window
+	sources, err := m.metricSources()
 	if err != nil {
-		fmt.Fprintf(logFh, "[%s] ERROR: Failed to get CPU metrics: %v\n", svc.Name, err)
+		fmt.Fprintf(logFh, "[%s] ERROR: Invalid metric sources: %v\n", svc.Name, err)
+		d.metrics.iterationErrors.Inc(svc.Name, "sources")
 		return
 	}
-
-	// 3. Merge all observations (start with CPU metrics)
-	observations := make(map[string]float64)
-	for k, v := range cpuMetrics {
-		observations[k] = v
-	}
-
-	// 4. Get queue metrics if configured
-	if svc.Queue != nil {
-		queueMetrics, err := toolGetQueueMetrics(*svc.Queue, svc.MetricsWindow)
-		if err != nil {
-			fmt.Fprintf(logFh, "[%s] WARNING: Failed to get queue metrics: %v\n", svc.Name, err)
+	target := source.Target{Project: d.project.Load().Name, Service: svc.Name, Containers: metricContainers(containers, svc)}
+	observations, errs := sources.Collect(context.Background(), target, time.Duration(svc.MetricsWindow)*time.Second)
+	failed := false
+	for _, e := range errs {
+		d.metrics.sourceErrors.Inc(svc.Name, e.Source.Namespace)
+		if e.Source.Kind == "queue" {
+			d.metrics.queueErrors.Inc(svc.Name, fmt.Sprint(e.Source.Options["provider"]))
+		}
+		if e.Source.Required {
+			fmt.Fprintf(logFh, "[%s] ERROR: Failed to get %s metrics: %v\n", svc.Name, e.Source.Namespace, e.Err)
+			failed = true
 		} else {
-			for k, v := range queueMetrics {
-				observations[k] = v
-			}
+			fmt.Fprintf(logFh, "[%s] WARNING: %s metrics incomplete: %v\n", svc.Name, e.Source.Namespace, e.Err)
 		}
 	}
+	if failed {
+		d.metrics.iterationErrors.Inc(svc.Name, "metrics")
+		d.metrics.recordObservations(svc.Name, nil)
+		return
+	}
 
 	fmt.Fprintf(logFh, "[%s] Observations: %v\n", svc.Name, observations)
+	m.state.recordObservations(timestamp, currentReplicas, observations)
+	d.metrics.recordObservations(svc.Name, observations)
 
-	// 5. Decide scaling action
-	decision, err := toolDecideScaleMulti(svc.Name, currentReplicas, svc.MinReplicas, svc.MaxReplicas, svc.Rules, observations)
+	// 3. Decide scaling action
+	up, down := d.config.Load().Scaling.steps()
+	decision, err := toolDecideScaleMulti(svc.Name, currentReplicas, svc.MinReplicas, svc.MaxReplicas, up, down, svc.Rules, observations)
 	if err != nil {
 		fmt.Fprintf(logFh, "[%s] ERROR: Failed to decide scaling: %v\n", svc.Name, err)
+		d.metrics.iterationErrors.Inc(svc.Name, "decide")
 		return
 	}
+	if mode := svc.decisionMode(); mode != decisionRules {
+		if m.state.cooldownRemaining(timestamp) > 0 {
+			// The cooldown turns any action into a hold, so the model is not asked
+			decision["decision_mode"] = mode
+			fmt.Fprintf(logFh, "[%s] In cooldown, not consulting the LLM\n", svc.Name)
+		} else {
+			// The model decides (or advises); the rules result above is its guardrail
+			d.consultLLM(svc, mode, currentReplicas, observations, decision)
+		}
+	}
 
 	action := decision["action"].(string)
-	targetReplicas := int(decision["target_replicas"].(float64))
+	targetReplicas := decision["target_replicas"].(int)
 	reason := decision["reason"].(string)
 
+	// Suppress further actions until the cooldown after the last one has passed
+	if remaining := m.state.cooldownRemaining(timestamp); action != "hold" && remaining > 0 {
+		reason = fmt.Sprintf("cooldown: %s %s ago, %s remaining (wanted %s to %d)",
+			m.state.LastAction, timestamp.Sub(*m.state.LastActionAt).Round(time.Second), remaining.Round(time.Second), action, targetReplicas)
+		action, targetReplicas = "hold", currentReplicas
+		decision["action"], decision["target_replicas"], decision["reason"] = action, targetReplicas, reason
+		decision["cooldown_remaining_sec"] = int(remaining.Seconds())
+	}
+
 	fmt.Fprintf(logFh, "[%s] Decision: %s (current=%d, target=%d, reason=%s)\n",
 		svc.Name, action, currentReplicas, targetReplicas, reason)
 
-	// 6. Execute scaling if needed
-	if action != "hold" {
-		fmt.Fprintf(logFh, "[%s] Executing: docker compose -f %s up -d --scale %s=%d\n",
-			svc.Name, composeFile, svc.Name, targetReplicas)
-
-		err := run("docker", "compose", "-f", composeFile, "up", "-d", "--scale", fmt.Sprintf("%s=%d", svc.Name, targetReplicas))
+	// 4. Execute scaling if needed (only the managed service is touched)
+	if shadow {
+		// Shadow mode: record what would happen, never invoke the scaler
+		decision["dry_run"] = true
+		decision["mode"] = d.serviceMode(svc)
+		if follower {
+			// Also when the service is in shadow mode: the leader logs the same check
+			decision["mode"] = "follower"
+		}
+		if action != "hold" {
+			// Not recorded as an action: a cooldown must only follow a scale that ran
+			fmt.Fprintf(logFh, "[%s] DRY-RUN: would scale %d→%d (%s)\n", svc.Name, currentReplicas, targetReplicas, reason)
+			d.metrics.recordScaleAction(svc.Name, action, "shadow")
+		}
+	} else if action != "hold" && d.manual {
+		p, created, err := queueProposal(d, svc, action, currentReplicas, targetReplicas, reason, observations)
+		switch {
+		case err != nil:
+			fmt.Fprintf(logFh, "[%s] ERROR: Cannot queue proposal: %v\n", svc.Name, err)
+		case created:
+			d.metrics.recordScaleAction(svc.Name, action, "proposed")
+			fmt.Fprintf(logFh, "[%s] Proposal %s queued, awaiting approval: docktor approve %s (expires %s)\n",
+				svc.Name, p.ID, p.ID, p.ExpiresAt.Format("15:04:05"))
+		default:
+			fmt.Fprintf(logFh, "[%s] Awaiting decision on proposal %s, not queueing another\n", svc.Name, p.ID)
+		}
+		if p != nil {
+			decision["proposal_id"] = p.ID
+			decision["status"] = "pending_approval"
+		}
+	} else if action != "hold" && !d.isLeader() {
+		// The lease was lost while the metrics window ran
+		fmt.Fprintf(logFh, "[%s] Lost leadership during the check, not scaling %d→%d\n", svc.Name, currentReplicas, targetReplicas)
+		decision["dry_run"], decision["mode"] = true, "follower"
+		d.metrics.recordScaleAction(svc.Name, action, "shadow")
+	} else if action != "hold" {
+		res, err := scaleComposeService(d.project.Load(), svc.Name, targetReplicas, logFh)
 		if err != nil {
 			fmt.Fprintf(logFh, "[%s] ERROR: Scaling failed: %v\n", svc.Name, err)
+			d.metrics.recordScaleAction(svc.Name, action, "failed")
 		} else {
 			fmt.Fprintf(logFh, "[%s] ✓ Scaled successfully to %d replicas\n", svc.Name, targetReplicas)
+			m.state.recordAction(timestamp, action, targetReplicas, svc.cooldown())
+			d.metrics.recordScaleAction(svc.Name, action, "success")
 		}
+		if res != nil {
+			decision["containers_created"] = res.Created
+			decision["containers_removed"] = res.Removed
+			if len(res.Drifted) > 0 {
+				decision["drifted_containers"] = res.Drifted
+			}
+		}
+	}
+
+	// Remember the replica count to restore if the stack is restarted from scratch
+	if !shadow && action == "hold" && currentReplicas > 0 {
+		m.state.DesiredReplicas = currentReplicas
 	}
 
-	// 7. Log decision to JSONL file
-	logDecisionJSONL(svc.Name, timestamp, action, currentReplicas, targetReplicas, reason, observations, decision)
+	d.metrics.desiredReplicas.Set(float64(targetReplicas), svc.Name)
+	d.metrics.iterations.Inc(svc.Name)
+
+	// 5. Log decision to JSONL file
+	m.lastDecision = d.logDecisionJSONL(svc.Name, timestamp, action, currentReplicas, targetReplicas, reason, observations, decision)
 
 	logFh.Sync()
 }
 
-// logDecisionJSONL appends a decision record to /tmp/docktor-decisions.jsonl
-func logDecisionJSONL(service string, timestamp time.Time, action string, currentReplicas, targetReplicas int, reason string, observations map[string]float64, decision map[string]interface{}) {
+// logDecisionJSONL appends a decision record to the decision log in the state dir
+// and returns the record
+func (d *daemon) logDecisionJSONL(service string, timestamp time.Time, action string, currentReplicas, targetReplicas int, reason string, observations map[string]float64, decision map[string]interface{}) map[string]interface{} {
 	entry := map[string]interface{}{
 		"timestamp":        timestamp.Format(time.RFC3339),
 		"service":          service,
@@ -1529,21 +1846,41 @@ func logDecisionJSONL(service string, timestamp time.Time, action string, curren
 		"observations":     observations,
 		"matched_rules":    decision["matched_rules"],
 	}
+	// Keep any additional details (container changes, approvals, ...) without overriding the core fields
+	for k, v := range decision {
+		if _, exists := entry[k]; !exists && k != "policy" {
+			entry[k] = v
+		}
+	}
 
-	f, err := os.OpenFile("/tmp/docktor-decisions.jsonl", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err := appendDecision(d.state.Decisions, entry); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+	return entry
+}
+
+// appendDecision appends one entry to the decisions JSONL log
+func appendDecision(path string, entry map[string]interface{}) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Printf("ERROR: Failed to open decisions log: %v", err)
-		return
+		return fmt.Errorf("failed to open decisions log: %w", err)
 	}
 	defer f.Close()
 
 	if err := json.NewEncoder(f).Encode(entry); err != nil {
-		log.Printf("ERROR: Failed to write decision log: %v", err)
+		return fmt.Errorf("failed to write decision log: %w", err)
 	}
+	return nil
 }
 
-func daemonStart(args []string, pidFile, logFile string) {
-	opts := parseDaemonFlags(args)
+func daemonStart(args []string, opts daemonOpts, st statePaths) {
+	isChild := os.Getenv(daemonChildEnv) == "1"
+	pidFile, logFile := st.PIDFile, st.LogFile
+
+	if err := os.MkdirAll(st.Dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot create state dir: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Check if daemon is already running
 	if pidData, err := os.ReadFile(pidFile); err == nil {
@@ -1554,19 +1891,22 @@ func daemonStart(args []string, pidFile, logFile string) {
 		}
 	}
 
+	// Detach unless asked to stay in the foreground (or already the detached child)
+	if !opts.foreground && !isChild {
+		spawnDetachedDaemon(args, pidFile, logFile)
+		return
+	}
+
 	repoRoot, err := os.Getwd()
 	must(err)
 
-	// Load configuration
-	cfg, err := LoadConfig(opts.configFile)
+	// Load configuration, apply flag overrides and resolve the compose project
+	cfg, project, err := loadDaemonConfig(opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Normalize config to multi-service format
-	cfg.Normalize()
-
 	// Track which config was loaded for logging
 	configSource := "built-in defaults"
 	if opts.configFile != "" {
@@ -1576,36 +1916,9 @@ func daemonStart(args []string, pidFile, logFile string) {
 	} else if _, err := os.Stat("docktor.yml"); err == nil {
 		configSource = "docktor.yml (auto-discovered)"
 	}
+	composeFile := strings.Join(project.Files, ", ")
 
-	// Command-line flags override config
-	if opts.composeFile != "examples/docker-compose.yaml" {
-		cfg.ComposeFile = opts.composeFile
-	}
-	if opts.service != "web" {
-		// Override first service name for backward compatibility
-		if len(cfg.Services) > 0 {
-			cfg.Services[0].Name = opts.service
-		}
-	}
-	if opts.checkInterval > 0 {
-		// Override check interval for all services
-		for i := range cfg.Services {
-			cfg.Services[i].CheckInterval = opts.checkInterval
-		}
-	}
-
-	// Resolve compose file path (support both relative and absolute paths)
-	composeFile := cfg.ComposeFile
-	if !filepath.IsAbs(composeFile) {
-		composeFile = filepath.Join(repoRoot, composeFile)
-	}
-
-	if !fileExists(composeFile) {
-		fmt.Fprintf(os.Stderr, "Error: Compose file not found: %s\n", composeFile)
-		os.Exit(1)
-	}
-
-	envFile := filepath.Join(repoRoot, ".env.cagent")
+	envFile := st.EnvFile
 	agentDMR := filepath.Join(repoRoot, "agents", "docktor.dmr.yaml")
 	agentCloud := filepath.Join(repoRoot, "agents", "docktor.cloud.yaml")
 
@@ -1617,81 +1930,143 @@ func daemonStart(args []string, pidFile, logFile string) {
 		os.Exit(1)
 	}
 
-	// Start compose stack with configured min_replicas for all services
-	fmt.Printf("Starting Docker Compose stack (%s)...\n", composeFile)
-	scaleArgs := []string{"compose", "-f", composeFile, "up", "-d"}
-	for _, svc := range cfg.Services {
-		scaleArgs = append(scaleArgs, "--scale", fmt.Sprintf("%s=%d", svc.Name, svc.MinReplicas))
+	// Elect a leader among the daemons of this project. A dry-run daemon never
+	// scales, so it does not take part.
+	var elector leader.Elector
+	leading := true
+	if !opts.dryRun && cfg.Leader.Kind != "none" {
+		elector, err = newElector(cfg.Leader, project.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: leader election: %v\n", err)
+			os.Exit(1)
+		}
+		leading, err = elector.Acquire()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: leader election: %v\n", err)
+			os.Exit(1)
+		}
+		if !leading {
+			holder := "another daemon"
+			if lease, _ := elector.Current(); lease != nil {
+				holder = lease.Holder
+			}
+			fmt.Printf("⚠ %s leads project %s; starting as follower (shadow mode until it goes away)\n", holder, project.Name)
+		}
 	}
-	must(run("docker", scaleArgs...))
 
-	// Configure LLM based on config
-	var agentFile string
-	apiKey := ""
+	// Startup failures give up the lease for the next daemon
+	releaseLease := func() {
+		if elector != nil {
+			if leading {
+				_ = elector.Release()
+			}
+			elector.Close()
+		}
+	}
 
-	switch cfg.LLM.Provider {
-	case "dmr":
-		// Docker Model Runner - use DMR agent with dummy API key
-		agentFile = agentDMR
-		apiKey = "dummy"
-
-		// Verify DMR is reachable
-		if !probeURL(cfg.LLM.BaseURL + "/models") {
-			fmt.Fprintf(os.Stderr, "\n❌ Error: Cannot connect to Docker Model Runner at %s\n\n", cfg.LLM.BaseURL)
-			fmt.Fprintln(os.Stderr, "Please ensure:")
-			fmt.Fprintln(os.Stderr, "  1. Docker Desktop is running")
-			fmt.Fprintln(os.Stderr, "  2. Model Runner is enabled (Settings → Features in development)")
-			fmt.Fprintln(os.Stderr, "  3. At least one model is pulled\n")
-			_ = run("docker", "compose", "-f", composeFile, "down")
+	// Start compose stack with configured min_replicas for all services.
+	// --no-recreate keeps containers whose config drifted instead of restarting them.
+	// A dry-run daemon or a follower must not touch anything, so it only observes the running stack.
+	if opts.dryRun || !leading {
+		fmt.Printf("Dry-run: not starting compose stack (%s)\n", composeFile)
+	} else {
+		fmt.Printf("Starting Docker Compose stack (%s)...\n", composeFile)
+		scaleArgs := append(project.Args(), "up", "-d", "--no-recreate")
+		for _, svc := range cfg.Services {
+			if svc.Shadow() {
+				continue
+			}
+			replicas, source := startupReplicas(project, svc, st.Services)
+			fmt.Printf("  %s: %d replicas (%s)\n", svc.Name, replicas, source)
+			scaleArgs = append(scaleArgs, "--scale", fmt.Sprintf("%s=%d", svc.Name, replicas))
+		}
+		if err := run("docker", scaleArgs...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			releaseLease()
 			os.Exit(1)
 		}
+	}
 
-		fmt.Printf("▶ Using Docker Model Runner: %s\n", cfg.LLM.Model)
+	// Configure LLM based on config: Docker Model Runner has its own agent, every other
+	// provider uses the cloud agent
+	agentFile := agentCloud
+	if cfg.LLM.Provider == "dmr" {
+		agentFile = agentDMR
+	}
+	provider := cfg.LLM.provider()
+	// Only the leader started the stack, so only it takes the stack down again
+	stopCompose := func() {
+		if !opts.dryRun && leading {
+			_ = run("docker", append(project.Args(), "down")...)
+		}
+		releaseLease()
+	}
 
-	case "openai":
-		// OpenAI-compatible provider - use cloud agent
-		agentFile = agentCloud
+	apiKey, err := llmAPIKey(cfg.LLM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\n❌ Error: %v\n\n", err)
+		fmt.Fprintln(os.Stderr, "Configure the key in docktor.yaml, e.g.:")
+		fmt.Fprintln(os.Stderr, "  llm:")
+		fmt.Fprintf(os.Stderr, "    api_key_env: %s\n", cfg.LLM.keySource().Env)
+		fmt.Fprintln(os.Stderr, "    # or api_key_file: ~/.config/docktor/api-key")
+		fmt.Fprintln(os.Stderr, "    # or api_key_command: \"pass show docktor/llm\"")
+		fmt.Fprintln(os.Stderr, "\nOr use Docker Model Runner:")
+		fmt.Fprintf(os.Stderr, "  docktor config set-model <MODEL> --provider=dmr\n\n")
+		stopCompose()
+		os.Exit(1)
+	}
 
-		// Check for API key
-		apiKey = os.Getenv("OPENAI_API_KEY")
-		if apiKey == "" {
-			fmt.Fprintln(os.Stderr, "\n❌ Error: OPENAI_API_KEY environment variable not set\n")
-			fmt.Fprintln(os.Stderr, "For OpenAI provider, you must set:")
-			fmt.Fprintln(os.Stderr, "  export OPENAI_API_KEY=sk-...")
-			fmt.Fprintln(os.Stderr, "\nOr use Docker Model Runner:")
-			fmt.Fprintln(os.Stderr, "  docktor config set-model <MODEL> --provider=dmr\n")
-			_ = run("docker", "compose", "-f", composeFile, "down")
+	if provider.Local {
+		// Verify the local model server is reachable
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		client, err := newLLMClient(cfg.LLM)
+		if err == nil {
+			_, err = client.Models(ctx)
+		}
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\n❌ Error: Cannot connect to %s at %s: %v\n\n", provider.Title, cfg.LLM.baseURL(), err)
+			if cfg.LLM.Provider == "dmr" {
+				fmt.Fprintln(os.Stderr, "Please ensure:")
+				fmt.Fprintln(os.Stderr, "  1. Docker Desktop is running")
+				fmt.Fprintln(os.Stderr, "  2. Model Runner is enabled (Settings → Features in development)")
+				fmt.Fprintf(os.Stderr, "  3. At least one model is pulled\n\n")
+			}
+			stopCompose()
 			os.Exit(1)
 		}
-
-		fmt.Printf("▶ Using OpenAI-compatible provider: %s\n", cfg.LLM.Model)
-
-	default:
-		fmt.Fprintf(os.Stderr, "Error: Unknown LLM provider '%s' (must be 'dmr' or 'openai')\n", cfg.LLM.Provider)
-		os.Exit(1)
 	}
 
+	fmt.Printf("▶ Using %s: %s\n", provider.Title, cfg.LLM.Model)
+
 	// Write .env.cagent with LLM config
-	envContent := fmt.Sprintf("OPENAI_BASE_URL=%s\nOPENAI_API_KEY=%s\nOPENAI_MODEL=%s\n",
-		cfg.LLM.BaseURL, apiKey, cfg.LLM.Model)
-	if err := os.WriteFile(envFile, []byte(envContent), 0644); err != nil {
+	if err := os.WriteFile(envFile, []byte(cagentEnv(cfg.LLM, apiKey)), 0600); err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing .env.cagent: %v\n", err)
+		releaseLease()
 		os.Exit(1)
 	}
 
 	// Generate runtime agent config with substituted values
-	runtimeAgentFile := filepath.Join(repoRoot, ".docktor-agent-runtime.yaml")
+	runtimeAgentFile := st.AgentFile
 	if err := generateAgentConfig(agentFile, runtimeAgentFile, cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating agent config: %v\n", err)
+		releaseLease()
 		os.Exit(1)
 	}
 	agentFile = runtimeAgentFile
 
 	fmt.Println("\n=== Starting Docktor Daemon ===")
 	fmt.Printf("Mode: %s\n", map[bool]string{true: "MANUAL", false: "AUTONOMOUS"}[opts.manual])
+	if opts.dryRun {
+		fmt.Printf("  DRY-RUN: decisions are logged with dry_run=true, nothing is scaled\n")
+	}
+	if opts.manual {
+		fmt.Printf("  Proposals: %s (expire after %s)\n", st.Proposals, opts.approvalTTL)
+	}
 	fmt.Printf("Config: %s\n", configSource)
-	fmt.Printf("Compose: %s\n", composeFile)
+	fmt.Printf("Compose: %s (project %s)\n", composeFile, project.Name)
 	fmt.Printf("Agent: %s\n", filepath.Base(agentFile))
+	fmt.Printf("State: %s\n", st.Dir)
 	fmt.Printf("Log: %s\n", logFile)
 	fmt.Printf("\nLLM Config:\n")
 	fmt.Printf("  Provider: %s\n", cfg.LLM.Provider)
@@ -1703,36 +2078,82 @@ func daemonStart(args []string, pidFile, logFile string) {
 		if svc.Queue != nil {
 			fmt.Printf(", queue=%s", svc.Queue.Kind)
 		}
+		if svc.Shadow() {
+			fmt.Printf(", mode=shadow")
+		}
 		fmt.Println()
 	}
 	fmt.Println()
 
-	// Create log file
-	logFh, err := os.Create(logFile)
+	// Create log file (the detached child appends to the log its parent created)
+	logFlags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if isChild {
+		logFlags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	logFh, err := os.OpenFile(logFile, logFlags, 0644)
 	must(err)
 
-	// Set global DOCKTOR_COMPOSE_FILE for MCP tools
-	os.Setenv("DOCKTOR_COMPOSE_FILE", composeFile)
+	// Export the compose project selection and state dir for MCP tools
+	setComposeEnv(project)
+	os.Setenv(stateDirEnv, st.Base)
+	if path := configPath(opts); path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			os.Setenv(configEnv, abs)
+		}
+	}
 
 	// Write PID file
 	must(os.WriteFile(pidFile, []byte(fmt.Sprintf("%d", os.Getpid())), 0644))
 
-	fmt.Printf("✓ Daemon started successfully\n")
-	fmt.Printf("  PID: %d\n", os.Getpid())
-	fmt.Printf("  Logs: tail -f %s\n\n", logFile)
+	fmt.Printf("✓ Daemon running in the foreground (PID %d)\n", os.Getpid())
+	fmt.Printf("  Logs: tail -f %s\n", logFile)
+	fmt.Printf("  SIGTERM/SIGINT: graceful stop, SIGHUP or editing the config file: reload\n\n")
 
 	// Start multi-service monitoring
-	for _, svc := range cfg.Services {
-		go monitorService(svc, logFh, composeFile)
+	d := &daemon{
+		logFh:       logFh,
+		manual:      opts.manual,
+		dryRun:      opts.dryRun,
+		approvalTTL: opts.approvalTTL,
+		state:       st,
+		monitors:    map[string]*monitorHandle{},
+		startedAt:   time.Now(),
+		metrics:     newDaemonMetrics(),
+	}
+	d.project.Store(project)
+	d.config.Store(&cfg)
+	if !opts.dryRun {
+		d.metrics.leader.Set(map[bool]float64{true: 1, false: 0}[leading])
+	}
+	if elector != nil {
+		d.elector = elector
+		d.leading.Store(leading)
+		d.electionStop = make(chan struct{})
+		d.electionDone = make(chan struct{})
+		go func() {
+			defer close(d.electionDone)
+			d.runElection(cfg.Leader.leaseTTL(), d.electionStop)
+		}()
+	}
+	d.applyServices(cfg.Services)
+
+	if addr := cfg.Metrics.Listen; opts.metricsAddr != "" || addr != "" {
+		if opts.metricsAddr != "" {
+			addr = opts.metricsAddr
+		}
+		if err := d.startMetricsServer(addr); err != nil {
+			d.logf("WARNING: metrics endpoint disabled: %v", err)
+		}
 	}
 
-	fmt.Printf("Control:\n")
-	fmt.Printf("  docktor daemon status  # Check status\n")
-	fmt.Printf("  docktor daemon logs    # Follow logs\n")
-	fmt.Printf("  docktor daemon stop    # Stop daemon\n\n")
+	if addr := apiListenAddr(cfg.API, opts.apiAddr, st); addr != "" {
+		if err := d.startAPI(addr, cfg.API.Token); err != nil {
+			d.logf("WARNING: API disabled: %v", err)
+		}
+	}
 
-	// Block forever - the service monitors run in background
-	select {}
+	// Block until stopped; in-flight iterations finish before exit
+	d.runSignalLoop(opts, pidFile)
 }
 
 func daemonStop(pidFile string) {
@@ -1750,18 +2171,19 @@ func daemonStop(pidFile string) {
 	}
 
 	fmt.Printf("Stopping daemon (PID %s)...\n", pid)
-	cmd := exec.Command("kill", pid)
+	cmd := exec.Command("kill", "-TERM", pid)
 	if err := cmd.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to stop daemon: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Wait for process to exit
-	for i := 0; i < 30; i++ {
+	// Wait for in-flight iterations (metrics window + scale command) to finish
+	deadline := time.Now().Add(shutdownTimeout + 10*time.Second)
+	for time.Now().Before(deadline) {
 		if !checkProcess(pid) {
 			break
 		}
-		time.Sleep(100 * time.Millisecond)
+		time.Sleep(200 * time.Millisecond)
 	}
 
 	// Force kill if still running
@@ -1775,7 +2197,8 @@ func daemonStop(pidFile string) {
 	fmt.Println("✓ Daemon stopped")
 }
 
-func daemonStatus(pidFile, logFile string) {
+func daemonStatus(st statePaths, apiToken string) {
+	pidFile, logFile := st.PIDFile, st.LogFile
 	pidData, err := os.ReadFile(pidFile)
 	if err != nil {
 		fmt.Println("Status: NOT RUNNING")
@@ -1791,6 +2214,13 @@ func daemonStatus(pidFile, logFile string) {
 	fmt.Printf("Status: RUNNING\n")
 	fmt.Printf("  PID: %s\n", pid)
 	fmt.Printf("  Log: %s\n", logFile)
+
+	// Prefer the live view from the daemon API; fall back to the log
+	if info, err := fetchAPIStatus(st, apiToken); err == nil {
+		printAPIStatus(info)
+		return
+	}
+
 	fmt.Println("\nRecent log entries:")
 	exec.Command("tail", "-20", logFile).Run()
 }
@@ -1806,6 +2236,12 @@ func daemonLogs(logFile string) {
 	must(cmd.Run())
 }
 
+// daemonRunning reports whether the PID file names a live daemon process
+func daemonRunning(st statePaths) bool {
+	pidData, err := os.ReadFile(st.PIDFile)
+	return err == nil && checkProcess(strings.TrimSpace(string(pidData)))
+}
+
 func checkProcess(pid string) bool {
 	cmd := exec.Command("kill", "-0", pid)
 	return cmd.Run() == nil
@@ -1871,33 +2307,55 @@ func installCagent() {
 	_ = run("brew", "install", "cagent")
 }
 
-// configListModels lists available models from DMR
+// configListModels lists the models of the configured provider
 func configListModels() {
-	cfg, _ := LoadConfig("")
+	cfg, err := LoadConfig("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	provider := cfg.LLM.provider()
 
-	fmt.Println("🔍 Discovering models from Docker Model Runner...")
-	fmt.Printf("   Base URL: %s\n\n", cfg.LLM.BaseURL)
+	fmt.Printf("🔍 Discovering models from %s...\n", provider.Title)
+	fmt.Printf("   Base URL: %s\n\n", cfg.LLM.baseURL())
 
-	// Try to fetch models from DMR
-	models, err := fetchDMRModels(cfg.LLM.BaseURL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := newLLMClient(cfg.LLM)
+	var models []string
+	if err == nil {
+		models, err = client.Models(ctx)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "❌ Unable to connect to Docker Model Runner\n\n")
+		fmt.Fprintf(os.Stderr, "❌ Unable to list the models of %s\n\n", provider.Title)
 		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
-		fmt.Fprintf(os.Stderr, "Please ensure:\n")
-		fmt.Fprintf(os.Stderr, "  1. Docker Desktop is running\n")
-		fmt.Fprintf(os.Stderr, "  2. Model Runner is enabled in Docker Desktop settings\n")
-		fmt.Fprintf(os.Stderr, "  3. At least one model is pulled/running\n\n")
-		fmt.Fprintf(os.Stderr, "To enable Model Runner:\n")
-		fmt.Fprintf(os.Stderr, "  → Open Docker Desktop\n")
-		fmt.Fprintf(os.Stderr, "  → Go to Settings → Features in development\n")
-		fmt.Fprintf(os.Stderr, "  → Enable 'Docker Model Runner'\n")
+		switch cfg.LLM.Provider {
+		case "dmr":
+			fmt.Fprintf(os.Stderr, "Please ensure:\n")
+			fmt.Fprintf(os.Stderr, "  1. Docker Desktop is running\n")
+			fmt.Fprintf(os.Stderr, "  2. Model Runner is enabled in Docker Desktop settings\n")
+			fmt.Fprintf(os.Stderr, "  3. At least one model is pulled/running\n\n")
+			fmt.Fprintf(os.Stderr, "To enable Model Runner:\n")
+			fmt.Fprintf(os.Stderr, "  → Open Docker Desktop\n")
+			fmt.Fprintf(os.Stderr, "  → Go to Settings → Features in development\n")
+			fmt.Fprintf(os.Stderr, "  → Enable 'Docker Model Runner'\n")
+		case "ollama":
+			fmt.Fprintf(os.Stderr, "Please ensure Ollama is running ('ollama serve') at %s\n", cfg.LLM.baseURL())
+		}
 		os.Exit(1)
 	}
+	sort.Strings(models)
 
 	if len(models) == 0 {
 		fmt.Println("⚠️  No models found")
-		fmt.Println("\nTip: Pull a model first, e.g.:")
-		fmt.Println("  docker model pull granite-4.0-1b")
+		switch cfg.LLM.Provider {
+		case "dmr":
+			fmt.Println("\nTip: Pull a model first, e.g.:")
+			fmt.Println("  docker model pull granite-4.0-1b")
+		case "ollama":
+			fmt.Println("\nTip: Pull a model first, e.g.:")
+			fmt.Println("  ollama pull llama3.2")
+		}
 		return
 	}
 
@@ -1921,34 +2379,60 @@ func configSetModel(args []string) {
 	// Parse optional flags
 	provider := ""
 	baseURL := ""
+	var keyEnv, keyFile, keyCommand *string
 
 	for _, arg := range args[1:] {
 		if strings.HasPrefix(arg, "--provider=") {
 			provider = strings.TrimPrefix(arg, "--provider=")
 		} else if strings.HasPrefix(arg, "--base-url=") {
 			baseURL = strings.TrimPrefix(arg, "--base-url=")
+		} else if v, ok := strings.CutPrefix(arg, "--api-key-env="); ok {
+			keyEnv = &v
+		} else if v, ok := strings.CutPrefix(arg, "--api-key-file="); ok {
+			keyFile = &v
+		} else if v, ok := strings.CutPrefix(arg, "--api-key-command="); ok {
+			keyCommand = &v
 		}
 	}
 
-	// Load or create config
+	// Load or create config; the file is read as written so saving it only changes the llm keys
 	configPath := "docktor.yaml"
-	cfg, err := LoadConfig(configPath)
-	if err != nil {
+	cfg := Config{LLM: DefaultConfig().LLM}
+	if err := readConfigFile(configPath, &cfg); err != nil {
 		cfg = DefaultConfig()
 	}
 
-	// Update LLM config
-	if provider != "" {
+	// Update LLM config; a new provider starts from its own base URL
+	if provider != "" && provider != cfg.LLM.Provider {
 		cfg.LLM.Provider = provider
+		cfg.LLM.BaseURL = ""
 	}
 	if baseURL != "" {
 		cfg.LLM.BaseURL = baseURL
 	}
 	cfg.LLM.Model = modelID
+	// Setting one API key source replaces the others
+	if keyEnv != nil || keyFile != nil || keyCommand != nil {
+		cfg.LLM.APIKeyEnv, cfg.LLM.APIKeyFile, cfg.LLM.APIKeyCommand = "", "", ""
+		for _, set := range []struct{ flag, field *string }{{keyEnv, &cfg.LLM.APIKeyEnv}, {keyFile, &cfg.LLM.APIKeyFile}, {keyCommand, &cfg.LLM.APIKeyCommand}} {
+			if set.flag != nil {
+				*set.field = *set.flag
+			}
+		}
+	}
 
 	// Validate provider
-	if cfg.LLM.Provider != "dmr" && cfg.LLM.Provider != "openai" {
-		fmt.Fprintf(os.Stderr, "Error: provider must be 'dmr' or 'openai', got '%s'\n", cfg.LLM.Provider)
+	p, ok := llm.Lookup(cfg.LLM.Provider)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: provider must be one of %s, got '%s'\n", strings.Join(llm.Providers(), ", "), cfg.LLM.Provider)
+		os.Exit(1)
+	}
+	if p.KeyExplicit && cfg.LLM.APIKeyEnv == "" && cfg.LLM.APIKeyFile == "" && cfg.LLM.APIKeyCommand == "" {
+		fmt.Fprintf(os.Stderr, "Error: provider %s needs --api-key-env, --api-key-file or --api-key-command\n", cfg.LLM.Provider)
+		os.Exit(1)
+	}
+	if cfg.LLM.baseURL() == "" {
+		fmt.Fprintf(os.Stderr, "Error: provider %s needs --base-url=<URL>\n", cfg.LLM.Provider)
 		os.Exit(1)
 	}
 
@@ -1961,8 +2445,9 @@ func configSetModel(args []string) {
 	fmt.Println("✓ Model configuration updated")
 	fmt.Println()
 	fmt.Printf("  Provider:  %s\n", cfg.LLM.Provider)
-	fmt.Printf("  Base URL:  %s\n", cfg.LLM.BaseURL)
+	fmt.Printf("  Base URL:  %s\n", cfg.LLM.baseURL())
 	fmt.Printf("  Model:     %s\n", cfg.LLM.Model)
+	fmt.Printf("  API key:   %s\n", cfg.LLM.keySource())
 	fmt.Println()
 	fmt.Printf("Saved to: %s\n", configPath)
 }
@@ -1977,35 +2462,64 @@ func configValidate() {
 
 	cfg.Normalize()
 
-	fmt.Println("Validating Docktor configuration...\n")
+	fmt.Printf("Validating Docktor configuration...\n\n")
 
 	allValid := true
 
-	// 1. Check compose file exists
-	composeFile := cfg.ComposeFile
-	if !filepath.IsAbs(composeFile) {
-		wd, _ := os.Getwd()
-		composeFile = filepath.Join(wd, composeFile)
+	// 1. Parse the compose project (all -f files, extends, profiles, .env interpolation)
+	project, err := compose.Load(cfg.ComposeOptions())
+	if err != nil {
+		fmt.Printf("✗ Cannot load compose project: %v\n", err)
+		allValid = false
+	} else {
+		for _, f := range project.Files {
+			fmt.Printf("✓ Compose file parsed: %s\n", f)
+		}
+		fmt.Printf("✓ Project: %s (%d services", project.Name, len(project.Services))
+		if len(project.Profiles) > 0 {
+			fmt.Printf(", profiles: %s", strings.Join(project.Profiles, ","))
+		}
+		fmt.Println(")")
 	}
 
-	if fileExists(composeFile) {
-		fmt.Printf("✓ Compose file exists: %s\n", composeFile)
-	} else {
-		fmt.Printf("✗ Compose file not found: %s\n", composeFile)
-		allValid = false
+	// Containers of the project, discovered by compose labels
+	var containers []compose.Container
+	if project != nil {
+		containers, err = compose.ListContainers(project.Name, nil)
+		if err != nil {
+			fmt.Printf("⚠ Cannot list project containers: %v\n", err)
+		}
 	}
 
 	// 2. Check each service
 	for _, svc := range cfg.Services {
 		fmt.Printf("\n[Service: %s]\n", svc.Name)
 
-		// Check service exists in compose file (basic check - just grep for service name)
-		if fileExists(composeFile) {
-			content, _ := os.ReadFile(composeFile)
-			if strings.Contains(string(content), svc.Name+":") {
-				fmt.Printf("  ✓ Service '%s' found in compose file\n", svc.Name)
+		if project != nil {
+			if composeSvc, ok := project.Services[svc.Name]; ok {
+				fmt.Printf("  ✓ Service '%s' found in compose project\n", svc.Name)
+
+				// Fixed container names and host ports allow only a single replica
+				if blockers := composeSvc.ScalingBlockers(); len(blockers) > 0 && svc.MaxReplicas > 1 {
+					for _, b := range blockers {
+						fmt.Printf("  ✗ Cannot scale beyond 1 replica: %s\n", b)
+					}
+					allValid = false
+				}
+
+				if containers != nil {
+					if running, err := selectServiceContainers(project, svc); err == nil {
+						fmt.Printf("  ✓ Running containers: %d (selected by labels)\n", len(running))
+						if len(svc.Selector) > 0 {
+							fmt.Printf("  ✓ Metrics read from %d of them (selector)\n", len(metricContainers(running, svc)))
+						}
+					}
+				}
+			} else if inactive, ok := project.Inactive[svc.Name]; ok {
+				fmt.Printf("  ✗ Service '%s' is disabled (requires profile: %s)\n", svc.Name, strings.Join(inactive.Profiles, ", "))
+				allValid = false
 			} else {
-				fmt.Printf("  ✗ Service '%s' not found in compose file\n", svc.Name)
+				fmt.Printf("  ✗ Service '%s' not found in compose project\n", svc.Name)
 				allValid = false
 			}
 		}
@@ -2018,47 +2532,39 @@ func configValidate() {
 			allValid = false
 		}
 
-		// Check queue configuration if present
-		if svc.Queue != nil {
-			fmt.Printf("  [Queue: %s]\n", svc.Queue.Kind)
-
-			// Try to connect to queue
-			queueCfg := queue.Config{
-				Kind: svc.Queue.Kind,
-				URL:  svc.Queue.URL,
-				Attributes: map[string]string{
-					"stream":    svc.Queue.Stream,
-					"consumer":  svc.Queue.Consumer,
-					"subject":   svc.Queue.Subject,
-					"jetstream": fmt.Sprintf("%t", svc.Queue.JetStream),
-				},
-			}
-
-			provider, err := queue.NewProvider(queueCfg)
-			if err != nil {
-				fmt.Printf("    ✗ Queue provider error: %v\n", err)
-				allValid = false
-				continue
+		// Collect every metric source once over a short window
+		if sources, err := source.NewSet(svc.metricSources()); err != nil {
+			fmt.Printf("  ✗ Metric sources: %v\n", err)
+			allValid = false
+		} else {
+			target := source.Target{Service: svc.Name}
+			if project != nil {
+				target.Project = project.Name
+				if running, err := selectServiceContainers(project, svc); err == nil {
+					target.Containers = metricContainers(running, svc)
+				}
 			}
-
-			if err := provider.Connect(); err != nil {
-				fmt.Printf("    ✗ Cannot connect to queue: %v\n", err)
-				allValid = false
-			} else {
-				fmt.Printf("    ✓ Queue reachable: %s\n", svc.Queue.URL)
-
-				// Try to get metrics
-				metrics, err := provider.GetMetrics(5)
-				if err != nil {
-					fmt.Printf("    ✗ Cannot get queue metrics: %v\n", err)
-					allValid = false
-				} else {
-					fmt.Printf("    ✓ Stream '%s' accessible\n", svc.Queue.Stream)
-					fmt.Printf("    ✓ Consumer '%s' accessible (backlog: %.0f)\n", svc.Queue.Consumer, metrics.Backlog)
+			obs, errs := sources.Collect(context.Background(), target, 2*time.Second)
+			for _, src := range sources.Configs() {
+				fmt.Printf("  [Source: %s (%s)]\n", src.Namespace, src.Kind)
+				for _, e := range errs {
+					if e.Source.Namespace == src.Namespace {
+						fmt.Printf("    ✗ %v\n", e.Err)
+						allValid = false
+					}
+				}
+				names := make([]string, 0, len(obs))
+				for name := range obs {
+					if strings.HasPrefix(name, src.Namespace+".") {
+						names = append(names, name)
+					}
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Printf("    ✓ %s = %g\n", name, obs[name])
 				}
 			}
-
-			provider.Close()
+			sources.Close()
 		}
 
 		// Check rules configuration
@@ -2068,6 +2574,22 @@ func configValidate() {
 		if len(svc.Rules.ScaleDownWhen) > 0 {
 			fmt.Printf("  ✓ Scale-down rules: %d conditions (AND logic)\n", len(svc.Rules.ScaleDownWhen))
 		}
+		if svc.Prometheus != nil {
+			for _, conds := range [][]Condition{svc.Rules.ScaleUpWhen, svc.Rules.ScaleDownWhen} {
+				for _, cond := range conds {
+					if svc.Prometheus.rawCounterMetric(cond.Metric) {
+						fmt.Printf("  ✗ Rule on %s: scraped counters are observed as rates, use %s_per_sec\n", cond.Metric, cond.Metric)
+						allValid = false
+					}
+				}
+			}
+		}
+		switch svc.decisionMode() {
+		case decisionLLM:
+			fmt.Printf("  ✓ Decision mode: llm (model %s at %s, rules as guardrail)\n", cfg.LLM.Model, cfg.LLM.BaseURL)
+		case decisionLLMAdvisory:
+			fmt.Printf("  ✓ Decision mode: llm_advisory (model %s at %s, rules decide)\n", cfg.LLM.Model, cfg.LLM.BaseURL)
+		}
 	}
 
 	fmt.Println()
@@ -2078,49 +2600,3 @@ func configValidate() {
 		os.Exit(1)
 	}
 }
-
-// fetchDMRModels fetches available models from Docker Model Runner
-func fetchDMRModels(baseURL string) ([]string, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-
-	resp, err := client.Get(baseURL + "/models")
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("DMR returned status %d", resp.StatusCode)
-	}
-
-	var result struct {
-		Data []struct {
-			ID string `json:"id"`
-		} `json:"data"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-
-	models := make([]string, len(result.Data))
-	for i, m := range result.Data {
-		models[i] = m.ID
-	}
-
-	return models, nil
-}
-
-// SaveConfig saves configuration to YAML file
-func SaveConfig(path string, cfg Config) error {
-	data, err := yaml.Marshal(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
-	}
-
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	mcpSessionHeader   = "Mcp-Session-Id"
+	mcpVersionHeader   = "Mcp-Protocol-Version"
+	mcpSessionTTL      = time.Hour        // Sessions idle for longer are dropped
+	mcpSweepPeriod     = time.Minute      // How often idle sessions are looked for
+	mcpMaxSessions     = 256              // The least recently used session is dropped beyond this
+	mcpMaxRequestBody  = 4 << 20          // Bytes accepted per POST
+	mcpKeepAlivePeriod = 15 * time.Second // Comment lines keeping idle SSE streams open
+)
+
+// mcpSession is one client of the streamable HTTP transport
+type mcpSession struct {
+	id       string
+	conn     *mcpConn
+	lastSeen time.Time
+	events   chan interface{} // Server-initiated messages, delivered on the GET stream
+	streams  atomic.Int32     // Open GET streams
+	closed   chan struct{}
+}
+
+// write queues a notification for the session's GET stream. Progress of requests answered
+// with plain JSON and other notifications have no other way to the client. Without an
+// open stream, or when it falls behind, the message is dropped.
+func (s *mcpSession) write(msg interface{}) error {
+	if s.streams.Load() == 0 {
+		return nil
+	}
+	select {
+	case s.events <- msg:
+	default:
+	}
+	return nil
+}
+
+// mcpHTTPServer serves the MCP tools over the streamable HTTP transport: clients POST
+// JSON-RPC messages to /mcp and get the response as JSON or as an SSE stream
+type mcpHTTPServer struct {
+	token string
+
+	mu       sync.Mutex
+	sessions map[string]*mcpSession
+}
+
+// serveMCPHTTP listens on addr and serves /mcp until the process exits. Without a token
+// it only serves on loopback addresses unless insecure is set: the tools scale services
+// and collect metrics on this host.
+func serveMCPHTTP(addr, token string, insecure bool) error {
+	s := &mcpHTTPServer{token: token, sessions: map[string]*mcpSession{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /mcp", s.post)
+	mux.HandleFunc("GET /mcp", s.stream)
+	mux.HandleFunc("DELETE /mcp", s.close)
+
+	go s.sweep()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", addr, err)
+	}
+	if token == "" {
+		if host, _, _ := net.SplitHostPort(l.Addr().String()); !net.ParseIP(host).IsLoopback() {
+			if !insecure {
+				l.Close()
+				return fmt.Errorf("MCP server on %s needs a token: set --token or DOCKTOR_MCP_TOKEN, or pass --insecure", l.Addr())
+			}
+			log.Printf("⚠ MCP server on %s has no token (--insecure)", l.Addr())
+		}
+	}
+	log.Printf("MCP streamable HTTP on http://%s/mcp", l.Addr())
+
+	srv := &http.Server{Handler: s.guard(mux), ReadHeaderTimeout: 10 * time.Second}
+	return srv.Serve(l)
+}
+
+// guard checks the bearer token and rejects cross-origin browser requests (DNS rebinding)
+func (s *mcpHTTPServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		if s.token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// session returns the session named by the request header, answering with an error if there is none
+func (s *mcpHTTPServer) session(w http.ResponseWriter, r *http.Request) (*mcpSession, bool) {
+	id := r.Header.Get(mcpSessionHeader)
+	if id == "" {
+		http.Error(w, "missing "+mcpSessionHeader+" header", http.StatusBadRequest)
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	sess, ok := s.sessions[id]
+	if ok && now.Sub(sess.lastSeen) > mcpSessionTTL {
+		s.drop(sess)
+		ok = false
+	}
+	if !ok {
+		// Tells the client to start over with a new initialize request
+		http.Error(w, "unknown or expired session", http.StatusNotFound)
+		return nil, false
+	}
+	sess.lastSeen = now
+	return sess, true
+}
+
+// newSession registers a session for an initialize request
+func (s *mcpHTTPServer) newSession() *mcpSession {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	sess := &mcpSession{
+		id:       hex.EncodeToString(b),
+		conn:     newMCPConn(),
+		lastSeen: time.Now(),
+		events:   make(chan interface{}, 16),
+		closed:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	if len(s.sessions) >= mcpMaxSessions {
+		var oldest *mcpSession
+		for _, other := range s.sessions {
+			if oldest == nil || other.lastSeen.Before(oldest.lastSeen) {
+				oldest = other
+			}
+		}
+		s.drop(oldest)
+	}
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+	return sess
+}
+
+// sweep drops idle sessions periodically, as clients often go away without a DELETE
+func (s *mcpHTTPServer) sweep() {
+	for range time.Tick(mcpSweepPeriod) {
+		s.mu.Lock()
+		now := time.Now()
+		for _, sess := range s.sessions {
+			if now.Sub(sess.lastSeen) > mcpSessionTTL {
+				s.drop(sess)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// drop ends a session; s.mu must be held
+func (s *mcpHTTPServer) drop(sess *mcpSession) {
+	delete(s.sessions, sess.id)
+	close(sess.closed)
+}
+
+// post handles a JSON-RPC message or batch sent by a client
+func (s *mcpHTTPServer) post(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, mcpMaxRequestBody+1))
+	if err != nil || len(body) > mcpMaxRequestBody {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	info, ok := inspectMCPBody(body)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(rpcRes{Jsonrpc: "2.0", ID: json.RawMessage("null"), Error: &rpcErr{Code: -32700, Message: "parse error"}})
+		return
+	}
+
+	var sess *mcpSession
+	if info.initialize {
+		sess = s.newSession()
+		w.Header().Set(mcpSessionHeader, sess.id)
+		log.Printf("MCP session %s started from %s", sess.id, r.RemoteAddr)
+	} else {
+		// Clients send the negotiated version on every request after initialize
+		if v := r.Header.Get(mcpVersionHeader); v != "" && !supportedProtocolVersion(v) {
+			http.Error(w, "unsupported "+mcpVersionHeader+": "+v, http.StatusBadRequest)
+			return
+		}
+		if sess, ok = s.session(w, r); !ok {
+			return
+		}
+	}
+
+	// Notifications and responses from the client get no reply
+	if !info.requests {
+		sess.conn.serve(r.Context(), sess, body)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// Stream as SSE if the client only takes SSE, or wants progress and can take SSE
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/event-stream") && (!strings.Contains(accept, "application/json") || info.progress) {
+		sw := newSSEWriter(w)
+		sess.conn.serve(r.Context(), sw, body)
+		return
+	}
+
+	// Notifications (e.g. progress) cannot go into a JSON response: they use the GET stream
+	col := &responseCollector{forward: sess}
+	sess.conn.serve(r.Context(), col, body)
+	if len(col.msgs) == 0 {
+		w.WriteHeader(http.StatusAccepted) // Cancelled while running
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(col.msgs[len(col.msgs)-1], '\n'))
+}
+
+// mcpBodyInfo summarizes what a POST body contains
+type mcpBodyInfo struct {
+	initialize bool // A single initialize request
+	requests   bool // At least one request that needs a response
+	progress   bool // A request asked for progress notifications
+}
+
+// inspectMCPBody reads the message or batch of a POST; ok is false if it is not JSON-RPC
+func inspectMCPBody(body []byte) (info mcpBodyInfo, ok bool) {
+	type message struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Meta struct {
+				ProgressToken json.RawMessage `json:"progressToken"`
+			} `json:"_meta"`
+		} `json:"params"`
+	}
+	var msgs []message
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &msgs); err != nil {
+			return info, false
+		}
+		if len(msgs) == 0 {
+			info.requests = true // Answered with an invalid request error
+		}
+	} else {
+		var m message
+		if err := json.Unmarshal(trimmed, &m); err != nil {
+			return info, false
+		}
+		msgs = []message{m}
+		info.initialize = m.Method == "initialize"
+	}
+	for _, m := range msgs {
+		if len(m.ID) > 0 && m.Method != "" {
+			info.requests = true
+			info.progress = info.progress || len(m.Params.Meta.ProgressToken) > 0
+		}
+	}
+	return info, true
+}
+
+// stream holds a GET request open as an SSE stream for server-initiated messages
+func (s *mcpHTTPServer) stream(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "GET requires Accept: text/event-stream", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	sw := newSSEWriter(w)
+	sw.flush()
+	sess.streams.Add(1)
+	defer sess.streams.Add(-1)
+
+	keepAlive := time.NewTicker(mcpKeepAlivePeriod)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sess.closed:
+			return
+		case msg := <-sess.events:
+			if sw.write(msg) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if sw.comment("keep-alive") != nil {
+				return
+			}
+			// An open stream keeps the session alive
+			s.mu.Lock()
+			sess.lastSeen = time.Now()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// close ends a session at the client's request
+func (s *mcpHTTPServer) close(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	if s.sessions[sess.id] == sess {
+		s.drop(sess)
+	}
+	s.mu.Unlock()
+	log.Printf("MCP session %s closed", sess.id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sseWriter writes each message as an SSE event
+type sseWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	return &sseWriter{w: w}
+}
+
+func (s *sseWriter) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: message\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *sseWriter) comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *sseWriter) flush() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMCPSessionNotificationsReachGETStream(t *testing.T) {
+	s := &mcpHTTPServer{sessions: map[string]*mcpSession{}}
+	srv := httptest.NewServer(http.HandlerFunc(s.stream))
+	defer srv.Close()
+	sess := s.newSession()
+
+	// Nothing is queued while no stream is open
+	_ = sess.write(rpcNotification{Jsonrpc: "2.0", Method: "notifications/progress"})
+	if len(sess.events) != 0 {
+		t.Fatalf("queued %d events without a stream", len(sess.events))
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(mcpSessionHeader, sess.id)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for deadline := time.Now().Add(2 * time.Second); sess.streams.Load() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("stream did not attach")
+		}
+	}
+
+	_ = sess.write(rpcNotification{Jsonrpc: "2.0", Method: "notifications/progress", Params: map[string]interface{}{"progress": 1}})
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			if !strings.Contains(data, `"notifications/progress"`) {
+				t.Errorf("got %s, want the progress notification", data)
+			}
+			return
+		}
+	}
+	t.Fatalf("stream ended without an event: %v", sc.Err())
+}
+
+func TestMCPSessionLimit(t *testing.T) {
+	s := &mcpHTTPServer{sessions: map[string]*mcpSession{}}
+	first := s.newSession()
+	first.lastSeen = time.Now().Add(-time.Minute)
+	for i := 0; i < mcpMaxSessions; i++ {
+		s.newSession()
+	}
+
+	if len(s.sessions) != mcpMaxSessions {
+		t.Errorf("%d sessions, want at most %d", len(s.sessions), mcpMaxSessions)
+	}
+	select {
+	case <-first.closed:
+	default:
+		t.Error("the least recently used session was not dropped")
+	}
+}
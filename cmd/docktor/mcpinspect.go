@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxHistoryLimit bounds how many decisions get_decision_history returns
+const maxHistoryLimit = 500
+
+// mcpInspectTools are read-only tools that let the agent ground its explanations in the
+// config, decision log and the daemon's latest observations
+func mcpInspectTools() []mcpTool {
+	serviceArg := objectSchema(schema{"service": schema{"type": "string"}}, "service")
+	return []mcpTool{
+		{
+			Name:        "list_services",
+			Description: "List the services in docktor.yaml with their mode, bounds and whether the agent may scale them, plus live replicas when the daemon is running",
+			InputSchema: objectSchema(schema{}),
+			OutputSchema: objectSchema(schema{
+				"daemon_running": schema{"type": "boolean"},
+				"services":       schema{"type": "array", "items": schema{"type": "object"}},
+			}, "daemon_running", "services"),
+			call: func(ctx context.Context, _ json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				policy, err := loadMCPPolicy()
+				if err != nil {
+					return nil, err
+				}
+				info, apiErr := fetchAPIStatus(policy.st, policy.cfg.API.Token)
+				services := make([]map[string]interface{}, 0, len(policy.cfg.Services))
+				for _, svc := range policy.cfg.Services {
+					_, denied := policy.service(svc.Name)
+					entry := map[string]interface{}{
+						"name":         svc.Name,
+						"mode":         svcMode(svc),
+						"min_replicas": svc.MinReplicas,
+						"max_replicas": svc.MaxReplicas,
+						"cooldown_sec": svc.Cooldown,
+						"scalable":     denied == nil && !svc.Shadow(),
+					}
+					if apiErr == nil {
+						if i := slices.IndexFunc(info.Services, func(s serviceStatus) bool { return s.Name == svc.Name }); i >= 0 {
+							st := info.Services[i]
+							entry["mode"] = st.Mode
+							entry["current_replicas"] = st.CurrentReplicas
+							entry["paused"] = st.Paused
+							entry["cooldown_remaining_sec"] = st.CooldownRemaining
+						}
+					}
+					services = append(services, entry)
+				}
+				return map[string]interface{}{"daemon_running": apiErr == nil, "services": services}, nil
+			},
+		},
+		{
+			Name:        "get_service_config",
+			Description: "Return the configuration of a service from docktor.yaml: bounds, cooldown, mode, scaling rules and the metric sources in effect",
+			InputSchema: serviceArg,
+			OutputSchema: objectSchema(schema{
+				"service":  schema{"type": "string"},
+				"scalable": schema{"type": "boolean"},
+				"config":   schema{"type": "object"},
+				"sources":  schema{"type": "array", "items": schema{"type": "object"}},
+			}, "service", "scalable", "config", "sources"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				policy, svc, err := inspectService(args)
+				if err != nil {
+					return nil, err
+				}
+				config, err := yamlToMap(svc)
+				if err != nil {
+					return nil, err
+				}
+				sources := []map[string]interface{}{}
+				for _, src := range svc.metricSources() {
+					sources = append(sources, map[string]interface{}{"kind": src.Kind, "namespace": src.Namespace, "required": src.Required})
+				}
+				_, denied := policy.service(svc.Name)
+				return map[string]interface{}{
+					"service":  svc.Name,
+					"scalable": denied == nil && !svc.Shadow(),
+					"config":   config,
+					"sources":  sources,
+				}, nil
+			},
+		},
+		{
+			Name:        "get_decision_history",
+			Description: "Return past scaling decisions from the decision log, newest last. since is a duration (e.g. 30m) or an RFC 3339 time.",
+			InputSchema: objectSchema(schema{
+				"service": schema{"type": "string"},
+				"since":   schema{"type": "string"},
+				"limit":   schema{"type": "integer", "minimum": 1, "maximum": maxHistoryLimit},
+			}),
+			OutputSchema: objectSchema(schema{
+				"decisions": schema{"type": "array", "items": schema{"type": "object"}},
+				"total":     schema{"type": "integer"},
+			}, "decisions", "total"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in struct {
+					Service string `json:"service"`
+					Since   string `json:"since"`
+					Limit   int    `json:"limit"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				if in.Limit == 0 {
+					in.Limit = 20
+				}
+				var since time.Time
+				if in.Since != "" {
+					var err error
+					if since, err = parseSince(in.Since, time.Now()); err != nil {
+						return nil, err
+					}
+				}
+				policy, err := loadMCPPolicy()
+				if err != nil {
+					return nil, err
+				}
+
+				decisions, err := readDecisions(policy.st.Decisions, in.Service)
+				if err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+				if !since.IsZero() {
+					decisions = slices.DeleteFunc(decisions, func(d decisionRecord) bool { return d.Time().Before(since) })
+				}
+				total := len(decisions)
+				if len(decisions) > in.Limit {
+					decisions = decisions[len(decisions)-in.Limit:]
+				}
+				if decisions == nil {
+					decisions = []decisionRecord{}
+				}
+				return map[string]interface{}{"decisions": decisions, "total": total}, nil
+			},
+		},
+		{
+			Name:        "get_observations",
+			Description: "Return the latest observations the daemon collected for a service (no new sampling), with their age",
+			InputSchema: serviceArg,
+			OutputSchema: objectSchema(schema{
+				"service":      schema{"type": "string"},
+				"source":       schema{"type": "string", "enum": []string{"daemon", "saved state"}},
+				"time":         schema{"type": "string"},
+				"age_sec":      schema{"type": "number"},
+				"replicas":     schema{"type": "integer"},
+				"observations": numberMap,
+			}, "service", "source", "time", "age_sec", "replicas", "observations"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				policy, svc, err := inspectService(args)
+				if err != nil {
+					return nil, err
+				}
+				latest, err := policy.latestObservations(svc.Name)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{
+					"service":      svc.Name,
+					"source":       latest.source,
+					"time":         latest.Time.Format(time.RFC3339),
+					"age_sec":      time.Since(latest.Time).Round(time.Second).Seconds(),
+					"replicas":     latest.Replicas,
+					"observations": latest.Observations,
+				}, nil
+			},
+		},
+		{
+			Name: "simulate_rules",
+			Description: "Evaluate the configured rules of a service against observations (default: the latest collected ones) " +
+				"and return the decision the daemon would make, without scaling",
+			InputSchema: objectSchema(schema{
+				"service":          schema{"type": "string"},
+				"observations":     numberMap,
+				"current_replicas": replicasSchema,
+			}, "service"),
+			OutputSchema: decisionSchema,
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in struct {
+					Observations    map[string]float64 `json:"observations"`
+					CurrentReplicas *int               `json:"current_replicas"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				policy, svc, err := inspectService(args)
+				if err != nil {
+					return nil, err
+				}
+
+				current := svc.MinReplicas
+				observed := "given"
+				if in.Observations == nil || in.CurrentReplicas == nil {
+					latest, err := policy.latestObservations(svc.Name)
+					switch {
+					case err == nil:
+						current = latest.Replicas
+						if in.Observations == nil {
+							in.Observations, observed = latest.Observations, latest.source
+						}
+					case in.Observations == nil:
+						return nil, err
+					}
+				}
+				if in.CurrentReplicas != nil {
+					current = *in.CurrentReplicas
+				}
+
+				up, down := policy.cfg.Scaling.steps()
+				decision, err := toolDecideScaleMulti(svc.Name, current, svc.MinReplicas, svc.MaxReplicas, up, down, svc.Rules, in.Observations)
+				if err != nil {
+					return nil, err
+				}
+				decision["observations"] = in.Observations
+				decision["observations_source"] = observed
+				if remaining := policy.cooldownRemaining(svc.Name); remaining > 0 && decision["action"] != "hold" {
+					decision["cooldown_remaining_sec"] = int(remaining.Seconds())
+					decision["note"] = "the daemon would hold: the service is in cooldown"
+				}
+				return decision, nil
+			},
+		},
+	}
+}
+
+// inspectService loads the policy and the service named by the "service" argument.
+// Read-only tools may look at any configured service, not only the allowed ones.
+func inspectService(args json.RawMessage) (*mcpPolicy, ServiceConfig, error) {
+	var in struct {
+		Service string `json:"service"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return nil, ServiceConfig{}, err
+	}
+	policy, err := loadMCPPolicy()
+	if err != nil {
+		return nil, ServiceConfig{}, err
+	}
+	svc, ok := policy.cfg.service(in.Service)
+	if !ok {
+		return nil, ServiceConfig{}, fmt.Errorf("service %s is not configured in %s", in.Service, policy.path)
+	}
+	return policy, svc, nil
+}
+
+// svcMode returns the configured mode of a service
+func svcMode(svc ServiceConfig) string {
+	if svc.Shadow() {
+		return "shadow"
+	}
+	return "active"
+}
+
+// cachedObservations is the latest sample of a service and where it came from
+type cachedObservations struct {
+	observationSample
+	source string
+}
+
+// latestObservations returns the observations of the daemon's last check: from its API
+// when it is running, else from the saved history
+func (p *mcpPolicy) latestObservations(name string) (*cachedObservations, error) {
+	if info, err := fetchAPIStatus(p.st, p.cfg.API.Token); err == nil {
+		for _, svc := range info.Services {
+			if svc.Name != name || svc.LastDecision == nil {
+				continue
+			}
+			var d decisionRecord
+			if data, err := json.Marshal(svc.LastDecision); err == nil && json.Unmarshal(data, &d) == nil && d.Observations != nil {
+				return &cachedObservations{
+					observationSample: observationSample{Time: d.Time(), Replicas: d.CurrentReplicas, Observations: d.Observations},
+					source:            "daemon",
+				}, nil
+			}
+		}
+	}
+
+	state, err := loadServiceState(p.st.Services, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(state.History) == 0 {
+		return nil, fmt.Errorf("no observations for %s yet: the daemon has not checked it", name)
+	}
+	return &cachedObservations{observationSample: state.History[len(state.History)-1], source: "saved state"}, nil
+}
+
+// yamlToMap converts a config struct to a map keyed like docktor.yaml
+func yamlToMap(v interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+)
+
+// MCPConfig limits what the LLM may do through the MCP tools
+type MCPConfig struct {
+	AllowServices []string `yaml:"allow_services,omitempty"` // Services the agent may scale (default: all configured services)
+}
+
+// mcpPolicy enforces the daemon's docktor.yaml on LLM-initiated scaling: only allowed
+// services, only within their replica bounds and never during a cooldown
+type mcpPolicy struct {
+	cfg  Config
+	path string
+	st   statePaths
+}
+
+// loadMCPPolicy loads the config the MCP server acts under. Unlike the read-only
+// resources it fails closed: no scaling decisions without a valid config.
+func loadMCPPolicy() (*mcpPolicy, error) {
+	cfg, path, err := mcpConfig()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load config: %w", err)
+	}
+	cfg.Normalize()
+	st, err := mcpStatePathsFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = "built-in defaults"
+	}
+	return &mcpPolicy{cfg: cfg, path: path, st: st}, nil
+}
+
+// service returns the config of a service the agent may scale
+func (p *mcpPolicy) service(name string) (ServiceConfig, error) {
+	if allowed := p.cfg.MCP.AllowServices; len(allowed) > 0 && !slices.Contains(allowed, name) {
+		return ServiceConfig{}, fmt.Errorf("service %s is not in mcp.allow_services %v", name, allowed)
+	}
+	svc, ok := p.cfg.service(name)
+	if !ok {
+		return ServiceConfig{}, fmt.Errorf("service %s is not configured in %s", name, p.path)
+	}
+	return svc, nil
+}
+
+// defaultService picks the service when the agent did not name one; only
+// unambiguous with a single allowed service
+func (p *mcpPolicy) defaultService() (ServiceConfig, error) {
+	names := p.cfg.MCP.AllowServices
+	if len(names) == 0 {
+		for _, svc := range p.cfg.Services {
+			names = append(names, svc.Name)
+		}
+	}
+	if len(names) != 1 {
+		return ServiceConfig{}, fmt.Errorf("service is required (configured: %v)", names)
+	}
+	return p.service(names[0])
+}
+
+// checkTarget rejects replica counts outside the service's bounds
+func (p *mcpPolicy) checkTarget(svc ServiceConfig, replicas int) error {
+	if replicas < svc.MinReplicas || replicas > svc.MaxReplicas {
+		return fmt.Errorf("target_replicas %d is outside the bounds of %s (%d-%d)", replicas, svc.Name, svc.MinReplicas, svc.MaxReplicas)
+	}
+	return nil
+}
+
+// cooldownRemaining asks the running daemon for the cooldown of a service, or reads
+// the saved state if no daemon is reachable
+func (p *mcpPolicy) cooldownRemaining(name string) time.Duration {
+	if info, err := fetchAPIStatus(p.st, p.cfg.API.Token); err == nil {
+		for _, svc := range info.Services {
+			if svc.Name == name {
+				return time.Duration(svc.CooldownRemaining * float64(time.Second))
+			}
+		}
+		return 0
+	}
+	state, err := loadServiceState(p.st.Services, name)
+	if err != nil {
+		return 0
+	}
+	return state.cooldownRemaining(time.Now())
+}
+
+// applyScale scales a service on behalf of the agent. A running daemon does it through
+// its API, so the action lands in its state, cooldown and decision log; without one the
+// scale runs here and is recorded in the saved state and the decision log. An API error
+// of a running daemon is returned rather than scaling behind its back.
+func (p *mcpPolicy) applyScale(svc ServiceConfig, replicas int, reason string) (map[string]interface{}, error) {
+	if svc.Shadow() {
+		return nil, fmt.Errorf("service %s is in shadow mode and cannot be scaled", svc.Name)
+	}
+	if err := p.checkTarget(svc, replicas); err != nil {
+		return nil, err
+	}
+
+	if daemonRunning(p.st) {
+		var decision map[string]interface{}
+		body := map[string]interface{}{"replicas": replicas, "reason": reason, "source": "llm"}
+		if err := postAPI(p.st, p.cfg.API.Token, "/v1/services/"+url.PathEscape(svc.Name)+"/scale", body, &decision); err != nil {
+			return nil, err
+		}
+		return decision, nil
+	}
+
+	project, err := composeProjectFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := selectServiceContainers(project, svc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select containers: %w", err)
+	}
+	current := len(containers)
+	action := "hold"
+	if replicas > current {
+		action = "scale_up"
+	} else if replicas < current {
+		action = "scale_down"
+	}
+
+	state, err := loadServiceState(p.st.Services, svc.Name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if remaining := state.cooldownRemaining(now); action != "hold" && remaining > 0 {
+		return nil, fmt.Errorf("service %s is in cooldown for another %s", svc.Name, remaining.Round(time.Second))
+	}
+
+	if reason != "" {
+		reason = "requested by LLM agent: " + reason
+	} else {
+		reason = "requested by LLM agent"
+	}
+	entry := map[string]interface{}{
+		"timestamp":        now.Format(time.RFC3339),
+		"service":          svc.Name,
+		"action":           action,
+		"current_replicas": current,
+		"target_replicas":  replicas,
+		"reason":           reason,
+		"observations":     nil,
+		"source":           "llm",
+	}
+	var scaleErr error
+	if action != "hold" {
+		res, err := scaleComposeService(project, svc.Name, replicas, os.Stderr)
+		if res != nil {
+			entry["containers_created"] = res.Created
+			entry["containers_removed"] = res.Removed
+		}
+		if err != nil {
+			entry["error"] = err.Error()
+			scaleErr = fmt.Errorf("failed to scale: %w", err)
+		} else {
+			state.recordAction(now, action, replicas, svc.cooldown())
+			if err := saveServiceState(p.st.Services, state); err != nil {
+				log.Printf("[MCP] WARNING: failed to save state of %s: %v", svc.Name, err)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(p.st.Dir, 0755); err == nil {
+		if err := appendDecision(p.st.Decisions, entry); err != nil {
+			log.Printf("[MCP] WARNING: %v", err)
+		}
+	}
+	if scaleErr != nil {
+		return nil, scaleErr
+	}
+	return entry, nil
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mcpProtocolVersions are the MCP revisions this server speaks, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// maxDecisionResourceLines bounds the decision log returned as a resource
+const maxDecisionResourceLines = 500
+
+// negotiateProtocolVersion accepts the client's version if supported, otherwise it
+// answers with the latest one and leaves it to the client to disconnect
+func negotiateProtocolVersion(requested string) string {
+	if supportedProtocolVersion(requested) {
+		return requested
+	}
+	return mcpProtocolVersions[0]
+}
+
+// supportedProtocolVersion reports whether a protocol version is spoken by this server
+func supportedProtocolVersion(v string) bool {
+	for _, supported := range mcpProtocolVersions {
+		if v == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcNotification is a JSON-RPC message without an ID (e.g. progress)
+type rpcNotification struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// mcpConn tracks the in-flight requests of one client (the stdio peer or an HTTP session)
+type mcpConn struct {
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+}
+
+func newMCPConn() *mcpConn {
+	return &mcpConn{inflight: map[string]context.CancelFunc{}}
+}
+
+// serve handles one message or a JSON-RPC batch (array); a batch gets a single
+// array with the responses of its requests
+func (c *mcpConn) serve(ctx context.Context, w mcpWriter, raw json.RawMessage) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		c.handle(ctx, w, trimmed)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(trimmed, &batch); err != nil {
+		writeErr(w, nil, -32700, "parse error")
+		return
+	}
+	if len(batch) == 0 {
+		writeErr(w, nil, -32600, "invalid request: empty batch")
+		return
+	}
+
+	replies := make([]*responseCollector, len(batch))
+	var wg sync.WaitGroup
+	for i, msg := range batch {
+		replies[i] = &responseCollector{forward: w}
+		wg.Add(1)
+		go func(col *responseCollector, msg json.RawMessage) {
+			defer wg.Done()
+			c.handle(ctx, col, msg)
+		}(replies[i], msg)
+	}
+	wg.Wait()
+
+	var responses []json.RawMessage
+	for _, col := range replies {
+		responses = append(responses, col.msgs...)
+	}
+	// A batch of notifications gets no reply at all
+	if len(responses) > 0 {
+		_ = w.write(responses)
+	}
+}
+
+// handle handles a single message: cancellations are applied here, requests are
+// dispatched with a context that a later notifications/cancelled can cancel
+func (c *mcpConn) handle(ctx context.Context, w mcpWriter, raw json.RawMessage) {
+	var req rpcReq
+	if err := json.Unmarshal(raw, &req); err != nil {
+		writeErr(w, nil, -32700, "parse error")
+		return
+	}
+	switch {
+	case req.Method == "":
+		// A response to a server request; none are sent, so there is nothing to match
+		return
+	case req.Method == "notifications/cancelled":
+		var p struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		c.cancel(p.RequestID, p.Reason)
+		return
+	case len(req.ID) == 0:
+		handleMCP(ctx, w, req)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	key := string(req.ID)
+	c.mu.Lock()
+	c.inflight[key] = cancel
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		cancel()
+	}()
+
+	handleMCP(ctx, &cancellableWriter{w: w, ctx: ctx}, req)
+}
+
+// cancel cancels an in-flight request; unknown or finished requests are ignored
+func (c *mcpConn) cancel(id json.RawMessage, reason string) {
+	c.mu.Lock()
+	cancel, ok := c.inflight[string(id)]
+	c.mu.Unlock()
+	if ok {
+		log.Printf("Request %s cancelled by client: %s", id, reason)
+		cancel()
+	}
+}
+
+// cancellableWriter drops the response of a request once it was cancelled,
+// as the client no longer expects one
+type cancellableWriter struct {
+	w   mcpWriter
+	ctx context.Context
+}
+
+func (c *cancellableWriter) write(msg interface{}) error {
+	if _, isResponse := msg.(rpcRes); isResponse && c.ctx.Err() != nil {
+		return nil
+	}
+	return c.w.write(msg)
+}
+
+// responseCollector keeps the responses of a request and forwards notifications
+type responseCollector struct {
+	mu      sync.Mutex
+	forward mcpWriter
+	msgs    []json.RawMessage
+}
+
+func (r *responseCollector) write(msg interface{}) error {
+	if _, isNotification := msg.(rpcNotification); isNotification {
+		return r.forward.write(msg)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.msgs = append(r.msgs, data)
+	r.mu.Unlock()
+	return nil
+}
+
+// mcpProgress returns a function sending notifications/progress for the request,
+// or a no-op if the client did not pass a progress token in params._meta
+func mcpProgress(w mcpWriter, params json.RawMessage) func(progress, total float64, message string) {
+	var p struct {
+		Meta struct {
+			ProgressToken json.RawMessage `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	_ = json.Unmarshal(params, &p)
+	token := p.Meta.ProgressToken
+	if len(token) == 0 || string(token) == "null" {
+		return func(float64, float64, string) {}
+	}
+	return func(progress, total float64, message string) {
+		_ = w.write(rpcNotification{Jsonrpc: "2.0", Method: "notifications/progress", Params: map[string]interface{}{
+			"progressToken": token,
+			"progress":      progress,
+			"total":         total,
+			"message":       message,
+		}})
+	}
+}
+
+// mcpConfig loads the config of the daemon that started the MCP server
+// ($DOCKTOR_CONFIG), or the auto-discovered docktor.yaml
+func mcpConfig() (Config, string, error) {
+	path := os.Getenv(configEnv)
+	if path == "" {
+		path = configPath(daemonOpts{})
+	}
+	cfg, err := LoadConfig(path)
+	return cfg, path, err
+}
+
+// mcpStatePaths returns the state files of the daemon's project
+func mcpStatePaths() (Config, statePaths, error) {
+	cfg, _, err := mcpConfig()
+	if err != nil {
+		// No config: the project selection exported by the daemon is all there is
+		cfg = Config{}
+	}
+	st, err := mcpStatePathsFor(cfg)
+	return cfg, st, err
+}
+
+// mcpStatePathsFor resolves the state files like the daemon that started the server did:
+// its state dir and project name are exported and win over the config
+func mcpStatePathsFor(cfg Config) (statePaths, error) {
+	if project := os.Getenv("DOCKTOR_COMPOSE_PROJECT"); project != "" {
+		cfg.ProjectName = project
+	}
+	return resolveStatePaths(cfg, os.Getenv(stateDirEnv), false)
+}
+
+// mcpResource describes a resource in resources/list
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+func mcpResourcesList(w mcpWriter, id json.RawMessage) {
+	resources := []mcpResource{}
+	cfg, path, err := mcpConfig()
+	if path != "" {
+		resources = append(resources, mcpResource{
+			URI: "docktor://config", Name: filepath.Base(path),
+			Description: "Docktor configuration (services, bounds, rules, sources)", MimeType: "application/yaml",
+		})
+	}
+	resources = append(resources, mcpResource{
+		URI: "docktor://decisions", Name: "decisions.jsonl",
+		Description: fmt.Sprintf("Scaling decision log, last %d entries (one JSON object per line)", maxDecisionResourceLines),
+		MimeType:    "application/x-ndjson",
+	})
+	if err == nil {
+		for _, svc := range cfg.Services {
+			resources = append(resources, mcpResource{
+				URI: "docktor://services/" + svc.Name + "/status", Name: svc.Name + " status",
+				Description: "Live status from the daemon API, or the last saved state if the daemon is not running",
+				MimeType:    "application/json",
+			})
+		}
+	}
+	writeRes(w, id, map[string]interface{}{"resources": resources})
+}
+
+func mcpResourcesRead(w mcpWriter, id json.RawMessage, params json.RawMessage) {
+	var in struct {
+		URI string `json:"uri"`
+	}
+	_ = json.Unmarshal(params, &in)
+	log.Printf("[MCP] resources/read(%s)", in.URI)
+
+	text, mimeType, err := readMCPResource(in.URI)
+	if os.IsNotExist(err) {
+		writeErr(w, id, -32002, "resource not found: "+in.URI)
+		return
+	}
+	if err != nil {
+		writeErr(w, id, -32603, err.Error())
+		return
+	}
+	writeRes(w, id, map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{"uri": in.URI, "mimeType": mimeType, "text": text},
+		},
+	})
+}
+
+// readMCPResource returns the contents of a docktor:// resource
+func readMCPResource(uri string) (string, string, error) {
+	switch {
+	case uri == "docktor://config":
+		_, path, _ := mcpConfig()
+		if path == "" {
+			return "", "", os.ErrNotExist
+		}
+		data, err := os.ReadFile(path)
+		return string(data), "application/yaml", err
+
+	case uri == "docktor://decisions":
+		_, st, err := mcpStatePaths()
+		if err != nil {
+			return "", "", err
+		}
+		data, err := os.ReadFile(st.Decisions)
+		if os.IsNotExist(err) {
+			return "", "application/x-ndjson", nil // No decisions yet
+		}
+		if err != nil {
+			return "", "", err
+		}
+		lines := strings.SplitAfter(strings.TrimRight(string(data), "\n"), "\n")
+		if len(lines) > maxDecisionResourceLines {
+			lines = lines[len(lines)-maxDecisionResourceLines:]
+		}
+		return strings.Join(lines, "") + "\n", "application/x-ndjson", nil
+
+	case strings.HasPrefix(uri, "docktor://services/") && strings.HasSuffix(uri, "/status"):
+		name := strings.TrimSuffix(strings.TrimPrefix(uri, "docktor://services/"), "/status")
+		status, err := mcpServiceStatus(name)
+		if err != nil {
+			return "", "", err
+		}
+		data, err := json.MarshalIndent(status, "", "  ")
+		return string(data), "application/json", err
+	}
+	return "", "", os.ErrNotExist
+}
+
+// mcpServiceStatus returns the live status of a service from the daemon API, falling
+// back to its saved state (without the observation history) when the daemon is not running
+func mcpServiceStatus(name string) (map[string]interface{}, error) {
+	cfg, st, err := mcpStatePaths()
+	if err != nil {
+		return nil, err
+	}
+	if info, err := fetchAPIStatus(st, cfg.API.Token); err == nil {
+		for _, svc := range info.Services {
+			if svc.Name == name {
+				return map[string]interface{}{"source": "daemon", "status": svc}, nil
+			}
+		}
+		return nil, os.ErrNotExist
+	}
+
+	if _, ok := cfg.service(name); !ok {
+		return nil, os.ErrNotExist
+	}
+	state, err := loadServiceState(st.Services, name)
+	if err != nil {
+		return nil, err
+	}
+	state.History = nil
+	return map[string]interface{}{"source": "saved state", "state": state}, nil
+}
+
+// mcpPrompt describes a prompt in prompts/list
+type mcpPrompt struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Arguments   []mcpPromptArgument `json:"arguments,omitempty"`
+}
+
+type mcpPromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+var mcpPrompts = []mcpPrompt{
+	{
+		Name:        "autoscale",
+		Description: "The SRE autoscaling loop the daemon's agent runs, with the configured thresholds filled in",
+		Arguments: []mcpPromptArgument{
+			{Name: "variant", Description: "Agent instructions to use: cloud or dmr (default: from llm.provider)"},
+		},
+	},
+	{
+		Name:        "explain_decision",
+		Description: "Explain the latest scaling decision of a service from its status and the decision log",
+		Arguments: []mcpPromptArgument{
+			{Name: "service", Description: "Service name", Required: true},
+		},
+	},
+	{
+		Name:        "review_rules",
+		Description: "Review a service's scaling rules against its recent decisions and suggest changes",
+		Arguments: []mcpPromptArgument{
+			{Name: "service", Description: "Service name", Required: true},
+		},
+	},
+}
+
+func mcpPromptsList(w mcpWriter, id json.RawMessage) {
+	writeRes(w, id, map[string]interface{}{"prompts": mcpPrompts})
+}
+
+func mcpPromptsGet(w mcpWriter, id json.RawMessage, params json.RawMessage) {
+	var in struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	_ = json.Unmarshal(params, &in)
+	log.Printf("[MCP] prompts/get(%s, %v)", in.Name, in.Arguments)
+
+	var text string
+	switch in.Name {
+	case "autoscale":
+		instruction, err := agentPrompt(in.Arguments["variant"])
+		if err != nil {
+			writeErr(w, id, -32603, err.Error())
+			return
+		}
+		text = instruction
+	case "explain_decision", "review_rules":
+		service := in.Arguments["service"]
+		if service == "" {
+			writeErr(w, id, -32602, "missing required argument: service")
+			return
+		}
+		status := "docktor://services/" + service + "/status"
+		if in.Name == "explain_decision" {
+			text = fmt.Sprintf("You are an SRE reviewing the autoscaler of the %q service.\n"+
+				"Read the resources %s and docktor://decisions. Explain the latest decision for %q: "+
+				"which observations and rules led to it, whether a cooldown or the replica bounds applied, "+
+				"and what would change the outcome. Be concise and quote the numbers.", service, status, service)
+		} else {
+			text = fmt.Sprintf("You are an SRE tuning the autoscaler of the %q service.\n"+
+				"Read docktor://config, %s and docktor://decisions. Look for flapping (up/down within a few checks), "+
+				"holds at the replica bounds and thresholds that never or always match. Suggest concrete changes "+
+				"to the rules, bounds, cooldown or metrics window for %q, with the reason for each.", service, status, service)
+		}
+	default:
+		writeErr(w, id, -32602, "unknown prompt: "+in.Name)
+		return
+	}
+
+	writeRes(w, id, map[string]interface{}{
+		"messages": []map[string]interface{}{
+			{"role": "user", "content": map[string]interface{}{"type": "text", "text": text}},
+		},
+	})
+}
+
+// agentPrompt returns the instruction of the built-in agent with the config values filled in
+func agentPrompt(variant string) (string, error) {
+	cfg, _, err := mcpConfig()
+	if err != nil {
+		cfg = DefaultConfig()
+	}
+	if variant == "" {
+		variant = "cloud"
+		if cfg.LLM.Provider == "dmr" {
+			variant = "dmr"
+		}
+	}
+	if variant != "cloud" && variant != "dmr" {
+		return "", fmt.Errorf("unknown variant %q (must be cloud or dmr)", variant)
+	}
+
+	data, err := os.ReadFile(filepath.Join("agents", "docktor."+variant+".yaml"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read agent file: %w", err)
+	}
+	var agentFile struct {
+		Agents map[string]struct {
+			Instruction string `yaml:"instruction"`
+		} `yaml:"agents"`
+	}
+	if err := yaml.Unmarshal(data, &agentFile); err != nil {
+		return "", fmt.Errorf("failed to parse agent YAML: %w", err)
+	}
+	instruction := agentFile.Agents["docktor"].Instruction
+	if instruction == "" {
+		return "", fmt.Errorf("invalid agent file: missing instruction")
+	}
+	return substituteAgentVars(instruction, cfg), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// schema is a JSON Schema document as declared in the tool list
+type schema = map[string]interface{}
+
+// objectSchema returns a closed object schema with the given properties
+func objectSchema(properties schema, required ...string) schema {
+	s := schema{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// validateArguments decodes tool arguments and checks them against the input schema
+func validateArguments(s schema, args json.RawMessage) error {
+	if len(bytes.TrimSpace(args)) == 0 || string(bytes.TrimSpace(args)) == "null" {
+		args = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("arguments are not valid JSON: %w", err)
+	}
+	return validateJSON(s, v, "arguments")
+}
+
+// validateJSON checks a decoded value (numbers as json.Number) against the subset of
+// JSON Schema used by the tool schemas: type, properties, required,
+// additionalProperties, items, enum, minimum and maximum
+func validateJSON(s schema, v interface{}, path string) error {
+	if t, ok := s["type"]; ok && !matchesType(t, v) {
+		return fmt.Errorf("%s: expected %v, got %s", path, t, jsonTypeName(v))
+	}
+
+	if enum, ok := s["enum"]; ok {
+		found := false
+		for _, allowed := range toList(enum) {
+			found = found || fmt.Sprint(allowed) == fmt.Sprint(v)
+		}
+		if !found {
+			return fmt.Errorf("%s: must be one of %v, got %v", path, toList(enum), v)
+		}
+	}
+
+	if n, ok := v.(json.Number); ok {
+		f, _ := n.Float64()
+		if min, ok := s["minimum"]; ok && f < toFloat(min) {
+			return fmt.Errorf("%s: must be >= %v, got %v", path, min, n)
+		}
+		if max, ok := s["maximum"]; ok && f > toFloat(max) {
+			return fmt.Errorf("%s: must be <= %v, got %v", path, max, n)
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		props, _ := s["properties"].(schema)
+		for _, name := range toList(s["required"]) {
+			if _, ok := v[fmt.Sprint(name)]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k].(schema); ok {
+				if err := validateJSON(ps, v[k], path+"."+k); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := s["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Errorf("%s: unknown property %q", path, k)
+				}
+			case schema:
+				if err := validateJSON(extra, v[k], path+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := s["items"].(schema); ok {
+			for i, item := range v {
+				if err := validateJSON(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchesType checks a value against a type name or a list of type names
+func matchesType(t interface{}, v interface{}) bool {
+	for _, name := range toList(t) {
+		switch name {
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(json.Number); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := v.(json.Number); ok && !strings.ContainsAny(n.String(), ".eE") {
+				return true
+			}
+		case "null":
+			if v == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonTypeName names the JSON type of a decoded value for error messages
+func jsonTypeName(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number " + v.String()
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// toList normalizes schema keywords that hold a list ([]string or []interface{}) or a single value
+func toList(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case []string:
+		out := make([]interface{}, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out
+	}
+	return []interface{}{v}
+}
+
+// toFloat converts a numeric schema keyword
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return 0
+}
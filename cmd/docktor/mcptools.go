@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/source"
+)
+
+// mcpTool is a tool exposed over MCP. Arguments are validated against InputSchema
+// before call runs; the result is returned as structuredContent (matching
+// OutputSchema) and as JSON text for clients without structured output.
+type mcpTool struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	InputSchema  schema `json:"inputSchema"`
+	OutputSchema schema `json:"outputSchema,omitempty"`
+
+	call func(ctx context.Context, args json.RawMessage, progress func(done, total float64, message string)) (map[string]interface{}, error)
+}
+
+var (
+	windowSecSchema = schema{"type": "integer", "minimum": 1, "maximum": 3600}
+	replicasSchema  = schema{"type": "integer", "minimum": 0}
+	numberMap       = schema{"type": "object", "additionalProperties": schema{"type": "number"}}
+	conditionSchema = schema{
+		"type": "object",
+		"properties": schema{
+			"metric": schema{"type": "string"},
+			"op":     schema{"type": "string", "enum": []string{">", ">=", "<", "<=", "==", "!="}},
+			"value":  schema{"type": "number"},
+		},
+		"required": []string{"metric", "op", "value"},
+	}
+	decisionSchema = schema{
+		"type": "object",
+		"properties": schema{
+			"action":           schema{"type": "string", "enum": []string{"scale_up", "scale_down", "hold"}},
+			"target_replicas":  schema{"type": "integer"},
+			"current_replicas": schema{"type": "integer"},
+			"reason":           schema{"type": "string"},
+			"policy":           schema{"type": "string"},
+			"matched_rules":    schema{"type": "array", "items": schema{"type": "string"}},
+		},
+		"required": []string{"action", "target_replicas", "current_replicas", "reason"},
+	}
+)
+
+// mcpTools returns the tool list; source kinds are listed from the source registry
+func mcpTools() []mcpTool {
+	tools := []mcpTool{
+		{
+			Name:        "get_metrics",
+			Description: "Return avg CPU% over window for a compose service (selected by compose labels) or for containers matching a regex",
+			InputSchema: objectSchema(schema{
+				"service":         schema{"type": "string"},
+				"container_regex": schema{"type": "string"},
+				"window_sec":      windowSecSchema,
+			}),
+			OutputSchema: objectSchema(schema{"metrics": numberMap}, "metrics"),
+			call:         callGetMetrics,
+		},
+		{
+			Name:        "get_current_replicas",
+			Description: "Get the current number of running replicas for a service from Docker Compose",
+			InputSchema: objectSchema(schema{
+				"service": schema{"type": "string"},
+			}, "service"),
+			OutputSchema: objectSchema(schema{"current_replicas": schema{"type": "integer"}}, "current_replicas"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in struct {
+					Service string `json:"service"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				count, err := toolGetCurrentReplicas(in.Service)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"current_replicas": count}, nil
+			},
+		},
+		{
+			Name:        "calculate_target_replicas",
+			Description: "Calculate target replicas based on scaling recommendation and current count, within the bounds, steps and cooldown of the service in docktor.yaml",
+			InputSchema: objectSchema(schema{
+				"service":          schema{"type": "string"},
+				"recommendation":   schema{"type": "string", "enum": []string{"scale_up", "scale_down", "hold"}},
+				"current_replicas": replicasSchema,
+			}, "recommendation", "current_replicas"),
+			OutputSchema: objectSchema(schema{
+				"service":          schema{"type": "string"},
+				"action":           schema{"type": "string", "enum": []string{"scale_up", "scale_down", "hold"}},
+				"should_scale":     schema{"type": "boolean"},
+				"target_replicas":  schema{"type": "integer"},
+				"current_replicas": schema{"type": "integer"},
+				"min_replicas":     schema{"type": "integer"},
+				"max_replicas":     schema{"type": "integer"},
+				"reason":           schema{"type": "string"},
+			}, "service", "action", "should_scale", "target_replicas", "current_replicas"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in struct {
+					Service         string `json:"service"`
+					Recommendation  string `json:"recommendation"`
+					CurrentReplicas int    `json:"current_replicas"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				policy, err := loadMCPPolicy()
+				if err != nil {
+					return nil, err
+				}
+				svc, err := policy.defaultService()
+				if in.Service != "" {
+					svc, err = policy.service(in.Service)
+				}
+				if err != nil {
+					return nil, err
+				}
+
+				up, down := policy.cfg.Scaling.steps()
+				res, err := toolCalculateTargetReplicas(in.Recommendation, in.CurrentReplicas, svc.MinReplicas, svc.MaxReplicas, up, down)
+				if err != nil {
+					return nil, err
+				}
+				res["service"] = svc.Name
+				res["min_replicas"] = svc.MinReplicas
+				res["max_replicas"] = svc.MaxReplicas
+				if svc.Shadow() && res["should_scale"] == true {
+					res["action"], res["should_scale"], res["target_replicas"] = "hold", false, in.CurrentReplicas
+					res["reason"] = "service is in shadow mode"
+				} else if remaining := policy.cooldownRemaining(svc.Name); remaining > 0 && res["should_scale"] == true {
+					res["action"], res["should_scale"], res["target_replicas"] = "hold", false, in.CurrentReplicas
+					res["reason"] = fmt.Sprintf("cooldown: %s remaining", remaining.Round(time.Second))
+				}
+				return res, nil
+			},
+		},
+		{
+			Name:        "detect_anomalies",
+			Description: "Recommend scale_up/scale_down based on CPU thresholds",
+			InputSchema: objectSchema(schema{
+				"metrics": numberMap,
+				"rules": objectSchema(schema{
+					"cpu_high_pct": schema{"type": "number", "minimum": 0},
+					"cpu_low_pct":  schema{"type": "number", "minimum": 0},
+				}, "cpu_high_pct", "cpu_low_pct"),
+			}, "metrics", "rules"),
+			OutputSchema: objectSchema(schema{
+				"recommendation": schema{"type": "string", "enum": []string{"scale_up", "scale_down", "hold"}},
+				"reason":         schema{"type": "string"},
+			}, "recommendation", "reason"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in DetectParams
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				action, reason := toolDetect(in.Metrics, in.Rules.CPUHighPct, in.Rules.CPULowPct)
+				return map[string]interface{}{"recommendation": action, "reason": reason}, nil
+			},
+		},
+		{
+			Name:        "propose_scale",
+			Description: "Echo the docker compose scaling command for validation",
+			InputSchema: objectSchema(schema{
+				"service":         schema{"type": "string"},
+				"target_replicas": replicasSchema,
+			}, "service", "target_replicas"),
+			OutputSchema: objectSchema(schema{
+				"valid":   schema{"type": "boolean"},
+				"message": schema{"type": "string"},
+				"command": schema{"type": "string"},
+			}, "valid", "message"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in ProposeParams
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				composeArgs := []string{"compose", "-f", os.Getenv("DOCKTOR_COMPOSE_FILE")}
+				if project, err := composeProjectFromEnv(); err == nil {
+					composeArgs = project.Args()
+				}
+				cmd := fmt.Sprintf("docker %s up -d --no-deps --no-recreate --scale %s=%d %s",
+					strings.Join(composeArgs, " "), in.Service, in.TargetReplicas, in.Service)
+				return map[string]interface{}{"valid": true, "message": "proposal valid", "command": cmd}, nil
+			},
+		},
+		{
+			Name:        "apply_scale",
+			Description: "Scale a service with docker compose. Only services, bounds and cooldowns allowed by docktor.yaml are accepted; the action is logged as an LLM decision.",
+			InputSchema: objectSchema(schema{
+				"service":         schema{"type": "string"},
+				"target_replicas": replicasSchema,
+				"reason":          schema{"type": "string"},
+			}, "service", "target_replicas"),
+			OutputSchema: objectSchema(schema{
+				"valid":    schema{"type": "boolean"},
+				"message":  schema{"type": "string"},
+				"decision": schema{"type": "object"},
+			}, "valid", "message"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in ApplyParams
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				policy, err := loadMCPPolicy()
+				if err != nil {
+					return nil, err
+				}
+				svc, err := policy.service(in.Service)
+				if err != nil {
+					return nil, err
+				}
+				log.Printf("[MCP] apply_scale(service=%s, target_replicas=%d, reason=%s) EXECUTING...", in.Service, in.TargetReplicas, in.Reason)
+				decision, err := policy.applyScale(svc, in.TargetReplicas, in.Reason)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{
+					"valid":    true,
+					"message":  fmt.Sprintf("scaled %s to %d. reason: %s", in.Service, in.TargetReplicas, in.Reason),
+					"decision": decision,
+				}, nil
+			},
+		},
+		{
+			Name:        "get_queue_metrics",
+			Description: "Collect the metrics of the queue configured for a service in docktor.yaml (backlog, lag, rates)",
+			InputSchema: objectSchema(schema{
+				"service":    schema{"type": "string"},
+				"window_sec": windowSecSchema,
+			}, "service", "window_sec"),
+			OutputSchema: numberMap,
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in struct {
+					WindowSec int `json:"window_sec"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				// Only the configured queue is reachable: the agent cannot point docktor at other hosts
+				_, svc, err := inspectService(args)
+				if err != nil {
+					return nil, err
+				}
+				if svc.Queue == nil {
+					return nil, fmt.Errorf("service %s has no queue configured", svc.Name)
+				}
+				res, err := toolGetQueueMetrics(ctx, *svc.Queue, in.WindowSec)
+				if err != nil {
+					return nil, err
+				}
+				out := make(map[string]interface{}, len(res))
+				for k, v := range res {
+					out[k] = v
+				}
+				return out, nil
+			},
+		},
+		{
+			Name:        "collect_metrics",
+			Description: "Collect observations from the metric sources configured for a service in docktor.yaml, in parallel over a window; each source reports as <namespace>.<metric>. Sources are selected by kind or namespace (default: all configured sources).",
+			InputSchema: objectSchema(schema{
+				"service": schema{"type": "string"},
+				"sources": schema{
+					"type": "array",
+					"items": objectSchema(schema{
+						"kind":      schema{"type": "string", "enum": source.Kinds()},
+						"namespace": schema{"type": "string"},
+						"required":  schema{"type": "boolean"},
+					}),
+				},
+				"window_sec": windowSecSchema,
+			}, "service"),
+			OutputSchema: objectSchema(schema{
+				"observations": numberMap,
+				"errors":       schema{"type": "object", "additionalProperties": schema{"type": "string"}},
+			}, "observations", "errors"),
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in struct {
+					Sources   []source.Config `json:"sources"`
+					WindowSec int             `json:"window_sec"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				_, svc, err := inspectService(args)
+				if err != nil {
+					return nil, err
+				}
+				if in.WindowSec <= 0 {
+					in.WindowSec = 10
+				}
+				return toolCollectMetrics(ctx, svc, in.Sources, in.WindowSec)
+			},
+		},
+		{
+			Name:        "decide_scale_multi",
+			Description: "Evaluate multi-metric scaling rules and decide action (scale_up/scale_down/hold)",
+			InputSchema: objectSchema(schema{
+				"service_name":     schema{"type": "string"},
+				"current_replicas": replicasSchema,
+				"min_replicas":     replicasSchema,
+				"max_replicas":     replicasSchema,
+				"rules": objectSchema(schema{
+					"scale_up_when":   schema{"type": "array", "items": conditionSchema},
+					"scale_down_when": schema{"type": "array", "items": conditionSchema},
+				}),
+				"observations": numberMap,
+			}, "service_name", "current_replicas", "min_replicas", "max_replicas", "rules", "observations"),
+			OutputSchema: decisionSchema,
+			call: func(ctx context.Context, args json.RawMessage, _ func(float64, float64, string)) (map[string]interface{}, error) {
+				var in struct {
+					ServiceName     string             `json:"service_name"`
+					CurrentReplicas int                `json:"current_replicas"`
+					MinReplicas     int                `json:"min_replicas"`
+					MaxReplicas     int                `json:"max_replicas"`
+					Rules           Rules              `json:"rules"`
+					Observations    map[string]float64 `json:"observations"`
+				}
+				if err := json.Unmarshal(args, &in); err != nil {
+					return nil, err
+				}
+				if in.MinReplicas > in.MaxReplicas {
+					return nil, fmt.Errorf("min_replicas (%d) is greater than max_replicas (%d)", in.MinReplicas, in.MaxReplicas)
+				}
+				// The rules are given, the step sizes are the ones the daemon uses
+				cfg, _, err := mcpConfig()
+				if err != nil {
+					cfg = DefaultConfig()
+				}
+				up, down := cfg.Scaling.steps()
+				return toolDecideScaleMulti(in.ServiceName, in.CurrentReplicas, in.MinReplicas, in.MaxReplicas, up, down, in.Rules, in.Observations)
+			},
+		},
+	}
+	return append(tools, mcpInspectTools()...)
+}
+
+// callGetMetrics samples CPU for get_metrics, reporting the window as progress
+func callGetMetrics(ctx context.Context, args json.RawMessage, progress func(float64, float64, string)) (map[string]interface{}, error) {
+	var in GetMetricsParams
+	if err := json.Unmarshal(args, &in); err != nil {
+		return nil, err
+	}
+	if in.WindowSec <= 0 {
+		in.WindowSec = 60
+	}
+	onSample := func(elapsed, window int) {
+		progress(float64(elapsed), float64(window), fmt.Sprintf("sampled %ds of %ds", elapsed, window))
+	}
+	var res map[string]float64
+	var err error
+	if in.Service != "" {
+		res, err = toolGetServiceMetrics(ctx, in.Service, in.WindowSec, onSample)
+	} else {
+		res, err = toolGetMetrics(ctx, in.ContainerRegex, in.WindowSec, onSample)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"metrics": res}, nil
+}
+
+func mcpToolsList(w mcpWriter, id json.RawMessage) {
+	writeRes(w, id, map[string]interface{}{
+		"tools":      mcpTools(),
+		"nextCursor": nil,
+	})
+}
+
+// mcpToolsCall runs a tool. Unknown tools are protocol errors; invalid arguments and
+// failures of the tool itself are tool results with isError set, so the model sees them.
+func mcpToolsCall(ctx context.Context, w mcpWriter, id json.RawMessage, params json.RawMessage) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		writeErr(w, id, -32602, "bad params")
+		return
+	}
+
+	tool := lookupTool(p.Name)
+	if tool == nil {
+		writeErr(w, id, -32602, "unknown tool: "+p.Name)
+		return
+	}
+
+	log.Printf("[MCP] %s(%s)", p.Name, string(p.Arguments))
+	if err := validateArguments(tool.InputSchema, p.Arguments); err != nil {
+		log.Printf("[MCP] %s INVALID: %v", p.Name, err)
+		writeToolError(w, id, "invalid arguments: "+err.Error())
+		return
+	}
+	args := p.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+
+	res, err := tool.call(ctx, args, mcpProgress(w, params))
+	if err != nil {
+		log.Printf("[MCP] %s ERROR: %v", p.Name, err)
+		writeToolError(w, id, err.Error())
+		return
+	}
+	log.Printf("[MCP] %s RESULT: %v", p.Name, res)
+	writeRes(w, id, map[string]interface{}{
+		"content": []map[string]interface{}{
+			{"type": "text", "text": toJSON(res)},
+		},
+		"structuredContent": res,
+		"isError":           false,
+	})
+}
+
+// lookupTool returns the tool with the given name, or nil
+func lookupTool(name string) *mcpTool {
+	for _, t := range mcpTools() {
+		if t.Name == name {
+			return &t
+		}
+	}
+	return nil
+}
+
+// writeToolError reports a failed tool call as a result the model can read
+func writeToolError(w mcpWriter, id json.RawMessage, msg string) {
+	writeRes(w, id, map[string]interface{}{
+		"content": []map[string]interface{}{
+			{"type": "text", "text": msg},
+		},
+		"isError": true,
+	})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/llm"
+)
+
+const (
+	flapWindow        = 10 * time.Minute // Opposite scale actions closer than this count as flapping
+	maxNarrateRecords = 200              // Most recent decisions sent to the model
+	narrateTimeout    = 90 * time.Second
+)
+
+// serviceReport is the deterministic analysis of one service's decisions, used as
+// context for the model and as the fallback narrative
+type serviceReport struct {
+	Service       string   `json:"service"`
+	Checks        int      `json:"checks"`
+	ScaleUps      int      `json:"scale_ups"`
+	ScaleDowns    int      `json:"scale_downs"`
+	Holds         int      `json:"holds"`
+	FirstReplicas int      `json:"first_replicas"`
+	LastReplicas  int      `json:"last_replicas"`
+	MinSeen       int      `json:"min_replicas_seen"`
+	MaxSeen       int      `json:"max_replicas_seen"`
+	Reversals     int      `json:"direction_reversals"` // Opposite actions within flapWindow
+	AtMax         int      `json:"held_at_max_replicas"`
+	AtMin         int      `json:"held_at_min_replicas"`
+	Cooldown      int      `json:"held_by_cooldown"`
+	Failures      int      `json:"failed_scales"`
+	Overrides     int      `json:"guardrail_overrides"`
+	Findings      []string `json:"findings"`
+
+	actions []decisionRecord
+}
+
+// analyzeDecisions summarizes the decisions per service and flags flapping and
+// likely misconfiguration against the configured bounds
+func analyzeDecisions(cfg Config, decisions []decisionRecord) []*serviceReport {
+	reports := map[string]*serviceReport{}
+	var order []string
+	lastAction := map[string]decisionRecord{}
+
+	for _, d := range decisions {
+		r, ok := reports[d.Service]
+		if !ok {
+			r = &serviceReport{Service: d.Service, FirstReplicas: d.CurrentReplicas, MinSeen: d.CurrentReplicas, MaxSeen: d.CurrentReplicas, Findings: []string{}}
+			reports[d.Service] = r
+			order = append(order, d.Service)
+		}
+		r.Checks++
+		r.LastReplicas = d.TargetReplicas
+		r.MinSeen = min(r.MinSeen, d.CurrentReplicas, d.TargetReplicas)
+		r.MaxSeen = max(r.MaxSeen, d.CurrentReplicas, d.TargetReplicas)
+		if d.Error != "" {
+			r.Failures++
+		}
+		if d.Guardrail != "" {
+			r.Overrides++
+		}
+
+		switch d.Action {
+		case "scale_up", "scale_down":
+			if d.Action == "scale_up" {
+				r.ScaleUps++
+			} else {
+				r.ScaleDowns++
+			}
+			if prev, ok := lastAction[d.Service]; ok && prev.Action != d.Action && d.Time().Sub(prev.Time()) < flapWindow {
+				r.Reversals++
+			}
+			lastAction[d.Service] = d
+			r.actions = append(r.actions, d)
+		default:
+			r.Holds++
+			svc, known := cfg.service(d.Service)
+			switch {
+			case strings.HasPrefix(d.Reason, "cooldown:"):
+				r.Cooldown++
+			case known && strings.HasPrefix(d.Reason, "already at target") && d.CurrentReplicas >= svc.MaxReplicas:
+				r.AtMax++
+			case known && strings.HasPrefix(d.Reason, "already at target") && d.CurrentReplicas <= svc.MinReplicas:
+				r.AtMin++
+			}
+		}
+	}
+
+	out := make([]*serviceReport, 0, len(order))
+	for _, name := range order {
+		r := reports[name]
+		svc, _ := cfg.service(name)
+		if r.Reversals >= 2 {
+			r.Findings = append(r.Findings, fmt.Sprintf("flapping: scaling direction reversed %d times within %s; widen the gap between the scale-up and scale-down thresholds or raise cooldown (now %ds)", r.Reversals, flapWindow, svc.Cooldown))
+		}
+		if r.AtMax > 0 && r.AtMax*4 >= r.Checks {
+			r.Findings = append(r.Findings, fmt.Sprintf("pinned at max_replicas (%d) in %d of %d checks while scale-up rules matched; max_replicas may be too low", svc.MaxReplicas, r.AtMax, r.Checks))
+		}
+		if r.AtMin > 0 && r.AtMin*4 >= r.Checks {
+			r.Findings = append(r.Findings, fmt.Sprintf("held at min_replicas (%d) in %d of %d checks while scale-down rules matched; min_replicas may be higher than needed", svc.MinReplicas, r.AtMin, r.Checks))
+		}
+		if r.Cooldown > 0 && r.Cooldown*4 >= r.Checks {
+			r.Findings = append(r.Findings, fmt.Sprintf("%d of %d checks were held by the cooldown; the rules want to act more often than cooldown (%ds) allows", r.Cooldown, r.Checks, svc.Cooldown))
+		}
+		if r.Failures > 0 {
+			r.Findings = append(r.Findings, fmt.Sprintf("%d scale actions failed; check the daemon log", r.Failures))
+		}
+		if r.Overrides > 0 {
+			r.Findings = append(r.Findings, fmt.Sprintf("the guardrail changed %d LLM decisions", r.Overrides))
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// narrateTemplate renders the analysis as a fixed-format summary
+func narrateTemplate(reports []*serviceReport, since time.Time) string {
+	var b strings.Builder
+	period := "all recorded decisions"
+	if !since.IsZero() {
+		period = "since " + since.Format("2006-01-02 15:04:05")
+	}
+	fmt.Fprintf(&b, "Scaling summary (%s)\n", period)
+	for _, r := range reports {
+		fmt.Fprintf(&b, "\n%s: %d checks, %d scale-ups, %d scale-downs, %d holds; replicas %d → %d (range %d-%d)\n",
+			r.Service, r.Checks, r.ScaleUps, r.ScaleDowns, r.Holds, r.FirstReplicas, r.LastReplicas, r.MinSeen, r.MaxSeen)
+		actions := r.actions
+		if len(actions) > 10 {
+			fmt.Fprintf(&b, "  (%d earlier actions not shown)\n", len(actions)-10)
+			actions = actions[len(actions)-10:]
+		}
+		for _, d := range actions {
+			fmt.Fprintf(&b, "  %s %-10s %d→%d  %s\n", d.Time().Format("15:04:05"), d.Action, d.CurrentReplicas, d.TargetReplicas, d.Reason)
+		}
+		if len(r.Findings) == 0 {
+			fmt.Fprintf(&b, "  ✓ No signs of flapping or misconfiguration\n")
+		}
+		for _, f := range r.Findings {
+			fmt.Fprintf(&b, "  ⚠ %s\n", f)
+		}
+	}
+	return b.String()
+}
+
+// narrateLLM asks the configured model for an incident-style summary of the decisions
+func narrateLLM(ctx context.Context, client llm.Client, cfg Config, reports []*serviceReport, decisions []decisionRecord, since time.Time) (string, error) {
+	if len(decisions) > maxNarrateRecords {
+		decisions = decisions[len(decisions)-maxNarrateRecords:]
+	}
+	rules := map[string]interface{}{}
+	for _, r := range reports {
+		if svc, ok := cfg.service(r.Service); ok {
+			rules[svc.Name] = map[string]interface{}{
+				"min_replicas": svc.MinReplicas, "max_replicas": svc.MaxReplicas,
+				"cooldown_sec": svc.Cooldown, "decision_mode": svc.decisionMode(), "rules": svc.Rules,
+			}
+		}
+	}
+	period := "all recorded decisions"
+	if !since.IsZero() {
+		period = "since " + since.Format(time.RFC3339)
+	}
+	input, err := json.Marshal(map[string]interface{}{
+		"period":    period,
+		"config":    rules,
+		"analysis":  reports,
+		"decisions": decisions,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	reply, err := client.Chat(ctx, []llm.Message{
+		{Role: "system", Content: "You are an SRE writing a short incident-style summary of an autoscaler's decisions for a " +
+			"Docker Compose project. Cover per service: what scaled and when, why (which metrics and rules), and whether the " +
+			"behaviour looks like flapping or misconfiguration (bounds, thresholds, cooldown), with concrete config changes if so. " +
+			"Use the analysis numbers as facts, do not invent data, and write plain text for a terminal, under 300 words."},
+		{Role: "user", Content: string(input)},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(reply.Content)
+	if text == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return text, nil
+}
+
+// explainNarrate prints a narrative of the decisions, from the model when it is
+// reachable and from the template otherwise
+func explainNarrate(cfg Config, decisions []decisionRecord, since time.Time) {
+	sort.SliceStable(decisions, func(i, j int) bool { return decisions[i].Time().Before(decisions[j].Time()) })
+	reports := analyzeDecisions(cfg, decisions)
+
+	ctx, cancel := context.WithTimeout(context.Background(), narrateTimeout)
+	defer cancel()
+	client, err := newLLMClient(cfg.LLM)
+	var text string
+	if err == nil {
+		text, err = narrateLLM(ctx, client, cfg, reports, decisions, since)
+	}
+	if err != nil {
+		fmt.Printf("(model %s unavailable: %v; showing the built-in summary)\n\n", cfg.LLM.Model, err)
+		fmt.Print(narrateTemplate(reports, since))
+		return
+	}
+	fmt.Printf("Summary by %s (%s)\n\n%s\n", cfg.LLM.Model, cfg.LLM.Provider, text)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/probe"
+)
+
+// minProbeInterval keeps a probe from turning into a flood: with the maximum concurrency
+// of 100 it still sends at most 1000 requests per second
+const minProbeInterval = 100 * time.Millisecond
+
+// ProbeConfig sends synthetic requests to a service during the metrics window.
+// Results become observations named http.p50_ms, http.p95_ms, http.error_rate and http.rps.
+type ProbeConfig struct {
+	Type         string `yaml:"type,omitempty"`          // Probe type (default: "http")
+	URL          string `yaml:"url"`                     // Target URL, e.g. http://localhost:8080/health
+	Method       string `yaml:"method,omitempty"`        // HTTP method (default: GET)
+	Concurrency  int    `yaml:"concurrency,omitempty"`   // Parallel workers (default: 1)
+	Interval     string `yaml:"interval,omitempty"`      // Pause between requests of one worker, e.g. "250ms" (default: 1s)
+	Timeout      int    `yaml:"timeout,omitempty"`       // Seconds per request (default: 5)
+	ExpectStatus int    `yaml:"expect_status,omitempty"` // Status counted as success (default: any status below 400)
+}
+
+// validate checks the probe block of a service
+func (c *ProbeConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("probe requires 'url'")
+	}
+	if c.Concurrency < 0 || c.Concurrency > 100 {
+		return fmt.Errorf("probe concurrency must be between 1 and 100")
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return fmt.Errorf("probe interval %q is not a valid duration", c.Interval)
+		}
+		if d < minProbeInterval {
+			return fmt.Errorf("probe interval %q is below the minimum of %s", c.Interval, minProbeInterval)
+		}
+	}
+	_, err := probe.NewProber(c.proberConfig())
+	return err
+}
+
+// proberConfig converts the YAML block into a probe.Config
+func (c *ProbeConfig) proberConfig() probe.Config {
+	cfg := probe.Config{
+		Kind:        c.Type,
+		URL:         c.URL,
+		Method:      c.Method,
+		Concurrency: c.Concurrency,
+		Interval:    time.Second,
+		Timeout:     time.Duration(c.Timeout) * time.Second,
+		Attributes:  map[string]string{},
+	}
+	if cfg.Kind == "" {
+		cfg.Kind = "http"
+	}
+	if cfg.Method == "" {
+		cfg.Method = "GET"
+	}
+	if d, err := time.ParseDuration(c.Interval); err == nil {
+		cfg.Interval = d
+	}
+	if c.ExpectStatus != 0 {
+		cfg.Attributes["expect_status"] = strconv.Itoa(c.ExpectStatus)
+	}
+	return cfg
+}
+
+// collectProbe probes the service for the window and returns the observations
+// without the http. prefix
+func collectProbe(ctx context.Context, cfg ProbeConfig, window time.Duration) (map[string]float64, error) {
+	prober, err := probe.NewProber(cfg.proberConfig())
+	if err != nil {
+		return nil, err
+	}
+	if window < time.Second {
+		window = time.Second
+	}
+	res, err := prober.Probe(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+
+	observations := map[string]float64{
+		"error_rate": res.ErrorRate(),
+		"rps":        res.RPS(),
+		"requests":   float64(res.Requests),
+	}
+	// Latency percentiles only exist when at least one request succeeded
+	if len(res.Latencies) > 0 {
+		observations["p50_ms"] = res.Percentile(50)
+		observations["p95_ms"] = res.Percentile(95)
+	}
+	return observations, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/prom"
+)
+
+// PrometheusConfig reads application metrics from Prometheus exporters or a
+// Prometheus-compatible query API. Values become observations named prom.<name>.
+type PrometheusConfig struct {
+	Scrape  []string          `yaml:"scrape,omitempty"`  // OpenMetrics/text endpoints to scrape; counters become summed per-second rates (<name>_per_sec), gauges and quantiles are maxed
+	Metrics []string          `yaml:"metrics,omitempty"` // Scraped metric names to keep (default: all)
+	Labels  map[string]string `yaml:"labels,omitempty"`  // Only keep scraped series carrying these labels
+	URL     string            `yaml:"url,omitempty"`     // Prometheus HTTP API base URL for queries
+	Queries map[string]string `yaml:"queries,omitempty"` // Observation name → PromQL returning one series or a scalar
+	Timeout int               `yaml:"timeout,omitempty"` // Seconds per scrape and for the queries (default: 5)
+}
+
+// validate checks the prometheus block of a service
+func (c *PrometheusConfig) validate() error {
+	if len(c.Scrape) == 0 && len(c.Queries) == 0 {
+		return fmt.Errorf("prometheus needs 'scrape' endpoints or 'queries'")
+	}
+	if len(c.Queries) > 0 && c.URL == "" {
+		return fmt.Errorf("prometheus 'queries' require 'url'")
+	}
+	for name := range c.Queries {
+		if name == "" || strings.ContainsAny(name, " \t{}") {
+			return fmt.Errorf("prometheus query name %q is not a valid observation name", name)
+		}
+	}
+	return nil
+}
+
+// rawCounterMetric reports whether a rule metric names a scraped counter by its
+// cumulative name; such counters are only observed as prom.<name>_per_sec
+func (c *PrometheusConfig) rawCounterMetric(metric string) bool {
+	name, ok := strings.CutPrefix(metric, "prom.")
+	if !ok || len(c.Scrape) == 0 {
+		return false
+	}
+	if _, isQuery := c.Queries[name]; isQuery {
+		return false
+	}
+	return strings.HasSuffix(name, "_total")
+}
+
+// collectPrometheus scrapes the configured endpoints and runs the configured queries.
+// Counters only ever grow, so endpoints are scraped at the start and at the end of the
+// window and counters are reported as their per-second rate in between; gauges come from
+// the last scrape. Whatever could be collected is returned (without the prom. prefix)
+// together with an error for the parts that failed.
+func collectPrometheus(ctx context.Context, cfg PrometheusConfig, window time.Duration) (map[string]float64, error) {
+	timeout := 5 * time.Second
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	client := &http.Client{}
+	scrape := func(endpoint string) ([]prom.Sample, time.Time, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		samples, err := prom.Scrape(ctx, client, endpoint)
+		return samples, time.Now(), err
+	}
+
+	observations := map[string]float64{}
+	var errs []error
+
+	keep := map[string]bool{}
+	for _, name := range cfg.Metrics {
+		keep[name] = true
+	}
+	// An endpoint that fails the first scrape only loses its counter rates; the
+	// failure is reported if it persists at the end of the window
+	start := time.Now()
+	before := make([][]prom.Sample, len(cfg.Scrape))
+	beforeAt := make([]time.Time, len(cfg.Scrape))
+	if window > 0 && len(cfg.Scrape) > 0 {
+		for i, endpoint := range cfg.Scrape {
+			before[i], beforeAt[i], _ = scrape(endpoint)
+		}
+		wait := time.NewTimer(time.Until(start.Add(window)))
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return nil, ctx.Err()
+		case <-wait.C:
+		}
+	}
+	// Endpoints are usually the replicas of one service: their series are combined
+	// like the series of a single endpoint
+	var scraped []prom.Sample
+	for i, endpoint := range cfg.Scrape {
+		samples, at, err := scrape(endpoint)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		scraped = append(scraped, counterRates(before[i], samples, at.Sub(beforeAt[i]))...)
+	}
+	for name, value := range aggregateSamples(scraped, keep, cfg.Labels) {
+		observations[name] = value
+	}
+
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	names := make([]string, 0, len(cfg.Queries))
+	for name := range cfg.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		samples, err := prom.Query(qctx, client, cfg.URL, cfg.Queries[name])
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("query %s: %w", name, err))
+		case len(samples) > 1:
+			errs = append(errs, fmt.Errorf("query %s returned %d series; aggregate it to one (e.g. with sum or max)", name, len(samples)))
+		case len(samples) == 1:
+			observations[name] = samples[0].Value
+		}
+		// An empty result (no traffic yet) simply yields no observation
+	}
+
+	return observations, errors.Join(errs...)
+}
+
+// counterRates replaces the value of each counter series in after with its per-second
+// increase since before. A counter that went down was reset (the process restarted), so
+// it counts from zero. Counter series missing from before (a new replica, a first scrape
+// that failed) are dropped: their rate is unknown. Other samples pass through.
+func counterRates(before, after []prom.Sample, elapsed time.Duration) []prom.Sample {
+	prev := make(map[string]float64, len(before))
+	for _, s := range before {
+		if isCounter(s) {
+			prev[seriesKey(s)] = s.Value
+		}
+	}
+	out := make([]prom.Sample, 0, len(after))
+	for _, s := range after {
+		if isCounter(s) {
+			v, ok := prev[seriesKey(s)]
+			if !ok || elapsed <= 0 {
+				continue
+			}
+			delta := s.Value - v
+			if delta < 0 {
+				delta = s.Value
+			}
+			s.Value = delta / elapsed.Seconds()
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// seriesKey identifies a series by its name and labels, e.g. http_requests_total{code="200"}
+func seriesKey(s prom.Sample) string {
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(s.Name)
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%s=%q", k, s.Labels[k])
+	}
+	return b.String()
+}
+
+// aggregateSamples combines the scraped series of each metric into one value. Counters
+// (and the _sum/_count of summaries), already turned into rates by counterRates, are
+// summed across label sets and endpoints and named <name>_per_sec; gauges and summary
+// quantiles take the maximum, since a sum of per-replica latencies or utilizations means
+// nothing. Histogram buckets are skipped (use a histogram_quantile query instead) and
+// summary quantiles become separate names, e.g. latency_seconds{quantile="0.99"} →
+// latency_seconds_p99.
+func aggregateSamples(samples []prom.Sample, keep map[string]bool, labels map[string]string) map[string]float64 {
+	out := map[string]float64{}
+	for _, s := range samples {
+		if strings.HasSuffix(s.Name, "_bucket") || strings.HasSuffix(s.Name, "_created") {
+			continue
+		}
+		if len(keep) > 0 && !keep[s.Name] {
+			continue
+		}
+		if !matchLabels(s.Labels, labels) {
+			continue
+		}
+		name := s.Name
+		q, isQuantile := s.Labels["quantile"]
+		counter := !isQuantile && isCounter(s)
+		switch {
+		case isQuantile:
+			name += quantileSuffix(q)
+		case counter:
+			name += "_per_sec"
+		}
+		prev, seen := out[name]
+		switch {
+		case !seen:
+			out[name] = s.Value
+		case counter:
+			out[name] = prev + s.Value
+		default:
+			out[name] = max(prev, s.Value)
+		}
+	}
+	return out
+}
+
+// isCounter reports whether a sample counts up, so its rates add up across replicas:
+// declared counters, the _sum and _count of summaries and histograms, and undeclared
+// metrics named like counters
+func isCounter(s prom.Sample) bool {
+	switch s.Type {
+	case "counter":
+		return true
+	case "summary", "histogram":
+		return strings.HasSuffix(s.Name, "_sum") || strings.HasSuffix(s.Name, "_count")
+	case "", "untyped", "unknown":
+		return strings.HasSuffix(s.Name, "_total")
+	}
+	return false
+}
+
+// quantileSuffix turns a summary quantile label into a name suffix: 0.5 → _p50, 0.999 → _p99_9
+func quantileSuffix(q string) string {
+	v, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return "_q" + q
+	}
+	return "_p" + strings.ReplaceAll(strconv.FormatFloat(v*100, 'f', -1, 64), ".", "_")
+}
+
+// matchLabels reports whether all wanted labels are present with the same values
+func matchLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/prom"
+)
+
+// exporter serves the given Prometheus text expositions, one per scrape, repeating the last
+func exporter(t *testing.T, bodies ...string) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body := bodies[0]
+		if len(bodies) > 1 {
+			bodies = bodies[1:]
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testWindow is the metrics window of the scrape tests; counter rates are per second of it
+const testWindow = 100 * time.Millisecond
+
+func replicaExposition(requests, inflight int, p95 float64) string {
+	return fmt.Sprintf(`# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{code="200"} %d
+http_requests_total{code="500"} 1
+# TYPE http_inflight gauge
+http_inflight %d
+# TYPE latency_seconds summary
+latency_seconds{quantile="0.95"} %g
+latency_seconds_sum %d
+latency_seconds_count %d
+# TYPE size_bytes histogram
+size_bytes_bucket{le="+Inf"} 5
+size_bytes_sum 50
+size_bytes_count 5
+jobs_processed_total %d
+queue_depth 7
+`, requests, inflight, p95, requests, 10*requests, requests/10)
+}
+
+func TestCollectPrometheusScrapeAggregation(t *testing.T) {
+	// Over the window replica a serves 10 requests and replica b 20
+	a := exporter(t, replicaExposition(100, 1, 0.1), replicaExposition(110, 2, 0.2))
+	b := exporter(t, replicaExposition(300, 4, 0.5), replicaExposition(320, 5, 0.9))
+
+	got, err := collectPrometheus(context.Background(), PrometheusConfig{Scrape: []string{a.URL, b.URL}}, testWindow)
+	if err != nil {
+		t.Fatalf("collectPrometheus: %v", err)
+	}
+
+	// Rates are per second of the time between the two scrapes, a little over the window
+	perSec := func(v float64) float64 { return v / testWindow.Seconds() }
+	rates := map[string]float64{
+		"http_requests_total_per_sec":   perSec(30), // counter: summed across codes and replicas
+		"latency_seconds_sum_per_sec":   perSec(30),
+		"latency_seconds_count_per_sec": perSec(300),
+		"jobs_processed_total_per_sec":  perSec(3), // undeclared, named like a counter
+		"size_bytes_sum_per_sec":        0,         // unchanged
+		"size_bytes_count_per_sec":      0,
+	}
+	for name, v := range rates {
+		if g, ok := got[name]; !ok || g > v*1.5 || g < v/2 {
+			t.Errorf("%s = %v, want about %v", name, g, v)
+		}
+	}
+	gauges := map[string]float64{
+		"http_inflight":       5,   // gauge: max of the last scrape
+		"latency_seconds_p95": 0.9, // quantile: max, never summed
+		"queue_depth":         7,   // undeclared: max
+	}
+	for name, v := range gauges {
+		if got[name] != v {
+			t.Errorf("%s = %v, want %v", name, got[name], v)
+		}
+	}
+	for name := range got {
+		if strings.HasSuffix(name, "_bucket") || strings.HasSuffix(name, "_total") {
+			t.Errorf("%s should not be observed", name)
+		}
+	}
+}
+
+func TestCollectPrometheusScrapeFilters(t *testing.T) {
+	srv := exporter(t, replicaExposition(10, 2, 0.2))
+
+	got, err := collectPrometheus(context.Background(), PrometheusConfig{
+		Scrape:  []string{srv.URL},
+		Metrics: []string{"http_requests_total"},
+		Labels:  map[string]string{"code": "500"},
+	}, testWindow)
+	if err != nil {
+		t.Fatalf("collectPrometheus: %v", err)
+	}
+	if _, ok := got["http_requests_total_per_sec"]; len(got) != 1 || !ok {
+		t.Errorf("got %v, want only http_requests_total_per_sec", got)
+	}
+}
+
+func TestCollectPrometheusPartialFailure(t *testing.T) {
+	ok := exporter(t, replicaExposition(10, 2, 0.2))
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	got, err := collectPrometheus(context.Background(), PrometheusConfig{Scrape: []string{ok.URL, failing.URL}}, testWindow)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("err = %v, want the failing endpoint's status", err)
+	}
+	if got["http_inflight"] != 2 {
+		t.Errorf("http_inflight = %v, want the healthy endpoint's 2", got["http_inflight"])
+	}
+	if v, ok := got["http_requests_total_per_sec"]; !ok || v != 0 {
+		t.Errorf("http_requests_total_per_sec = %v, want the healthy endpoint's 0", v)
+	}
+}
+
+func TestCollectPrometheusQueries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Query().Get("query") {
+		case "one":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.42"]}]}}`)
+		case "scalar":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"3"]}}`)
+		case "many":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[`+
+				`{"metric":{"pod":"a"},"value":[1700000000,"1"]},{"metric":{"pod":"b"},"value":[1700000000,"2"]}]}}`)
+		case "empty":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+		}
+	}))
+	defer srv.Close()
+
+	got, err := collectPrometheus(context.Background(), PrometheusConfig{
+		URL: srv.URL,
+		Queries: map[string]string{
+			"latency": "one",
+			"pods":    "scalar",
+			"split":   "many",
+			"idle":    "empty",
+			"broken":  "sum(",
+		},
+	}, 0)
+	if got["latency"] != 0.42 || got["pods"] != 3 {
+		t.Errorf("got %v, want latency=0.42 and pods=3", got)
+	}
+	for _, name := range []string{"split", "idle", "broken"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("%s should not be observed", name)
+		}
+	}
+	if err == nil || !strings.Contains(err.Error(), "query split returned 2 series") || !strings.Contains(err.Error(), "bad_data") {
+		t.Errorf("err = %v, want errors for split and broken", err)
+	}
+}
+
+func TestCounterRates(t *testing.T) {
+	counter := func(code string, v float64) prom.Sample {
+		return prom.Sample{Name: "http_requests_total", Labels: map[string]string{"code": code}, Value: v, Type: "counter"}
+	}
+	gauge := prom.Sample{Name: "http_inflight", Value: 3, Type: "gauge"}
+	before := []prom.Sample{counter("200", 100), counter("500", 40)}
+	after := []prom.Sample{
+		counter("200", 120), // +20
+		counter("500", 6),   // reset: 6 since the restart
+		counter("503", 50),  // new series: rate unknown
+		gauge,
+	}
+
+	got := aggregateSamples(counterRates(before, after, 2*time.Second), nil, nil)
+	want := map[string]float64{"http_requests_total_per_sec": 13, "http_inflight": 3}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s = %v, want %v", name, got[name], v)
+		}
+	}
+
+	// Without a first scrape there are no counter rates, only gauges
+	if got := aggregateSamples(counterRates(nil, after, 2*time.Second), nil, nil); len(got) != 1 || got["http_inflight"] != 3 {
+		t.Errorf("first scrape: got %v, want only http_inflight", got)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hwclass/docktor/pkg/compose"
+)
+
+// scaleResult describes what a single scale action changed
+type scaleResult struct {
+	Created    []string // Containers of the managed service that were created
+	Removed    []string // Containers of the managed service that were removed
+	Drifted    []string // Containers whose config drifted but were NOT recreated
+	Unexpected []string // Containers of other services that changed during the scale
+}
+
+// projectLocks serializes scale actions per compose project. Every scale diffs all of
+// the project's containers before and after `compose up`, so a concurrent scale of
+// another service would show up as an unexpected change.
+var projectLocks sync.Map // project name → *sync.Mutex
+
+// lockProject blocks until no other scale action runs in the project and returns the unlock
+func lockProject(name string) func() {
+	v, _ := projectLocks.LoadOrStore(name, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// composeConfigHashes returns the expected config hash per service as computed by compose
+func composeConfigHashes(project *compose.Project) (map[string]string, error) {
+	args := append(project.Args(), "config", "--hash", "*")
+	out, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker compose config --hash: %w", err)
+	}
+
+	hashes := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 {
+			hashes[fields[0]] = fields[1]
+		}
+	}
+	return hashes, nil
+}
+
+// detectDrift lists containers whose config hash no longer matches the compose file.
+// A plain `docker compose up` would recreate these.
+func detectDrift(project *compose.Project, containers []compose.Container) ([]string, error) {
+	hashes, err := composeConfigHashes(project)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifted []string
+	for _, c := range containers {
+		expected, ok := hashes[c.Service]
+		if !ok {
+			continue
+		}
+		if actual := c.ConfigHash(); actual != "" && actual != expected {
+			drifted = append(drifted, fmt.Sprintf("%s (service %s)", c.Name, c.Service))
+		}
+	}
+	sort.Strings(drifted)
+	return drifted, nil
+}
+
+// scaleComposeService scales exactly one compose service to the given replica count.
+//
+// Only the managed service is targeted (--no-deps) and existing containers are never
+// recreated (--no-recreate), so config drift cannot cause restarts of running replicas
+// or of services Docktor does not manage. Drift is reported instead, and every created
+// or removed container is written to out. Scale actions in one project run one at a time.
+func scaleComposeService(project *compose.Project, service string, replicas int, out io.Writer) (*scaleResult, error) {
+	defer lockProject(project.Name)()
+
+	before, err := compose.ListContainers(project.Name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &scaleResult{}
+
+	drifted, err := detectDrift(project, before)
+	if err != nil {
+		fmt.Fprintf(out, "[%s] WARNING: Cannot check for config drift: %v\n", service, err)
+	} else if len(drifted) > 0 {
+		res.Drifted = drifted
+		fmt.Fprintf(out, "[%s] WARNING: Config drift detected, containers will NOT be recreated: %s\n",
+			service, strings.Join(drifted, ", "))
+	}
+
+	args := append(project.Args(), "up", "-d", "--no-deps", "--no-recreate",
+		"--scale", fmt.Sprintf("%s=%d", service, replicas), service)
+	fmt.Fprintf(out, "[%s] Executing: docker %s\n", service, strings.Join(args, " "))
+
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return res, fmt.Errorf("docker compose up: %w", err)
+	}
+
+	after, err := compose.ListContainers(project.Name, nil)
+	if err != nil {
+		return res, err
+	}
+
+	diffContainers(service, before, after, res)
+
+	if len(res.Created) > 0 {
+		fmt.Fprintf(out, "[%s] Created: %s\n", service, strings.Join(res.Created, ", "))
+	}
+	if len(res.Removed) > 0 {
+		fmt.Fprintf(out, "[%s] Removed: %s\n", service, strings.Join(res.Removed, ", "))
+	}
+	if len(res.Created) == 0 && len(res.Removed) == 0 {
+		fmt.Fprintf(out, "[%s] No containers created or removed\n", service)
+	}
+	if len(res.Unexpected) > 0 {
+		fmt.Fprintf(out, "[%s] ERROR: Containers of unmanaged services changed: %s\n",
+			service, strings.Join(res.Unexpected, ", "))
+		return res, fmt.Errorf("scaling %s changed unmanaged containers: %s", service, strings.Join(res.Unexpected, ", "))
+	}
+
+	return res, nil
+}
+
+// diffContainers records which containers appeared or disappeared between two snapshots
+func diffContainers(service string, before, after []compose.Container, res *scaleResult) {
+	beforeIDs := make(map[string]compose.Container, len(before))
+	for _, c := range before {
+		beforeIDs[c.ID] = c
+	}
+	afterIDs := make(map[string]compose.Container, len(after))
+	for _, c := range after {
+		afterIDs[c.ID] = c
+	}
+
+	for id, c := range afterIDs {
+		if _, ok := beforeIDs[id]; ok {
+			continue
+		}
+		if c.Service == service {
+			res.Created = append(res.Created, c.Name)
+		} else {
+			res.Unexpected = append(res.Unexpected, "created "+c.Name)
+		}
+	}
+	for id, c := range beforeIDs {
+		if _, ok := afterIDs[id]; ok {
+			continue
+		}
+		if c.Service == service {
+			res.Removed = append(res.Removed, c.Name)
+		} else {
+			res.Unexpected = append(res.Unexpected, "removed "+c.Name)
+		}
+	}
+
+	sort.Strings(res.Created)
+	sort.Strings(res.Removed)
+	sort.Strings(res.Unexpected)
+}
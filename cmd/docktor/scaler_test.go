@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/hwclass/docktor/pkg/compose"
+)
+
+// fakeDocker puts a docker executable on PATH that keeps one file of `docker ps` rows
+// per service in dir. `compose up --scale svc=N` rewrites that service's file after a
+// delay, so concurrent scales overlap.
+const fakeDocker = `#!/bin/sh
+state=%q
+case " $* " in
+*" ps "*) cat "$state"/*.ps 2>/dev/null; exit 0 ;;
+*" config "*) exit 0 ;;
+*" up "*)
+	prev=
+	for a in "$@"; do
+		[ "$prev" = --scale ] && spec=$a
+		prev=$a
+	done
+	svc=${spec%%=*}
+	n=${spec#*=}
+	sleep 0.3
+	: > "$state/$svc.tmp"
+	i=1
+	while [ $i -le $n ]; do
+		printf '{"ID":"%%s-%%d","Names":"demo-%%s-%%d","State":"running","Labels":"com.docker.compose.project=demo,com.docker.compose.service=%%s"}\n' $svc $i $svc $i $svc >> "$state/$svc.tmp"
+		i=$((i+1))
+	done
+	mv "$state/$svc.tmp" "$state/$svc.ps"
+	exit 0 ;;
+esac
+echo "unexpected: docker $*" >&2
+exit 1
+`
+
+func installFakeDocker(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake docker is a shell script")
+	}
+	bin, state := t.TempDir(), t.TempDir()
+	script := []byte(fmt.Sprintf(fakeDocker, state))
+	if err := os.WriteFile(filepath.Join(bin, "docker"), script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return state
+}
+
+func TestScaleComposeServiceConcurrent(t *testing.T) {
+	state := installFakeDocker(t)
+	for _, svc := range []string{"web", "worker"} {
+		row := fmt.Sprintf(`{"ID":"%s-1","Names":"demo-%s-1","State":"running","Labels":"com.docker.compose.project=demo,com.docker.compose.service=%s"}`+"\n", svc, svc, svc)
+		if err := os.WriteFile(filepath.Join(state, svc+".ps"), []byte(row), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	project := &compose.Project{Name: "demo"}
+	targets := map[string]int{"web": 2, "worker": 3}
+	results := make(map[string]*scaleResult)
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for svc, n := range targets {
+		wg.Add(1)
+		go func(svc string, n int) {
+			defer wg.Done()
+			res, err := scaleComposeService(project, svc, n, io.Discard)
+			mu.Lock()
+			results[svc], errs[svc] = res, err
+			mu.Unlock()
+		}(svc, n)
+	}
+	wg.Wait()
+
+	for svc, n := range targets {
+		if errs[svc] != nil {
+			t.Errorf("scaling %s: %v", svc, errs[svc])
+			continue
+		}
+		res := results[svc]
+		if len(res.Unexpected) > 0 {
+			t.Errorf("scaling %s reported unexpected changes: %v", svc, res.Unexpected)
+		}
+		if len(res.Created) != n-1 || len(res.Removed) != 0 {
+			t.Errorf("scaling %s: created %v, removed %v, want %d created", svc, res.Created, res.Removed, n-1)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/compose"
+)
+
+// maxObservationHistory bounds how many samples are kept per service
+const maxObservationHistory = 120
+
+// observationSample is one iteration's observations, kept for history across restarts
+type observationSample struct {
+	Time         time.Time          `json:"time"`
+	Replicas     int                `json:"replicas"`
+	Observations map[string]float64 `json:"observations"`
+}
+
+// serviceState is the per-service state persisted in the state dir after every iteration,
+// so a restarted daemon continues where it left off instead of starting from scratch
+type serviceState struct {
+	Service         string              `json:"service"`
+	Iteration       int                 `json:"iteration"`
+	LastAction      string              `json:"last_action,omitempty"`
+	LastActionAt    *time.Time          `json:"last_action_at,omitempty"`
+	LastTarget      int                 `json:"last_target,omitempty"`
+	CooldownUntil   *time.Time          `json:"cooldown_until,omitempty"`
+	DesiredReplicas int                 `json:"desired_replicas,omitempty"`
+	Paused          bool                `json:"paused,omitempty"`
+	History         []observationSample `json:"history,omitempty"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+}
+
+// serviceStatePath returns the state file of a service
+func serviceStatePath(dir, service string) string {
+	return filepath.Join(dir, service+".json")
+}
+
+// loadServiceState reads the persisted state of a service; a missing file yields a fresh state
+func loadServiceState(dir, service string) (*serviceState, error) {
+	data, err := os.ReadFile(serviceStatePath(dir, service))
+	if os.IsNotExist(err) {
+		return &serviceState{Service: service}, nil
+	}
+	if err != nil {
+		return &serviceState{Service: service}, err
+	}
+	var s serviceState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return &serviceState{Service: service}, fmt.Errorf("corrupt state file %s: %w", serviceStatePath(dir, service), err)
+	}
+	s.Service = service
+	return &s, nil
+}
+
+// saveServiceState writes the state atomically (write to temp file, then rename)
+func saveServiceState(dir string, s *serviceState) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := serviceStatePath(dir, s.Service)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recordObservations appends an iteration's observations to the bounded history
+func (s *serviceState) recordObservations(ts time.Time, replicas int, observations map[string]float64) {
+	s.History = append(s.History, observationSample{Time: ts, Replicas: replicas, Observations: observations})
+	if len(s.History) > maxObservationHistory {
+		s.History = s.History[len(s.History)-maxObservationHistory:]
+	}
+}
+
+// recordAction stores a scale action and starts the cooldown timer
+func (s *serviceState) recordAction(ts time.Time, action string, target int, cooldown time.Duration) {
+	s.LastAction = action
+	s.LastActionAt = &ts
+	s.LastTarget = target
+	s.DesiredReplicas = target
+	until := ts.Add(cooldown)
+	s.CooldownUntil = &until
+}
+
+// cooldownRemaining returns how long scale actions are still suppressed (0 if not)
+func (s *serviceState) cooldownRemaining(now time.Time) time.Duration {
+	if s.CooldownUntil == nil || !now.Before(*s.CooldownUntil) {
+		return 0
+	}
+	return s.CooldownUntil.Sub(now)
+}
+
+// startupReplicas decides the replica count a service is brought up with. Running
+// containers are adopted as they are (clamped to the configured bounds), so a restart
+// never drops capacity; a stopped service resumes at its last desired count.
+func startupReplicas(project *compose.Project, svc ServiceConfig, stateDir string) (int, string) {
+	clamp := func(n int) int {
+		if n < svc.MinReplicas {
+			return svc.MinReplicas
+		}
+		if n > svc.MaxReplicas {
+			return svc.MaxReplicas
+		}
+		return n
+	}
+
+	if containers, err := selectServiceContainers(project, svc); err == nil && len(containers) > 0 {
+		return clamp(len(containers)), fmt.Sprintf("adopted %d running", len(containers))
+	}
+	if st, err := loadServiceState(stateDir, svc.Name); err == nil && st.DesiredReplicas > 0 {
+		return clamp(st.DesiredReplicas), fmt.Sprintf("last desired %d", st.DesiredReplicas)
+	}
+	return svc.MinReplicas, "min_replicas"
+}
+
+// describeLastAction summarizes the last scale action for log messages
+func describeLastAction(s *serviceState) string {
+	if s.LastActionAt == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s to %d at %s", s.LastAction, s.LastTarget, s.LastActionAt.Format(time.RFC3339))
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/queue"
+	"github.com/hwclass/docktor/pkg/source"
+	"gopkg.in/yaml.v3"
+)
+
+// metricSources returns the effective sources of a service: the sources list (CPU only
+// when the list is empty) followed by the shorthand queue, prometheus and probe blocks
+func (s ServiceConfig) metricSources() []source.Config {
+	var cfgs []source.Config
+	if len(s.Sources) == 0 {
+		cfgs = append(cfgs, source.Config{Kind: "cpu", Required: true})
+	}
+	cfgs = append(cfgs, s.Sources...)
+	if s.Queue != nil {
+		cfgs = append(cfgs, source.Config{Kind: "queue", Options: map[string]interface{}{
+			"provider":  s.Queue.Kind,
+			"url":       s.Queue.URL,
+			"jetstream": s.Queue.JetStream,
+			"stream":    s.Queue.Stream,
+			"consumer":  s.Queue.Consumer,
+			"subject":   s.Queue.Subject,
+			"metrics":   s.Queue.Metrics,
+		}})
+	}
+	if s.Prometheus != nil {
+		cfgs = append(cfgs, source.Config{Kind: "prometheus", Options: sourceOptions(s.Prometheus)})
+	}
+	if s.Probe != nil {
+		cfgs = append(cfgs, source.Config{Kind: "probe", Options: sourceOptions(s.Probe)})
+	}
+	return cfgs
+}
+
+// sourceOptions converts a shorthand config block into source options
+func sourceOptions(v interface{}) map[string]interface{} {
+	data, _ := yaml.Marshal(v)
+	var opts map[string]interface{}
+	_ = yaml.Unmarshal(data, &opts)
+	return opts
+}
+
+// trimNamespace strips the namespace prefix from observation names
+func trimNamespace(observations map[string]float64, namespace string) map[string]float64 {
+	out := make(map[string]float64, len(observations))
+	for k, v := range observations {
+		out[strings.TrimPrefix(k, namespace+".")] = v
+	}
+	return out
+}
+
+// cpuSource samples CPU% of the service's containers (cpu.avg, cpu.min, cpu.max)
+type cpuSource struct {
+	PerContainer bool `yaml:"per_container"` // Also report container.<name> per container
+}
+
+func newCPUSource(cfg source.Config) (source.Source, error) {
+	s := &cpuSource{}
+	return s, cfg.Decode(s)
+}
+
+func (s *cpuSource) Collect(ctx context.Context, target source.Target, window time.Duration) (map[string]float64, error) {
+	metrics, err := sampleContainerMetrics(ctx, target.Containers, int(window/time.Second), nil)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]float64{}
+	for k, v := range metrics {
+		if name, ok := strings.CutPrefix(k, "cpu."); ok {
+			out[name] = v
+		} else if s.PerContainer {
+			out["container."+k] = v
+		}
+	}
+	return out, nil
+}
+
+func (s *cpuSource) Close() error { return nil }
+
+// queueSource collects queue metrics over a long-lived connection (queue.backlog, ...)
+type queueSource struct {
+	cfg      QueueConfig
+	provider queue.Provider // Opened on first use, reopened after a failure
+}
+
+func newQueueSource(cfg source.Config) (source.Source, error) {
+	var opts struct {
+		Provider  string   `yaml:"provider"` // Queue kind: "nats"
+		URL       string   `yaml:"url"`
+		JetStream bool     `yaml:"jetstream"`
+		Stream    string   `yaml:"stream"`
+		Consumer  string   `yaml:"consumer"`
+		Subject   string   `yaml:"subject"`
+		Metrics   []string `yaml:"metrics"` // Only report these (default: all)
+	}
+	if err := cfg.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Provider == "" || opts.URL == "" {
+		return nil, fmt.Errorf("queue source requires 'provider' and 'url'")
+	}
+	return &queueSource{cfg: QueueConfig{
+		Kind:      opts.Provider,
+		URL:       opts.URL,
+		JetStream: opts.JetStream,
+		Stream:    opts.Stream,
+		Consumer:  opts.Consumer,
+		Subject:   opts.Subject,
+		Metrics:   opts.Metrics,
+	}}, nil
+}
+
+func (s *queueSource) Collect(ctx context.Context, target source.Target, window time.Duration) (map[string]float64, error) {
+	if s.provider == nil {
+		provider, err := newQueueProvider(s.cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.provider = provider
+	}
+
+	metrics, err := s.provider.GetMetrics(ctx, int(window/time.Second))
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to get queue metrics: %w", err)
+	}
+	return trimNamespace(queueObservations(metrics, s.cfg.Metrics), "queue"), nil
+}
+
+func (s *queueSource) Close() error {
+	if s.provider != nil {
+		err := s.provider.Close()
+		s.provider = nil
+		return err
+	}
+	return nil
+}
+
+// prometheusSource reads exporters and PromQL queries (prom.<name>)
+type prometheusSource struct {
+	cfg PrometheusConfig
+}
+
+func newPrometheusSource(cfg source.Config) (source.Source, error) {
+	s := &prometheusSource{}
+	if err := cfg.Decode(&s.cfg); err != nil {
+		return nil, err
+	}
+	return s, s.cfg.validate()
+}
+
+func (s *prometheusSource) Collect(ctx context.Context, target source.Target, window time.Duration) (map[string]float64, error) {
+	return collectPrometheus(ctx, s.cfg, window)
+}
+
+func (s *prometheusSource) Close() error { return nil }
+
+// probeSource sends synthetic requests during the window (http.p95_ms, ...)
+type probeSource struct {
+	cfg ProbeConfig
+}
+
+func newProbeSource(cfg source.Config) (source.Source, error) {
+	s := &probeSource{}
+	if err := cfg.Decode(&s.cfg); err != nil {
+		return nil, err
+	}
+	return s, s.cfg.validate()
+}
+
+func (s *probeSource) Collect(ctx context.Context, target source.Target, window time.Duration) (map[string]float64, error) {
+	return collectProbe(ctx, s.cfg, window)
+}
+
+func (s *probeSource) Close() error { return nil }
+
+func init() {
+	source.Register("cpu", "cpu", newCPUSource)
+	source.Register("queue", "queue", newQueueSource)
+	source.Register("prometheus", "prom", newPrometheusSource)
+	source.Register("probe", "http", newProbeSource)
+}
+
+// toolCollectMetrics collects the configured sources of a service once; failed sources
+// are reported next to the observations instead of failing the whole call. The agent
+// can only select sources from docktor.yaml, never pass options of its own: exec
+// sources run commands and probe/prometheus sources send requests from this host.
+func toolCollectMetrics(ctx context.Context, svc ServiceConfig, selectors []source.Config, windowSec int) (map[string]interface{}, error) {
+	cfgs, err := selectSources(svc, selectors)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := source.NewSet(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	defer sources.Close()
+
+	project, err := composeProjectFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	target := source.Target{Project: project.Name, Service: svc.Name}
+	containers, err := selectServiceContainers(project, svc)
+	if err != nil {
+		return nil, err
+	}
+	target.Containers = metricContainers(containers, svc)
+
+	observations, errs := sources.Collect(ctx, target, time.Duration(windowSec)*time.Second)
+	failures := map[string]string{}
+	for _, e := range errs {
+		failures[e.Source.Namespace] = e.Err.Error()
+	}
+	return map[string]interface{}{"observations": observations, "errors": failures}, nil
+}
+
+// selectSources returns the configured sources of a service matching the selectors by
+// kind and namespace (all of them without selectors); a selector may only mark its
+// sources as required
+func selectSources(svc ServiceConfig, selectors []source.Config) ([]source.Config, error) {
+	var configured []source.Config
+	for _, cfg := range svc.metricSources() {
+		cfg, err := source.Resolve(cfg)
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, cfg)
+	}
+	if len(selectors) == 0 {
+		return configured, nil
+	}
+
+	var cfgs []source.Config
+	selected := map[string]bool{}
+	for _, sel := range selectors {
+		if sel.Kind == "" && sel.Namespace == "" {
+			return nil, fmt.Errorf("source selector requires 'kind' or 'namespace'")
+		}
+		matched := false
+		for _, cfg := range configured {
+			if (sel.Kind != "" && sel.Kind != cfg.Kind) || (sel.Namespace != "" && sel.Namespace != cfg.Namespace) {
+				continue
+			}
+			matched = true
+			if selected[cfg.Namespace] {
+				continue
+			}
+			selected[cfg.Namespace] = true
+			cfg.Required = cfg.Required || sel.Required
+			cfgs = append(cfgs, cfg)
+		}
+		if !matched {
+			return nil, fmt.Errorf("service %s has no configured source matching kind=%q namespace=%q", svc.Name, sel.Kind, sel.Namespace)
+		}
+	}
+	return cfgs, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/queue"
+	"github.com/hwclass/docktor/pkg/source"
+)
+
+// slowQueue is a queue provider whose metrics window only ends with its context
+type slowQueue struct{ closed bool }
+
+func (q *slowQueue) Connect() error  { return nil }
+func (q *slowQueue) Validate() error { return nil }
+func (q *slowQueue) Close() error    { q.closed = true; return nil }
+
+func (q *slowQueue) GetMetrics(ctx context.Context, windowSec int) (*queue.Metrics, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestQueueSourceHonorsContext(t *testing.T) {
+	provider := &slowQueue{}
+	s := &queueSource{cfg: QueueConfig{Kind: "nats"}, provider: provider}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := s.Collect(ctx, source.Target{Service: "worker"}, time.Hour)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Collect took %s after its context ended", elapsed)
+	}
+	if !provider.closed || s.provider != nil {
+		t.Error("the connection should be dropped after a failed collection")
+	}
+}
+
+func TestQueueObservationsMetricsFilter(t *testing.T) {
+	metrics := &queue.Metrics{Backlog: 120, Lag: 7, RateIn: 3, RateOut: 2, Custom: map[string]float64{"num_waiting": 1}}
+
+	if got := queueObservations(metrics, nil); len(got) != 5 {
+		t.Errorf("without a filter got %v, want all 5 metrics", got)
+	}
+	got := queueObservations(metrics, []string{"backlog", "num_waiting"})
+	if len(got) != 2 || got["queue.backlog"] != 120 || got["queue.num_waiting"] != 1 {
+		t.Errorf("got %v, want only queue.backlog and queue.num_waiting", got)
+	}
+
+	// The shorthand queue block passes its metrics list to the source
+	svc := ServiceConfig{Name: "worker", Queue: &QueueConfig{Kind: "nats", URL: "nats://localhost:4222", JetStream: true,
+		Stream: "EVENTS", Consumer: "W", Metrics: []string{"backlog"}}}
+	for _, cfg := range svc.metricSources() {
+		if cfg.Kind != "queue" {
+			continue
+		}
+		src, err := newQueueSource(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := src.(*queueSource).cfg.Metrics; len(m) != 1 || m[0] != "backlog" {
+			t.Errorf("queue source metrics = %v, want [backlog]", m)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hwclass/docktor/pkg/compose"
+)
+
+// stateDirEnv overrides the base state directory (also exported to MCP tools)
+const stateDirEnv = "DOCKTOR_STATE_DIR"
+
+// configEnv points MCP tools at the config file of the daemon that started them
+const configEnv = "DOCKTOR_CONFIG"
+
+// statePaths locates the files one Docktor instance keeps for a compose project.
+// Every project gets its own subdirectory, so several daemons can share a host.
+type statePaths struct {
+	Base      string // Base state directory shared by all projects
+	Dir       string // Per-project state directory
+	PIDFile   string
+	LogFile   string
+	Decisions string // Decision log (JSONL)
+	Proposals string // Manual-mode proposals
+	Services  string // Per-service state (iteration, cooldown, history)
+	EnvFile   string // LLM settings for cagent
+	AgentFile string // Generated runtime agent config
+
+	APISocket   string // Default unix socket of the daemon API
+	APIAddrFile string // Address the running daemon's API listens on
+}
+
+// stateBaseDir resolves the base state directory: the --state-dir flag, then state_dir
+// from the config, then $DOCKTOR_STATE_DIR, then $XDG_STATE_HOME/docktor and finally
+// ~/.local/state/docktor
+func stateBaseDir(flagDir, configDir string) (string, error) {
+	for _, dir := range []string{flagDir, configDir, os.Getenv(stateDirEnv)} {
+		if dir != "" {
+			return filepath.Abs(dir)
+		}
+	}
+	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
+		return filepath.Join(xdg, "docktor"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine state directory (set state_dir or %s): %w", stateDirEnv, err)
+	}
+	return filepath.Join(home, ".local", "state", "docktor"), nil
+}
+
+// stateProjectName returns the compose project name used for the state subdirectory.
+// If the compose project cannot be loaded (e.g. `daemon status` after the compose
+// file was moved) it falls back to the same naming rules without reading the files.
+func stateProjectName(cfg Config) string {
+	if project, err := compose.Load(cfg.ComposeOptions()); err == nil {
+		return project.Name
+	}
+	if cfg.ProjectName != "" {
+		return compose.NormalizeProjectName(cfg.ProjectName)
+	}
+	if name := os.Getenv("COMPOSE_PROJECT_NAME"); name != "" {
+		return compose.NormalizeProjectName(name)
+	}
+	files := cfg.ComposeOptions().Files
+	if len(files) > 0 {
+		if abs, err := filepath.Abs(files[0]); err == nil {
+			return compose.NormalizeProjectName(filepath.Base(filepath.Dir(abs)))
+		}
+	}
+	return "default"
+}
+
+// resolveStatePaths returns the state files for the project selected by cfg.
+// A dry-run (shadow) daemon gets its own PID and log file so it can run next to a live
+// one; both write to the same decision log so `explain --compare` can pair them.
+func resolveStatePaths(cfg Config, flagDir string, shadow bool) (statePaths, error) {
+	base, err := stateBaseDir(flagDir, cfg.StateDir)
+	if err != nil {
+		return statePaths{}, err
+	}
+
+	dir := filepath.Join(base, stateProjectName(cfg))
+	daemonName, servicesDir := "daemon", "services"
+	if shadow {
+		daemonName, servicesDir = "daemon-shadow", "services-shadow"
+	}
+
+	return statePaths{
+		Base:      base,
+		Dir:       dir,
+		PIDFile:   filepath.Join(dir, daemonName+".pid"),
+		LogFile:   filepath.Join(dir, daemonName+".log"),
+		Decisions: filepath.Join(dir, "decisions.jsonl"),
+		Proposals: filepath.Join(dir, "proposals"),
+		Services:  filepath.Join(dir, servicesDir),
+		EnvFile:   filepath.Join(dir, ".env.cagent"),
+		AgentFile: filepath.Join(dir, "agent-runtime.yaml"),
+
+		APISocket:   filepath.Join(dir, daemonName+".sock"),
+		APIAddrFile: filepath.Join(dir, daemonName+".api"),
+	}, nil
+}
+
+// cliStatePaths resolves the state files for commands that only read state
+// (explain, proposals, approve, reject) from their --config, --state-dir and
+// --project-name flags
+func cliStatePaths(args []string) statePaths {
+	_, st := cliConfig(args)
+	return st
+}
+
+// cliConfig is cliStatePaths for commands that also need the config
+func cliConfig(args []string) (Config, statePaths) {
+	var configFile, stateDir, projectName string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "--config="):
+			configFile = strings.TrimPrefix(args[i], "--config=")
+		case args[i] == "--config" && i+1 < len(args):
+			configFile = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--state-dir="):
+			stateDir = strings.TrimPrefix(args[i], "--state-dir=")
+		case args[i] == "--state-dir" && i+1 < len(args):
+			stateDir = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--project-name="):
+			projectName = strings.TrimPrefix(args[i], "--project-name=")
+		case args[i] == "--project-name" && i+1 < len(args):
+			projectName = args[i+1]
+			i++
+		}
+	}
+
+	cfg, err := LoadConfig(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if projectName != "" {
+		cfg.ProjectName = projectName
+	}
+
+	st, err := resolveStatePaths(cfg, stateDir, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.Normalize()
+	return cfg, st
+}
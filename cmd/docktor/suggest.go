@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/llm"
+)
+
+const (
+	minSuggestSamples = 20  // Recorded checks needed before thresholds are suggested
+	suggestHysteresis = 0.6 // A scale-down threshold stays at most this share of the scale-up threshold on the same metric
+	suggestTimeout    = 90 * time.Second
+	diffContext       = 2 // Unchanged lines shown around a change
+)
+
+// metricStats summarizes the recorded values of one metric
+type metricStats struct {
+	Samples int     `json:"samples"`
+	Min     float64 `json:"min"`
+	P10     float64 `json:"p10"`
+	P25     float64 `json:"p25"`
+	P50     float64 `json:"p50"`
+	P75     float64 `json:"p75"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	Max     float64 `json:"max"`
+}
+
+// ruleSuggestion is a proposed set of rules and replica bounds for a service
+type ruleSuggestion struct {
+	Rules       Rules    `json:"rules"`
+	MinReplicas int      `json:"min_replicas"`
+	MaxReplicas int      `json:"max_replicas"`
+	Notes       []string `json:"notes"` // Why each value was chosen
+}
+
+// configSuggest proposes rules and bounds for a service from the observations in the
+// decision log, shows the change to docktor.yaml and applies it after confirmation
+func configSuggest(args []string) {
+	var serviceName, configFile string
+	var since time.Time
+	useLLM, yes := false, false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--service" && i+1 < len(args):
+			serviceName = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--service="):
+			serviceName = strings.TrimPrefix(args[i], "--service=")
+		case args[i] == "--config" && i+1 < len(args):
+			configFile = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--config="):
+			configFile = strings.TrimPrefix(args[i], "--config=")
+		case strings.HasPrefix(args[i], "--since"):
+			value := strings.TrimPrefix(args[i], "--since=")
+			if args[i] == "--since" && i+1 < len(args) {
+				value = args[i+1]
+				i++
+			}
+			var err error
+			if since, err = parseSince(value, time.Now()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		case args[i] == "--llm":
+			useLLM = true
+		case args[i] == "--yes" || args[i] == "-y":
+			yes = true
+		}
+	}
+
+	if configFile == "" {
+		for _, name := range []string{"docktor.yaml", "docktor.yml"} {
+			if _, err := os.Stat(name); err == nil {
+				configFile = name
+				break
+			}
+		}
+		if configFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: no docktor.yaml in the current directory; pass --config FILE\n")
+			os.Exit(1)
+		}
+	}
+
+	cfg, st := cliConfig(args)
+	if serviceName == "" {
+		if len(cfg.Services) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: --service is required when more than one service is configured\n")
+			os.Exit(1)
+		}
+		serviceName = cfg.Services[0].Name
+	}
+	svc, ok := cfg.service(serviceName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: service %s is not configured in %s\n", serviceName, configFile)
+		os.Exit(1)
+	}
+
+	decisions, err := readDecisions(st.Decisions, svc.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Cannot open decision log: %v\n", err)
+		fmt.Fprintf(os.Stderr, "The daemon may not have run yet or no decisions have been logged.\n")
+		os.Exit(1)
+	}
+	decisions = slices.DeleteFunc(decisions, func(d decisionRecord) bool {
+		return len(d.Observations) == 0 || d.Time().Before(since)
+	})
+	if len(decisions) < minSuggestSamples {
+		fmt.Fprintf(os.Stderr, "✗ Only %d recorded checks of %s have observations (need %d); let the daemon run longer or widen --since\n",
+			len(decisions), svc.Name, minSuggestSamples)
+		os.Exit(1)
+	}
+	sort.SliceStable(decisions, func(i, j int) bool { return decisions[i].Time().Before(decisions[j].Time()) })
+
+	stats := observationStats(decisions)
+	fmt.Printf("Analyzing %d checks of %s (%s to %s)\n\n", len(decisions), svc.Name,
+		decisions[0].Time().Format("2006-01-02 15:04"), decisions[len(decisions)-1].Time().Format("2006-01-02 15:04"))
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("  %-24s %10s %10s %10s %10s %10s\n", "METRIC", "P10", "P50", "P90", "P95", "MAX")
+	for _, name := range names {
+		m := stats[name]
+		fmt.Printf("  %-24s %10.4g %10.4g %10.4g %10.4g %10.4g\n", name, m.P10, m.P50, m.P90, m.P95, m.Max)
+	}
+
+	suggestion := suggestRules(cfg, svc, decisions, stats)
+	source := "built-in analysis"
+	if useLLM {
+		ctx, cancel := context.WithTimeout(context.Background(), suggestTimeout)
+		client, err := newLLMClient(cfg.LLM)
+		var fromLLM *ruleSuggestion
+		if err == nil {
+			fromLLM, err = suggestLLM(ctx, client, svc, stats, analyzeDecisions(cfg, decisions), suggestion)
+		}
+		cancel()
+		if err != nil {
+			fmt.Printf("\n(model %s unavailable: %v; using the built-in suggestion)\n", cfg.LLM.Model, err)
+		} else {
+			suggestion, source = *fromLLM, "model "+cfg.LLM.Model
+		}
+	}
+	fmt.Printf("\nSuggestion (%s):\n", source)
+	for _, note := range suggestion.Notes {
+		fmt.Printf("  • %s\n", note)
+	}
+
+	// Edit the file as written, not the loaded config with its defaults and resolved paths
+	var raw Config
+	if err := readConfigFile(configFile, &raw); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	i := slices.IndexFunc(raw.Services, func(s ServiceConfig) bool { return s.Name == svc.Name })
+	if i < 0 {
+		if len(raw.Services) > 0 || raw.Service != svc.Name {
+			fmt.Fprintf(os.Stderr, "Error: service %s is not configured in %s\n", svc.Name, configFile)
+			os.Exit(1)
+		}
+		fmt.Printf("\n⚠ %s uses the legacy service/scaling format; the suggestion adds a services entry, which takes precedence\n", configFile)
+		raw.Services = []ServiceConfig{raw.legacyService()}
+		i = 0
+	}
+	raw.Services[i].Rules = suggestion.Rules
+	raw.Services[i].MinReplicas = suggestion.MinReplicas
+	raw.Services[i].MaxReplicas = suggestion.MaxReplicas
+
+	before, after, err := renderConfigFile(configFile, raw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if bytes.Equal(before, after) {
+		fmt.Printf("\n✓ %s already matches the suggestion\n", configFile)
+		return
+	}
+	fmt.Printf("\n--- %s\n+++ %s (suggested)\n", configFile, configFile)
+	for _, line := range lineDiff(strings.Split(string(before), "\n"), strings.Split(string(after), "\n")) {
+		fmt.Println(line)
+	}
+
+	if !yes {
+		fmt.Printf("\nApply to %s? [y/N] ", configFile)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Not applied.")
+			return
+		}
+	}
+	if err := SaveConfig(configFile, raw); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := LoadConfig(configFile); err != nil {
+		os.WriteFile(configFile, before, 0644)
+		fmt.Fprintf(os.Stderr, "✗ The updated config does not load (%v); restored %s\n", err, configFile)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Updated %s\n", configFile)
+	fmt.Println("  A running daemon reloads it automatically (unless started with --no-watch)")
+}
+
+// observationStats returns the percentiles of every metric recorded in the decisions
+func observationStats(decisions []decisionRecord) map[string]metricStats {
+	values := map[string][]float64{}
+	for _, d := range decisions {
+		for name, v := range d.Observations {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				values[name] = append(values[name], v)
+			}
+		}
+	}
+	stats := make(map[string]metricStats, len(values))
+	for name, vs := range values {
+		sort.Float64s(vs)
+		stats[name] = metricStats{
+			Samples: len(vs),
+			Min:     vs[0],
+			P10:     percentile(vs, 10),
+			P25:     percentile(vs, 25),
+			P50:     percentile(vs, 50),
+			P75:     percentile(vs, 75),
+			P90:     percentile(vs, 90),
+			P95:     percentile(vs, 95),
+			Max:     vs[len(vs)-1],
+		}
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// suggestRules derives thresholds from the distribution of each metric in the current
+// rules: scale up when it is above its p90 (below its p10 for < conditions) and scale
+// down when it is below its p25 (above its p75), with a gap between the two. The bounds
+// follow the load that per-replica metrics (cpu.*, mem.*) imply, or how often the
+// service was pinned at a bound.
+func suggestRules(cfg Config, svc ServiceConfig, decisions []decisionRecord, stats map[string]metricStats) ruleSuggestion {
+	s := ruleSuggestion{MinReplicas: svc.MinReplicas, MaxReplicas: svc.MaxReplicas, Notes: []string{}}
+	ups := slices.Clone(svc.Rules.ScaleUpWhen)
+	downs := slices.Clone(svc.Rules.ScaleDownWhen)
+	if len(ups) == 0 && len(downs) == 0 {
+		if _, ok := stats["cpu.avg"]; ok {
+			ups = []Condition{{Metric: "cpu.avg", Op: ">"}}
+			downs = []Condition{{Metric: "cpu.avg", Op: "<"}}
+			s.Notes = append(s.Notes, "no rules configured: starting from cpu.avg")
+		}
+	}
+
+	threshold := func(c *Condition, up bool) {
+		m, ok := stats[c.Metric]
+		if !ok {
+			s.Notes = append(s.Notes, fmt.Sprintf("%s %s %g: kept, no recorded observations of %s", c.Metric, c.Op, c.Value, c.Metric))
+			return
+		}
+		var v float64
+		var from string
+		switch {
+		case (c.Op == ">" || c.Op == ">=") && up:
+			v, from = m.P90, "p90"
+		case c.Op == ">" || c.Op == ">=":
+			v, from = m.P75, "p75"
+		case (c.Op == "<" || c.Op == "<=") && up:
+			v, from = m.P10, "p10"
+		case c.Op == "<" || c.Op == "<=":
+			v, from = m.P25, "p25"
+		default:
+			return
+		}
+		old := c.Value
+		c.Value = niceRound(v)
+		s.Notes = append(s.Notes, fmt.Sprintf("%s %s %g (was %g): %s of %d checks", c.Metric, c.Op, c.Value, old, from, m.Samples))
+	}
+	for i := range ups {
+		threshold(&ups[i], true)
+	}
+	for i := range downs {
+		threshold(&downs[i], false)
+	}
+
+	// Keep scale-down clear of scale-up on the same metric, or one action triggers the other
+	for i, d := range downs {
+		for _, u := range ups {
+			if u.Metric != d.Metric || u.Value <= 0 {
+				continue
+			}
+			below := (d.Op == "<" || d.Op == "<=") && (u.Op == ">" || u.Op == ">=")
+			above := (d.Op == ">" || d.Op == ">=") && (u.Op == "<" || u.Op == "<=")
+			switch {
+			case below && d.Value > u.Value*suggestHysteresis:
+				downs[i].Value = niceRound(u.Value * suggestHysteresis)
+			case above && d.Value < u.Value/suggestHysteresis:
+				downs[i].Value = niceRound(u.Value / suggestHysteresis)
+			default:
+				continue
+			}
+			s.Notes = append(s.Notes, fmt.Sprintf("%s %s %g: moved away from the scale-up threshold %g so scaling does not flap",
+				d.Metric, d.Op, downs[i].Value, u.Value))
+		}
+	}
+	s.Rules = Rules{ScaleUpWhen: ups, ScaleDownWhen: downs}
+
+	// Replicas that keep every per-replica scale-up metric at or under its threshold
+	var needed []float64
+	for _, d := range decisions {
+		n := 0
+		for _, u := range ups {
+			v, ok := d.Observations[u.Metric]
+			if ok && perReplicaMetric(u.Metric) && (u.Op == ">" || u.Op == ">=") && u.Value > 0 && d.CurrentReplicas > 0 {
+				n = max(n, int(math.Ceil(v*float64(d.CurrentReplicas)/u.Value)))
+			}
+		}
+		if n > 0 {
+			needed = append(needed, float64(n))
+		}
+	}
+	var report *serviceReport
+	if reports := analyzeDecisions(cfg, decisions); len(reports) > 0 {
+		report = reports[0]
+	}
+
+	if len(needed) >= minSuggestSamples {
+		sort.Float64s(needed)
+		low, peak := int(percentile(needed, 10)), int(percentile(needed, 99))
+		if peak+1 > s.MaxReplicas {
+			s.MaxReplicas = peak + 1
+			s.Notes = append(s.Notes, fmt.Sprintf("max_replicas %d (was %d): the p99 load needs %d replicas to stay under the scale-up threshold, plus one for headroom",
+				s.MaxReplicas, svc.MaxReplicas, peak))
+		}
+		if low > s.MinReplicas {
+			s.MinReplicas = low
+			s.Notes = append(s.Notes, fmt.Sprintf("min_replicas %d (was %d): even the p10 load needs %d replicas", low, svc.MinReplicas, low))
+		}
+	} else if report != nil && report.AtMax > 0 && report.AtMax*4 >= report.Checks {
+		up, _ := cfg.Scaling.steps()
+		s.MaxReplicas += up
+		s.Notes = append(s.Notes, fmt.Sprintf("max_replicas %d (was %d): held at max_replicas in %d of %d checks",
+			s.MaxReplicas, svc.MaxReplicas, report.AtMax, report.Checks))
+	}
+	if report != nil && report.AtMin > 0 && report.AtMin*4 >= report.Checks && s.MinReplicas == svc.MinReplicas && s.MinReplicas > 1 {
+		s.MinReplicas--
+		s.Notes = append(s.Notes, fmt.Sprintf("min_replicas %d (was %d): held at min_replicas in %d of %d checks while scale-down rules matched",
+			s.MinReplicas, svc.MinReplicas, report.AtMin, report.Checks))
+	}
+	s.MaxReplicas = max(s.MaxReplicas, s.MinReplicas)
+	return s
+}
+
+// perReplicaMetric reports whether a metric is an average over the service's containers,
+// so that total load is roughly the value times the replicas
+func perReplicaMetric(name string) bool {
+	return strings.HasPrefix(name, "cpu.") || strings.HasPrefix(name, "mem.")
+}
+
+// niceRound rounds a threshold to a whole number, or to one decimal below 10
+func niceRound(v float64) float64 {
+	if math.Abs(v) >= 10 {
+		return math.Round(v)
+	}
+	return math.Round(v*10) / 10
+}
+
+// suggestLLM asks the configured model for rules and bounds, given the metric statistics,
+// the decision analysis and the built-in suggestion
+func suggestLLM(ctx context.Context, client llm.Client, svc ServiceConfig, stats map[string]metricStats, reports []*serviceReport, builtin ruleSuggestion) (*ruleSuggestion, error) {
+	submit := objectSchema(schema{
+		"scale_up_when":   schema{"type": "array", "items": conditionSchema},
+		"scale_down_when": schema{"type": "array", "items": conditionSchema},
+		"min_replicas":    schema{"type": "integer", "minimum": 1},
+		"max_replicas":    schema{"type": "integer", "minimum": 1},
+		"rationale":       schema{"type": "string"},
+	}, "scale_up_when", "scale_down_when", "min_replicas", "max_replicas", "rationale")
+	input, err := json.MarshalIndent(map[string]interface{}{
+		"service": svc.Name,
+		"current": map[string]interface{}{
+			"min_replicas": svc.MinReplicas, "max_replicas": svc.MaxReplicas,
+			"cooldown_sec": svc.Cooldown, "rules": svc.Rules,
+		},
+		"metrics":            stats,
+		"analysis":           reports,
+		"builtin_suggestion": builtin,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	messages := []llm.Message{
+		{Role: "system", Content: "You help an operator tune the autoscaling rules of a Docker Compose service. You get percentiles " +
+			"of the metrics recorded at each check, an analysis of past decisions and a statistical suggestion. Scale-up conditions " +
+			"are OR'ed and scale-down conditions AND'ed. Propose thresholds with a clear gap between scale-up and scale-down so the " +
+			"service does not flap, and replica bounds that cover the observed load. Only use the listed metrics. " +
+			"Call submit_suggestion once, with a rationale of at most three sentences."},
+		{Role: "user", Content: string(input)},
+	}
+
+	var answer *ruleSuggestion
+	handle := func(ctx context.Context, call llm.ToolCall) (string, bool) {
+		if call.Function.Name != "submit_suggestion" {
+			return "unknown tool: " + call.Function.Name, false
+		}
+		args := json.RawMessage(call.Function.Arguments)
+		if err := validateArguments(submit, args); err != nil {
+			return "invalid suggestion: " + err.Error(), false
+		}
+		var in struct {
+			Rules
+			MinReplicas int    `json:"min_replicas"`
+			MaxReplicas int    `json:"max_replicas"`
+			Rationale   string `json:"rationale"`
+		}
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "invalid suggestion: " + err.Error(), false
+		}
+		if in.MaxReplicas < in.MinReplicas {
+			return "invalid suggestion: max_replicas must be >= min_replicas", false
+		}
+		for _, c := range append(slices.Clone(in.ScaleUpWhen), in.ScaleDownWhen...) {
+			if _, ok := stats[c.Metric]; !ok {
+				return fmt.Sprintf("invalid suggestion: metric %s was not recorded", c.Metric), false
+			}
+		}
+		answer = &ruleSuggestion{Rules: in.Rules, MinReplicas: in.MinReplicas, MaxReplicas: in.MaxReplicas, Notes: []string{in.Rationale}}
+		return "suggestion recorded", true
+	}
+	tools := []llm.Tool{{
+		Name:        "submit_suggestion",
+		Description: "Submit the suggested rules and replica bounds. Call exactly once.",
+		Parameters:  submit,
+	}}
+	if _, err := llm.Run(ctx, client, messages, tools, handle, llmMaxRounds); err != nil {
+		return nil, err
+	}
+	if answer == nil {
+		return nil, fmt.Errorf("model answered without submit_suggestion")
+	}
+	return answer, nil
+}
+
+// diffLine is one line of a line diff: kind is ' ' (unchanged), '-' or '+'
+type diffLine struct {
+	kind byte
+	line string
+}
+
+// diffLines returns a line diff of a and b, based on their longest common subsequence
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffLine{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffLine{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// lineDiff returns the changed lines of a and b with a little context, prefixed with
+// "-", "+" or " "
+func lineDiff(a, b []string) []string {
+	ops := diffLines(a, b)
+	var out []string
+	last := -1
+	for k, op := range ops {
+		near := false
+		for c := max(k-diffContext, 0); c <= min(k+diffContext, len(ops)-1); c++ {
+			near = near || ops[c].kind != ' '
+		}
+		if !near {
+			continue
+		}
+		if last >= 0 && k > last+1 {
+			out = append(out, "  ...")
+		}
+		out = append(out, string(op.kind)+" "+op.line)
+		last = k
+	}
+	return out
+}
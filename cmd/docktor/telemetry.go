@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/metrics"
+)
+
+// MetricsConfig configures the Prometheus endpoint
+type MetricsConfig struct {
+	Listen string `yaml:"listen,omitempty"` // host:port serving /metrics (default: off; /metrics is always on the API)
+}
+
+// daemonMetrics are the Prometheus metrics exported by the daemon
+type daemonMetrics struct {
+	registry *metrics.Registry
+
+	replicas          *metrics.GaugeVec
+	desiredReplicas   *metrics.GaugeVec
+	observation       *metrics.GaugeVec
+	paused            *metrics.GaugeVec
+	leader            *metrics.GaugeVec
+	scaleActions      *metrics.CounterVec
+	iterations        *metrics.CounterVec
+	iterationErrors   *metrics.CounterVec
+	queueErrors       *metrics.CounterVec
+	sourceErrors      *metrics.CounterVec
+	iterationDuration *metrics.HistogramVec
+}
+
+// newDaemonMetrics registers all daemon metric families
+func newDaemonMetrics() *daemonMetrics {
+	r := metrics.NewRegistry()
+	return &daemonMetrics{
+		registry:        r,
+		replicas:        r.NewGauge("docktor_replicas", "Running replicas of the service seen by the last check.", "service"),
+		desiredReplicas: r.NewGauge("docktor_desired_replicas", "Replica count the last decision asked for.", "service"),
+		observation:     r.NewGauge("docktor_observation", "Last observed value of a metric used by the scaling rules.", "service", "metric"),
+		paused:          r.NewGauge("docktor_service_paused", "1 if scheduled checks of the service are paused.", "service"),
+		leader:          r.NewGauge("docktor_leader", "1 if this daemon holds the leader lease and may scale."),
+		scaleActions: r.NewCounter("docktor_scale_actions_total",
+			"Scale actions by direction and result (success, failed, shadow, proposed).", "service", "direction", "result"),
+		iterations:      r.NewCounter("docktor_iterations_total", "Completed scaling checks.", "service"),
+		iterationErrors: r.NewCounter("docktor_iteration_errors_total", "Scaling checks aborted by an error, by stage.", "service", "stage"),
+		queueErrors:     r.NewCounter("docktor_queue_errors_total", "Failed queue metric collections.", "service", "kind"),
+		sourceErrors:    r.NewCounter("docktor_source_errors_total", "Failed or partial collections from metric sources, by namespace.", "service", "source"),
+		iterationDuration: r.NewHistogram("docktor_iteration_duration_seconds",
+			"Duration of a scaling check, including the metrics window and any scale command.", metrics.DefaultBuckets, "service"),
+	}
+}
+
+// recordObservations exports the namespaced observations of a check (e.g. cpu.avg,
+// queue.backlog); un-namespaced names are left out to bound cardinality. Metrics the
+// check did not report are dropped rather than exported with their last value.
+func (dm *daemonMetrics) recordObservations(service string, observations map[string]float64) {
+	dm.observation.DeleteLabel("service", service)
+	for name, value := range observations {
+		if strings.Contains(name, ".") {
+			dm.observation.Set(value, service, name)
+		}
+	}
+}
+
+// recordScaleAction counts a scale action; hold decisions are not actions
+func (dm *daemonMetrics) recordScaleAction(service, action, result string) {
+	direction := strings.TrimPrefix(action, "scale_")
+	if direction == action {
+		return
+	}
+	dm.scaleActions.Inc(service, direction, result)
+}
+
+// forgetService drops all series of a service that is no longer monitored
+func (dm *daemonMetrics) forgetService(service string) {
+	dm.registry.DeleteLabel("service", service)
+}
+
+// startMetricsServer serves /metrics on a dedicated TCP listener for Prometheus
+func (d *daemon) startMetricsServer(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", d.metrics.registry.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			d.logf("ERROR: metrics server: %v", err)
+		}
+	}()
+	d.logf("Prometheus metrics on http://%s/metrics", l.Addr())
+	return nil
+}
@@ -2,12 +2,15 @@ module github.com/hwclass/docktor
 
 go 1.23.2
 
+require (
+	github.com/nats-io/nats.go v1.47.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/klauspost/compress v1.18.0 // indirect
-	github.com/nats-io/nats.go v1.47.0 // indirect
 	github.com/nats-io/nkeys v0.4.11 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
 	golang.org/x/crypto v0.37.0 // indirect
 	golang.org/x/sys v0.32.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,487 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Labels set by docker compose on every container it creates
+const (
+	LabelProject    = "com.docker.compose.project"
+	LabelService    = "com.docker.compose.service"
+	LabelConfigHash = "com.docker.compose.config-hash"
+)
+
+// defaultFiles are looked up in the working directory when no file is given
+var defaultFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// Options mirrors the global flags of `docker compose` (-f, -p, --profile, --env-file)
+type Options struct {
+	Files       []string // Compose files, merged in order
+	ProjectName string   // Explicit project name (overrides everything else)
+	Profiles    []string // Active profiles
+	EnvFile     string   // Env file for interpolation (default: .env next to the first file)
+}
+
+// Project is the resolved compose model
+type Project struct {
+	Name       string
+	WorkingDir string
+	Files      []string
+	Profiles   []string
+	EnvFile    string
+	Services   map[string]Service // Services enabled by the active profiles
+	Inactive   map[string]Service // Services disabled because none of their profiles is active
+}
+
+// Service holds the parts of a compose service that matter for scaling
+type Service struct {
+	Name          string
+	Image         string
+	ContainerName string
+	Profiles      []string
+	Ports         []Port
+	Replicas      *int // deploy.replicas, if set
+	Labels        map[string]string
+}
+
+// Port is a single entry of a service's ports list
+type Port struct {
+	HostIP    string
+	Published string // Host port or range; empty if not published
+	Target    string
+	Protocol  string
+}
+
+// Fixed reports whether the port binds a single host port, which only one replica can hold
+func (p Port) Fixed() bool {
+	return p.Published != "" && p.Published != "0" && !strings.Contains(p.Published, "-")
+}
+
+func (p Port) String() string {
+	s := p.Target
+	if p.Published != "" {
+		s = p.Published + ":" + s
+		if p.HostIP != "" {
+			s = p.HostIP + ":" + s
+		}
+	}
+	if p.Protocol != "" && p.Protocol != "tcp" {
+		s += "/" + p.Protocol
+	}
+	return s
+}
+
+// ScalingBlockers returns the reasons why this service cannot run more than one replica
+func (s Service) ScalingBlockers() []string {
+	var blockers []string
+	if s.ContainerName != "" {
+		blockers = append(blockers, fmt.Sprintf("fixed container_name %q", s.ContainerName))
+	}
+	for _, p := range s.Ports {
+		if p.Fixed() {
+			blockers = append(blockers, fmt.Sprintf("fixed host port binding %q", p.String()))
+		}
+	}
+	return blockers
+}
+
+// Args returns the global `docker compose` arguments that select this project
+func (p *Project) Args() []string {
+	args := []string{"compose", "-p", p.Name}
+	for _, f := range p.Files {
+		args = append(args, "-f", f)
+	}
+	for _, profile := range p.Profiles {
+		args = append(args, "--profile", profile)
+	}
+	if p.EnvFile != "" && fileExists(p.EnvFile) {
+		args = append(args, "--env-file", p.EnvFile)
+	}
+	return args
+}
+
+// Load parses and merges the compose files, resolving extends, profiles,
+// .env interpolation and the project name
+func Load(opts Options) (*Project, error) {
+	files, err := resolveFiles(opts.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	workingDir := filepath.Dir(files[0])
+
+	envFile := opts.EnvFile
+	if envFile == "" {
+		envFile = filepath.Join(workingDir, ".env")
+	} else if !filepath.IsAbs(envFile) {
+		envFile, _ = filepath.Abs(envFile)
+	}
+	env, err := loadEnvFile(envFile)
+	if err != nil {
+		return nil, err
+	}
+	// Shell environment takes precedence over the .env file
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	l := &loader{env: env, cache: map[string]map[string]interface{}{}}
+
+	topName := ""
+	merged := map[string]interface{}{}
+	for _, file := range files {
+		doc, err := l.load(file)
+		if err != nil {
+			return nil, err
+		}
+		if name, ok := doc["name"].(string); ok && name != "" {
+			topName = name
+		}
+		services, err := l.services(file, doc)
+		if err != nil {
+			return nil, err
+		}
+		for name, svc := range services {
+			if existing, ok := merged[name].(map[string]interface{}); ok {
+				merged[name] = mergeService(existing, svc)
+			} else {
+				merged[name] = svc
+			}
+		}
+	}
+
+	profiles := opts.Profiles
+	if len(profiles) == 0 && env["COMPOSE_PROFILES"] != "" {
+		profiles = strings.Split(env["COMPOSE_PROFILES"], ",")
+	}
+
+	project := &Project{
+		Name:       projectName(opts.ProjectName, env["COMPOSE_PROJECT_NAME"], topName, workingDir),
+		WorkingDir: workingDir,
+		Files:      files,
+		Profiles:   profiles,
+		EnvFile:    envFile,
+		Services:   map[string]Service{},
+		Inactive:   map[string]Service{},
+	}
+
+	for name, raw := range merged {
+		svc := toService(name, raw.(map[string]interface{}))
+		if profileActive(svc.Profiles, profiles) {
+			project.Services[name] = svc
+		} else {
+			project.Inactive[name] = svc
+		}
+	}
+
+	return project, nil
+}
+
+// ServiceNames returns the enabled service names in sorted order
+func (p *Project) ServiceNames() []string {
+	names := make([]string, 0, len(p.Services))
+	for name := range p.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func resolveFiles(files []string) ([]string, error) {
+	if len(files) == 0 {
+		if env := os.Getenv("COMPOSE_FILE"); env != "" {
+			files = filepath.SplitList(env)
+		}
+	}
+	if len(files) == 0 {
+		for _, f := range defaultFiles {
+			if fileExists(f) {
+				files = []string{f}
+				break
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no compose file found")
+	}
+
+	resolved := make([]string, 0, len(files))
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		if !fileExists(abs) {
+			return nil, fmt.Errorf("compose file not found: %s", abs)
+		}
+		resolved = append(resolved, abs)
+	}
+	return resolved, nil
+}
+
+// loader reads and interpolates compose files, caching them for extends lookups
+type loader struct {
+	env   map[string]string
+	cache map[string]map[string]interface{}
+}
+
+func (l *loader) load(file string) (map[string]interface{}, error) {
+	if doc, ok := l.cache[file]; ok {
+		return doc, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	if _, err := interpolateValue(doc, l.env); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	l.cache[file] = doc
+	return doc, nil
+}
+
+// services returns the services of one file with extends resolved
+func (l *loader) services(file string, doc map[string]interface{}) (map[string]map[string]interface{}, error) {
+	raw, _ := doc["services"].(map[string]interface{})
+	out := make(map[string]map[string]interface{}, len(raw))
+	for name := range raw {
+		svc, err := l.resolveService(file, name, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		out[name] = svc
+	}
+	return out, nil
+}
+
+// resolveService returns a service definition with its extends chain merged in
+func (l *loader) resolveService(file, name string, seen map[string]bool) (map[string]interface{}, error) {
+	key := file + "#" + name
+	if seen[key] {
+		return nil, fmt.Errorf("circular extends for service %q in %s", name, file)
+	}
+	seen[key] = true
+
+	doc, err := l.load(file)
+	if err != nil {
+		return nil, err
+	}
+	services, _ := doc["services"].(map[string]interface{})
+	svc, ok := services[name].(map[string]interface{})
+	if !ok {
+		if _, exists := services[name]; exists {
+			return map[string]interface{}{}, nil // Empty service definition
+		}
+		return nil, fmt.Errorf("service %q not found in %s", name, file)
+	}
+
+	ext, hasExtends := svc["extends"]
+	if !hasExtends {
+		return copyMap(svc), nil
+	}
+
+	baseFile, baseName := file, ""
+	switch e := ext.(type) {
+	case string:
+		baseName = e
+	case map[string]interface{}:
+		baseName, _ = e["service"].(string)
+		if f, ok := e["file"].(string); ok && f != "" {
+			baseFile = f
+			if !filepath.IsAbs(baseFile) {
+				baseFile = filepath.Join(filepath.Dir(file), baseFile)
+			}
+		}
+	}
+	if baseName == "" {
+		return nil, fmt.Errorf("service %q: extends requires a service name", name)
+	}
+
+	base, err := l.resolveService(baseFile, baseName, seen)
+	if err != nil {
+		return nil, fmt.Errorf("service %q: %w", name, err)
+	}
+
+	own := copyMap(svc)
+	delete(own, "extends")
+	return mergeService(base, own), nil
+}
+
+// mergeService overlays override onto base following compose merge rules:
+// mappings are merged, ports/expose/profiles are appended, everything else is replaced
+func mergeService(base, override map[string]interface{}) map[string]interface{} {
+	out := copyMap(base)
+	for k, v := range override {
+		switch k {
+		case "ports", "expose", "profiles":
+			prev, _ := out[k].([]interface{})
+			next, _ := v.([]interface{})
+			out[k] = appendUnique(prev, next)
+			continue
+		}
+		if bm, ok := out[k].(map[string]interface{}); ok {
+			if om, ok := v.(map[string]interface{}); ok {
+				out[k] = mergeService(bm, om)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func appendUnique(a, b []interface{}) []interface{} {
+	out := append([]interface{}{}, a...)
+	seen := map[string]bool{}
+	for _, v := range a {
+		seen[fmt.Sprint(v)] = true
+	}
+	for _, v := range b {
+		if !seen[fmt.Sprint(v)] {
+			out = append(out, v)
+			seen[fmt.Sprint(v)] = true
+		}
+	}
+	return out
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func toService(name string, raw map[string]interface{}) Service {
+	svc := Service{Name: name, Labels: map[string]string{}}
+	svc.Image, _ = raw["image"].(string)
+	svc.ContainerName, _ = raw["container_name"].(string)
+
+	if list, ok := raw["profiles"].([]interface{}); ok {
+		for _, p := range list {
+			svc.Profiles = append(svc.Profiles, fmt.Sprint(p))
+		}
+	}
+
+	if list, ok := raw["ports"].([]interface{}); ok {
+		for _, p := range list {
+			svc.Ports = append(svc.Ports, parsePort(p))
+		}
+	}
+
+	if deploy, ok := raw["deploy"].(map[string]interface{}); ok {
+		if n, err := strconv.Atoi(fmt.Sprint(deploy["replicas"])); err == nil {
+			svc.Replicas = &n
+		}
+	}
+
+	switch labels := raw["labels"].(type) {
+	case map[string]interface{}:
+		for k, v := range labels {
+			svc.Labels[k] = fmt.Sprint(v)
+		}
+	case []interface{}:
+		for _, kv := range labels {
+			k, v, _ := strings.Cut(fmt.Sprint(kv), "=")
+			svc.Labels[k] = v
+		}
+	}
+
+	return svc
+}
+
+// parsePort handles both the short ("[ip:]host:container[/proto]") and long port syntax
+func parsePort(v interface{}) Port {
+	if m, ok := v.(map[string]interface{}); ok {
+		p := Port{Target: fmt.Sprint(m["target"])}
+		if pub, ok := m["published"]; ok && pub != nil {
+			p.Published = fmt.Sprint(pub)
+		}
+		p.HostIP, _ = m["host_ip"].(string)
+		p.Protocol, _ = m["protocol"].(string)
+		return p
+	}
+
+	s := fmt.Sprint(v)
+	p := Port{}
+	if spec, proto, ok := strings.Cut(s, "/"); ok {
+		s, p.Protocol = spec, proto
+	}
+
+	// IPv6 host addresses are wrapped in brackets
+	if strings.HasPrefix(s, "[") {
+		if end := strings.Index(s, "]:"); end > 0 {
+			p.HostIP = s[1:end]
+			s = s[end+2:]
+		}
+	}
+
+	parts := strings.Split(s, ":")
+	switch len(parts) {
+	case 1:
+		p.Target = parts[0]
+	case 2:
+		p.Published, p.Target = parts[0], parts[1]
+	default:
+		p.HostIP, p.Published, p.Target = parts[0], parts[1], parts[2]
+	}
+	return p
+}
+
+func profileActive(serviceProfiles, active []string) bool {
+	if len(serviceProfiles) == 0 {
+		return true
+	}
+	for _, sp := range serviceProfiles {
+		for _, ap := range active {
+			if ap == "*" || sp == ap {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// projectName resolves the project name with the same precedence as docker compose:
+// -p flag, COMPOSE_PROJECT_NAME, top-level name, then the working directory name
+func projectName(explicit, env, top, workingDir string) string {
+	for _, candidate := range []string{explicit, env, top} {
+		if candidate != "" {
+			return NormalizeProjectName(candidate)
+		}
+	}
+	return NormalizeProjectName(filepath.Base(workingDir))
+}
+
+// NormalizeProjectName lowercases a name and strips characters compose does not allow
+func NormalizeProjectName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimLeft(b.String(), "_-")
+}
+
+func fileExists(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir()
+}
@@ -0,0 +1,112 @@
+package compose
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Container is a container discovered through its compose labels
+type Container struct {
+	ID      string
+	Name    string
+	Project string
+	Service string
+	State   string // "running", "exited", ...
+	Labels  map[string]string
+}
+
+// Running reports whether the container is currently running
+func (c Container) Running() bool {
+	return c.State == "running"
+}
+
+// ConfigHash returns the compose config hash the container was created with
+func (c Container) ConfigHash() string {
+	return c.Labels[LabelConfigHash]
+}
+
+// ListContainers returns all containers (running or not) that carry the project label
+// and every label of the optional selector
+func ListContainers(project string, selector map[string]string) ([]Container, error) {
+	args := []string{"ps", "-a", "--no-trunc", "--format", "{{json .}}",
+		"--filter", "label=" + LabelProject + "=" + project}
+
+	keys := make([]string, 0, len(selector))
+	for k := range selector {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if selector[k] == "" {
+			args = append(args, "--filter", "label="+k)
+		} else {
+			args = append(args, "--filter", "label="+k+"="+selector[k])
+		}
+	}
+
+	out, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker ps: %w", err)
+	}
+	return parsePS(out)
+}
+
+// parsePS parses `docker ps --format '{{json .}}'` output
+func parsePS(out []byte) ([]Container, error) {
+	var containers []Container
+
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row struct {
+			ID     string `json:"ID"`
+			Names  string `json:"Names"`
+			State  string `json:"State"`
+			Labels string `json:"Labels"`
+		}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return nil, fmt.Errorf("failed to parse docker ps output: %w", err)
+		}
+		labels := parseLabels(row.Labels)
+		containers = append(containers, Container{
+			ID:      row.ID,
+			Name:    strings.Split(row.Names, ",")[0],
+			Project: labels[LabelProject],
+			Service: labels[LabelService],
+			State:   row.State,
+			Labels:  labels,
+		})
+	}
+
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers, sc.Err()
+}
+
+// parseLabels parses docker's "k=v,k=v" label list. Values may themselves contain
+// commas (e.g. the list of config files), so fragments without "=" are appended
+// to the previous value.
+func parseLabels(s string) map[string]string {
+	labels := map[string]string{}
+	last := ""
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok {
+			if last != "" {
+				labels[last] += "," + part
+			}
+			continue
+		}
+		labels[k] = v
+		last = k
+	}
+	return labels
+}
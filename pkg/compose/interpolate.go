@@ -0,0 +1,178 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadEnvFile reads KEY=VALUE lines from a .env file. Missing files are not an error.
+func loadEnvFile(path string) (map[string]string, error) {
+	env := map[string]string{}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return env, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[key] = value
+	}
+	return env, sc.Err()
+}
+
+// interpolate expands $VAR, ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:?err},
+// ${VAR?err} and $$ the same way docker compose does
+func interpolate(s string, env map[string]string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		next := s[i+1]
+		switch {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s[i+2:])
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable in %q", s)
+			}
+			expr := s[i+2 : i+2+end]
+			value, err := expandExpr(expr, env)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i += 2 + end
+		case isNameChar(next, true):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j], false) {
+				j++
+			}
+			b.WriteString(env[s[i+1:j]])
+			i = j - 1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the brace closing a ${ opened just before s,
+// skipping nested ${...} in defaults and error messages, or -1
+func closingBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '$':
+			i++
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// expandExpr evaluates the body of a ${...} expression. The operator is read right
+// after the variable name, so operators inside a nested default are left alone.
+func expandExpr(expr string, env map[string]string) (string, error) {
+	n := 0
+	for n < len(expr) && isNameChar(expr[n], n == 0) {
+		n++
+	}
+	name, rest := expr[:n], expr[n:]
+	if rest == "" {
+		return env[name], nil
+	}
+	for _, op := range []string{":-", ":?", "-", "?"} {
+		arg, ok := strings.CutPrefix(rest, op)
+		if !ok {
+			continue
+		}
+		value, set := env[name]
+		unset := !set || (strings.HasPrefix(op, ":") && value == "")
+		if !unset {
+			return value, nil
+		}
+		if strings.HasSuffix(op, "?") {
+			if arg == "" {
+				arg = "required variable is missing a value"
+			}
+			return "", fmt.Errorf("%s: %s", name, arg)
+		}
+		return interpolate(arg, env)
+	}
+	return "", fmt.Errorf("invalid variable expression ${%s}", expr)
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// interpolateValue walks a decoded YAML tree and interpolates every string
+func interpolateValue(v interface{}, env map[string]string) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return interpolate(t, env)
+	case map[string]interface{}:
+		for k, child := range t {
+			out, err := interpolateValue(child, env)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = out
+		}
+		return t, nil
+	case []interface{}:
+		for i, child := range t {
+			out, err := interpolateValue(child, env)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = out
+		}
+		return t, nil
+	default:
+		return v, nil
+	}
+}
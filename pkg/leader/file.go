@@ -0,0 +1,138 @@
+package leader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// staleGuardAge is when an abandoned guard file (crash during an update) is removed
+const staleGuardAge = 10 * time.Second
+
+// FileElector implements the Elector interface with a lease stored in a lock file.
+// Updates are serialized with an exclusively created guard file, so it works on any
+// filesystem that supports O_EXCL, including shared mounts for multi-host setups.
+type FileElector struct {
+	path     string
+	identity string
+	ttl      time.Duration
+}
+
+// NewFileElector creates a new lock file leader election backend
+func NewFileElector(cfg Config) (Elector, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("file leader election requires a lock file path")
+	}
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("file leader election requires a positive TTL")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.URL), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock dir: %w", err)
+	}
+	return &FileElector{path: cfg.URL, identity: cfg.Identity, ttl: cfg.TTL}, nil
+}
+
+// Acquire takes or renews the lease
+func (f *FileElector) Acquire() (bool, error) {
+	held := false
+	err := f.withGuard(func() error {
+		current, err := f.read()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if current != nil && current.Holder != f.identity && !current.Expired(now) {
+			return nil
+		}
+		if err := f.write(renew(current, f.identity, f.ttl, now)); err != nil {
+			return err
+		}
+		held = true
+		return nil
+	})
+	return held, err
+}
+
+// Current returns the lease in the lock file
+func (f *FileElector) Current() (*Lease, error) {
+	return f.read()
+}
+
+// Release removes the lease if this instance holds it
+func (f *FileElector) Release() error {
+	return f.withGuard(func() error {
+		current, err := f.read()
+		if err != nil || current == nil || current.Holder != f.identity {
+			return err
+		}
+		return os.Remove(f.path)
+	})
+}
+
+// Close is a no-op for the file backend
+func (f *FileElector) Close() error {
+	return nil
+}
+
+// withGuard runs fn while holding the guard file
+func (f *FileElector) withGuard(fn func() error) error {
+	guard := f.path + ".guard"
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		g, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			g.Close()
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to create guard file: %w", err)
+		}
+		if fi, statErr := os.Stat(guard); statErr == nil && time.Since(fi.ModTime()) > staleGuardAge {
+			os.Remove(guard)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s", guard)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer os.Remove(guard)
+	return fn()
+}
+
+// read returns the stored lease, or nil if there is none
+func (f *FileElector) read() (*Lease, error) {
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	lease, err := decodeLease(data)
+	if err != nil {
+		// A corrupt lock file cannot be honored; treat it as free
+		return nil, nil
+	}
+	return lease, nil
+}
+
+// write stores the lease atomically
+func (f *FileElector) write(l *Lease) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return os.Rename(tmp, f.path)
+}
+
+func init() {
+	Register("file", NewFileElector)
+}
@@ -0,0 +1,91 @@
+package leader
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Config represents leader election backend configuration
+type Config struct {
+	Kind       string            // "file", "nats"
+	URL        string            // Backend location (file: lock file path, nats: server URL)
+	Key        string            // Lock name, usually the compose project
+	Identity   string            // Who is asking (e.g. host:pid)
+	TTL        time.Duration     // How long a lease is valid without renewal
+	Attributes map[string]string // Backend-specific attributes
+}
+
+// Lease is the lock record stored by every backend
+type Lease struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the lease can be taken over
+func (l *Lease) Expired(now time.Time) bool {
+	return now.After(l.ExpiresAt)
+}
+
+// Elector interface for leader election backends.
+// Callers invoke Acquire periodically (well within the TTL) as a heartbeat.
+type Elector interface {
+	// Acquire takes the lease if it is free or expired, or renews it if already held.
+	// It reports whether this instance holds the lease afterwards.
+	Acquire() (bool, error)
+
+	// Current returns the current lease, or nil if nobody holds one
+	Current() (*Lease, error)
+
+	// Release gives up the lease if this instance holds it
+	Release() error
+
+	// Close releases backend resources (not the lease)
+	Close() error
+}
+
+// Registry holds all registered leader election backends
+var registry = make(map[string]func(Config) (Elector, error))
+
+// Register adds a leader election backend to the registry
+func Register(kind string, factory func(Config) (Elector, error)) {
+	registry[kind] = factory
+}
+
+// NewElector creates a leader election backend for the given config
+func NewElector(cfg Config) (Elector, error) {
+	factory, exists := registry[cfg.Kind]
+	if !exists {
+		return nil, &UnsupportedKindError{Kind: cfg.Kind}
+	}
+	return factory(cfg)
+}
+
+// UnsupportedKindError represents an unsupported leader election backend
+type UnsupportedKindError struct {
+	Kind string
+}
+
+func (e *UnsupportedKindError) Error() string {
+	return "unsupported leader election kind: " + e.Kind
+}
+
+// renew returns the lease this instance should write: a renewal of its own lease,
+// or a fresh one when taking over
+func renew(current *Lease, identity string, ttl time.Duration, now time.Time) *Lease {
+	acquired := now
+	if current != nil && current.Holder == identity {
+		acquired = current.AcquiredAt
+	}
+	return &Lease{Holder: identity, AcquiredAt: acquired, RenewedAt: now, ExpiresAt: now.Add(ttl)}
+}
+
+// decodeLease parses a stored lease
+func decodeLease(data []byte) (*Lease, error) {
+	var l Lease
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -0,0 +1,102 @@
+package leader
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func newFileElector(t *testing.T, path, identity string, ttl time.Duration) Elector {
+	t.Helper()
+	e, err := NewElector(Config{Kind: "file", URL: path, Key: "demo", Identity: identity, TTL: ttl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func mustAcquire(t *testing.T, e Elector, want bool) {
+	t.Helper()
+	got, err := e.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if got != want {
+		t.Fatalf("Acquire = %v, want %v", got, want)
+	}
+}
+
+func TestFileElectorTwoInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.lock")
+	a := newFileElector(t, path, "host-a:1", time.Minute)
+	b := newFileElector(t, path, "host-b:2", time.Minute)
+
+	mustAcquire(t, a, true)
+	mustAcquire(t, b, false)
+	first, err := b.Current()
+	if err != nil || first == nil || first.Holder != "host-a:1" {
+		t.Fatalf("Current = %+v, %v; want host-a:1", first, err)
+	}
+
+	// Renewing keeps the acquisition time and extends the lease
+	time.Sleep(10 * time.Millisecond)
+	mustAcquire(t, a, true)
+	renewed, _ := a.Current()
+	if !renewed.AcquiredAt.Equal(first.AcquiredAt) || !renewed.ExpiresAt.After(first.ExpiresAt) {
+		t.Errorf("renewal changed acquired_at or did not extend the lease: %+v → %+v", first, renewed)
+	}
+
+	// Only the holder can release
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	}
+	mustAcquire(t, b, false)
+	if err := a.Release(); err != nil {
+		t.Fatal(err)
+	}
+	mustAcquire(t, b, true)
+	mustAcquire(t, a, false)
+}
+
+func TestFileElectorExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "demo.lock")
+	a := newFileElector(t, path, "host-a:1", 50*time.Millisecond)
+	b := newFileElector(t, path, "host-b:2", 50*time.Millisecond)
+
+	mustAcquire(t, a, true)
+	mustAcquire(t, b, false)
+
+	// a stops renewing, e.g. because its host died
+	time.Sleep(80 * time.Millisecond)
+	mustAcquire(t, b, true)
+	mustAcquire(t, a, false)
+	if l, _ := a.Current(); l == nil || l.Holder != "host-b:2" || l.Expired(time.Now()) {
+		t.Errorf("Current = %+v, want a live lease of host-b:2", l)
+	}
+}
+
+func TestCASConflict(t *testing.T) {
+	wrongSequence := &nats.APIError{Code: 400, ErrorCode: nats.JSErrCodeStreamWrongLastSequence, Description: "wrong last sequence: 7"}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nats.ErrKeyExists, true},
+		{fmt.Errorf("%w: key exists", nats.ErrKeyExists), true},
+		{wrongSequence, true},
+		{fmt.Errorf("publish: %w", wrongSequence), true},
+		{&nats.APIError{Code: 503, ErrorCode: nats.JSErrCodeJetStreamNotEnabled}, false},
+		{nats.ErrTimeout, false},
+		{errors.New("connection closed"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := casConflict(tt.err); got != tt.want {
+			t.Errorf("casConflict(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package leader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// defaultBucket is the KV bucket used when none is configured
+const defaultBucket = "docktor_leader"
+
+// NATSElector implements the Elector interface with a NATS JetStream KV bucket.
+// Every write is a compare-and-swap on the key's revision, so two instances can
+// never both believe they took over the same expired lease.
+type NATSElector struct {
+	url      string
+	bucket   string
+	key      string
+	identity string
+	ttl      time.Duration
+	conn     *nats.Conn
+	kv       nats.KeyValue
+}
+
+// NewNATSElector creates a new NATS KV leader election backend
+func NewNATSElector(cfg Config) (Elector, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("NATS leader election requires 'url'")
+	}
+	if cfg.Key == "" {
+		return nil, fmt.Errorf("NATS leader election requires a lock key")
+	}
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("NATS leader election requires a positive TTL")
+	}
+	bucket := cfg.Attributes["bucket"]
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+
+	n := &NATSElector{url: cfg.URL, bucket: bucket, key: cfg.Key, identity: cfg.Identity, ttl: cfg.TTL}
+	if err := n.connect(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// connect opens the connection and the KV bucket, creating the bucket if needed
+func (n *NATSElector) connect() error {
+	conn, err := nats.Connect(n.url, nats.Timeout(5*time.Second))
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS at %s: %w", n.url, err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to get JetStream context: %w", err)
+	}
+	kv, err := js.KeyValue(n.bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: n.bucket, Description: "Docktor leader leases"})
+	}
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open KV bucket '%s': %w", n.bucket, err)
+	}
+	n.conn, n.kv = conn, kv
+	return nil
+}
+
+// Acquire takes or renews the lease with a compare-and-swap
+func (n *NATSElector) Acquire() (bool, error) {
+	current, revision, err := n.get()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if current != nil && current.Holder != n.identity && !current.Expired(now) {
+		return false, nil
+	}
+
+	data, err := json.Marshal(renew(current, n.identity, n.ttl, now))
+	if err != nil {
+		return false, err
+	}
+	if revision == 0 {
+		_, err = n.kv.Create(n.key, data)
+	} else {
+		_, err = n.kv.Update(n.key, data, revision)
+	}
+	if err != nil {
+		// Someone else wrote the key first; they won this round
+		if casConflict(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to write lease: %w", err)
+	}
+	return true, nil
+}
+
+// casConflict reports whether a write lost a compare-and-swap race. Create reports it
+// as ErrKeyExists, but Update on a stale revision returns the server's wrong last
+// sequence API error.
+func casConflict(err error) bool {
+	if errors.Is(err, nats.ErrKeyExists) {
+		return true
+	}
+	var apiErr *nats.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence
+}
+
+// Current returns the lease stored in the bucket
+func (n *NATSElector) Current() (*Lease, error) {
+	lease, _, err := n.get()
+	return lease, err
+}
+
+// Release deletes the lease if this instance still holds it
+func (n *NATSElector) Release() error {
+	current, revision, err := n.get()
+	if err != nil || current == nil || current.Holder != n.identity {
+		return err
+	}
+	err = n.kv.Delete(n.key, nats.LastRevision(revision))
+	if casConflict(err) {
+		// The lease changed since it was read (taken over), so it is not ours to delete
+		return nil
+	}
+	return err
+}
+
+// Close closes the NATS connection
+func (n *NATSElector) Close() error {
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	return nil
+}
+
+// get returns the lease and its revision (0 if the key does not exist)
+func (n *NATSElector) get() (*Lease, uint64, error) {
+	entry, err := n.kv.Get(n.key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read lease: %w", err)
+	}
+	if len(entry.Value()) == 0 {
+		// Deleted keys keep a revision; the next write must still be a CAS on it
+		return nil, entry.Revision(), nil
+	}
+	lease, err := decodeLease(entry.Value())
+	if err != nil {
+		return nil, entry.Revision(), nil
+	}
+	return lease, entry.Revision(), nil
+}
+
+func init() {
+	Register("nats", NewNATSElector)
+}
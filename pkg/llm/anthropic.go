@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 4096
+)
+
+// Anthropic is a client for Anthropic-style /messages APIs
+type Anthropic struct {
+	BaseURL string // e.g. https://api.anthropic.com/v1
+	APIKey  string // Sent as x-api-key
+	Model   string
+	HTTP    *http.Client
+}
+
+// anthropicBlock is one content block of a message
+type anthropicBlock struct {
+	Type      string          `json:"type"` // text, tool_use or tool_result
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"` // user or assistant
+	Content []anthropicBlock `json:"content"`
+}
+
+func (c *Anthropic) headers() map[string]string {
+	return map[string]string{"x-api-key": c.APIKey, "anthropic-version": anthropicVersion}
+}
+
+// Chat sends one /messages request. System messages become the system prompt and tool
+// results are sent as tool_result blocks of a user message.
+func (c *Anthropic) Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	var system []string
+	var converted []anthropicMessage
+	add := func(role string, blocks ...anthropicBlock) {
+		if n := len(converted); n > 0 && converted[n-1].Role == role {
+			converted[n-1].Content = append(converted[n-1].Content, blocks...)
+			return
+		}
+		converted = append(converted, anthropicMessage{Role: role, Content: blocks})
+	}
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			system = append(system, m.Content)
+		case "tool":
+			add("user", anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		case "assistant":
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+			add("assistant", blocks...)
+		default:
+			add("user", anthropicBlock{Type: "text", Text: m.Content})
+		}
+	}
+
+	body := map[string]interface{}{
+		"model":       c.Model,
+		"max_tokens":  anthropicMaxTokens,
+		"messages":    converted,
+		"temperature": 0,
+	}
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+	if len(tools) > 0 {
+		defs := make([]map[string]interface{}, len(tools))
+		for i, t := range tools {
+			defs[i] = map[string]interface{}{"name": t.Name, "description": t.Description, "input_schema": t.Parameters}
+		}
+		body["tools"] = defs
+	}
+
+	var out struct {
+		Content []anthropicBlock `json:"content"`
+	}
+	if err := doJSON(ctx, c.HTTP, http.MethodPost, c.BaseURL+"/messages", c.headers(), body, &out); err != nil {
+		return nil, err
+	}
+	msg := &Message{Role: "assistant"}
+	var text []string
+	for _, b := range out.Content {
+		switch b.Type {
+		case "text":
+			text = append(text, b.Text)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       b.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: b.Name, Arguments: string(b.Input)},
+			})
+		}
+	}
+	msg.Content = strings.Join(text, "\n")
+	return msg, nil
+}
+
+// Models lists the models of GET /models
+func (c *Anthropic) Models(ctx context.Context) ([]string, error) {
+	var out struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := doJSON(ctx, c.HTTP, http.MethodGet, c.BaseURL+"/models?limit=1000", c.headers(), nil, &out); err != nil {
+		return nil, err
+	}
+	models := make([]string, len(out.Data))
+	for i, m := range out.Data {
+		models[i] = m.ID
+	}
+	return models, nil
+}
+
+func init() {
+	Register(Provider{
+		Name:           "anthropic",
+		Title:          "Anthropic",
+		DefaultBaseURL: "https://api.anthropic.com/v1",
+		KeyEnv:         "ANTHROPIC_API_KEY",
+		KeyRequired:    true,
+		New: func(cfg Config) Client {
+			return &Anthropic{BaseURL: cfg.BaseURL, APIKey: cfg.APIKey, Model: cfg.Model, HTTP: &http.Client{Timeout: 2 * time.Minute}}
+		},
+	})
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// KeySource says where an API key comes from. The first one set is used: Command, File, Env.
+type KeySource struct {
+	Env     string // Name of the env var holding the key
+	File    string // File containing the key (~/ is expanded)
+	Command string // Shell command printing the key, e.g. a password manager lookup
+}
+
+// Key reads the API key; it is "" if the source is empty or the env var is unset
+func (k KeySource) Key(ctx context.Context) (string, error) {
+	switch {
+	case k.Command != "":
+		cmd := exec.CommandContext(ctx, "sh", "-c", k.Command)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("api key command failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		key := strings.TrimSpace(string(out))
+		if key == "" {
+			return "", fmt.Errorf("api key command printed nothing")
+		}
+		return key, nil
+
+	case k.File != "":
+		path := k.File
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			path = filepath.Join(home, rest)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read api key file: %w", err)
+		}
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", fmt.Errorf("api key file %s is empty", k.File)
+		}
+		return key, nil
+
+	case k.Env != "":
+		return os.Getenv(k.Env), nil
+	}
+	return "", nil
+}
+
+// String describes the source for messages, without the key
+func (k KeySource) String() string {
+	switch {
+	case k.Command != "":
+		return "api_key_command"
+	case k.File != "":
+		return "api_key_file " + k.File
+	case k.Env != "":
+		return "$" + k.Env
+	}
+	return "no api key"
+}
@@ -0,0 +1,213 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Message is one chat message; assistant messages may carry tool calls instead of content
+type Message struct {
+	Role       string     `json:"role"` // system, user, assistant or tool
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // For role tool: the call answered
+}
+
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"` // Always "function"
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall names the tool and carries its arguments as a JSON string
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Tool is a function the model may call; Parameters is a JSON schema
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  interface{}
+}
+
+// MarshalJSON encodes the tool in the chat completions format
+func (t Tool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		},
+	})
+}
+
+// Client talks to the model API of one provider
+type Client interface {
+	// Chat sends a conversation to the model and returns its reply
+	Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error)
+
+	// Models lists the models the API offers
+	Models(ctx context.Context) ([]string, error)
+}
+
+// Config selects a provider and model
+type Config struct {
+	Provider string
+	BaseURL  string // Default: the provider's
+	APIKey   string
+	Model    string
+}
+
+// Provider describes a kind of model API
+type Provider struct {
+	Name           string
+	Title          string // For humans, e.g. "Docker Model Runner"
+	DefaultBaseURL string // "" if the base URL must be configured
+	KeyEnv         string // Env var holding the API key by default ("" if none)
+	KeyRequired    bool   // The API rejects requests without a key
+	KeyExplicit    bool   // The key source must be configured; no default env var is read
+	Local          bool   // Usually runs next to docktor (checked for reachability on start)
+	New            func(Config) Client
+}
+
+// Registry holds all registered providers
+var registry = make(map[string]Provider)
+
+// Register adds a provider to the registry
+func Register(p Provider) {
+	registry[p.Name] = p
+}
+
+// Providers returns the registered provider names, sorted
+func Providers() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns a registered provider
+func Lookup(name string) (Provider, bool) {
+	p, ok := registry[name]
+	return p, ok
+}
+
+// New creates a client for the configured provider
+func New(cfg Config) (Client, error) {
+	p, exists := registry[cfg.Provider]
+	if !exists {
+		return nil, &UnsupportedProviderError{Provider: cfg.Provider}
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = p.DefaultBaseURL
+	}
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("provider %s needs a base URL", cfg.Provider)
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return p.New(cfg), nil
+}
+
+// UnsupportedProviderError represents an unregistered provider
+type UnsupportedProviderError struct {
+	Provider string
+}
+
+func (e *UnsupportedProviderError) Error() string {
+	return fmt.Sprintf("unsupported LLM provider %q (available: %s)", e.Provider, strings.Join(Providers(), ", "))
+}
+
+// APIError is a non-success response of the model API
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("model API returned %d: %s", e.StatusCode, e.Body)
+}
+
+// doJSON sends body as JSON (if not nil) and decodes a successful JSON response into out
+func doJSON(ctx context.Context, client *http.Client, method, url string, headers map[string]string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(raw))}
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// ErrNoAnswer is returned by Run when the model keeps calling tools past the round limit
+var ErrNoAnswer = errors.New("model did not finish within the tool call limit")
+
+// ToolHandler runs one tool call. The result is sent back to the model; done ends the
+// conversation after this round (e.g. when the model submitted its answer).
+type ToolHandler func(ctx context.Context, call ToolCall) (result string, done bool)
+
+// Run converses with the model, running the tool calls it makes, until it answers
+// without calling a tool or a handler reports done. It returns the whole transcript.
+func Run(ctx context.Context, c Client, messages []Message, tools []Tool, handle ToolHandler, maxRounds int) ([]Message, error) {
+	for round := 0; round < maxRounds; round++ {
+		reply, err := c.Chat(ctx, messages, tools)
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, *reply)
+		if len(reply.ToolCalls) == 0 {
+			return messages, nil
+		}
+
+		finished := false
+		for _, call := range reply.ToolCalls {
+			result, done := handle(ctx, call)
+			messages = append(messages, Message{Role: "tool", ToolCallID: call.ID, Content: result})
+			finished = finished || done
+		}
+		if finished {
+			return messages, nil
+		}
+	}
+	return messages, ErrNoAnswer
+}
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Ollama is a client for Ollama's native API (/api/chat, /api/tags)
+type Ollama struct {
+	BaseURL string // e.g. http://localhost:11434
+	APIKey  string // Sent as a bearer token if set (Ollama behind a proxy)
+	Model   string
+	HTTP    *http.Client
+}
+
+// ollamaMessage is a chat message in Ollama's format: tool call arguments are objects
+// and tool calls have no IDs
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+func (c *Ollama) headers() map[string]string {
+	if c.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + c.APIKey}
+}
+
+// Chat sends one non-streaming /api/chat request
+func (c *Ollama) Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	converted := make([]ollamaMessage, 0, len(messages))
+	for _, m := range messages {
+		om := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, call := range m.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Function.Name
+			tc.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if !json.Valid(tc.Function.Arguments) {
+				tc.Function.Arguments = json.RawMessage("{}")
+			}
+			om.ToolCalls = append(om.ToolCalls, tc)
+		}
+		converted = append(converted, om)
+	}
+	body := map[string]interface{}{
+		"model":    c.Model,
+		"messages": converted,
+		"stream":   false,
+		"options":  map[string]interface{}{"temperature": 0},
+	}
+	if len(tools) > 0 {
+		body["tools"] = tools
+	}
+
+	var out struct {
+		Message ollamaMessage `json:"message"`
+	}
+	if err := doJSON(ctx, c.HTTP, http.MethodPost, c.BaseURL+"/api/chat", c.headers(), body, &out); err != nil {
+		return nil, err
+	}
+	msg := &Message{Role: "assistant", Content: out.Message.Content}
+	for i, tc := range out.Message.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+			ID:       fmt.Sprintf("call_%d", i+1),
+			Type:     "function",
+			Function: FunctionCall{Name: tc.Function.Name, Arguments: string(tc.Function.Arguments)},
+		})
+	}
+	return msg, nil
+}
+
+// Models lists the locally available models of GET /api/tags
+func (c *Ollama) Models(ctx context.Context) ([]string, error) {
+	var out struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := doJSON(ctx, c.HTTP, http.MethodGet, c.BaseURL+"/api/tags", c.headers(), nil, &out); err != nil {
+		return nil, err
+	}
+	models := make([]string, len(out.Models))
+	for i, m := range out.Models {
+		models[i] = m.Name
+	}
+	return models, nil
+}
+
+func init() {
+	Register(Provider{
+		Name:           "ollama",
+		Title:          "Ollama",
+		DefaultBaseURL: "http://localhost:11434",
+		KeyEnv:         "OLLAMA_API_KEY",
+		Local:          true,
+		New: func(cfg Config) Client {
+			return &Ollama{BaseURL: cfg.BaseURL, APIKey: cfg.APIKey, Model: cfg.Model, HTTP: &http.Client{Timeout: 5 * time.Minute}}
+		},
+	})
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI is a client for OpenAI-compatible /chat/completions endpoints (OpenAI, Docker
+// Model Runner, gateways)
+type OpenAI struct {
+	BaseURL string // e.g. https://api.openai.com/v1
+	APIKey  string // Sent as a bearer token if set
+	Model   string
+	HTTP    *http.Client
+}
+
+// NewOpenAI returns a client for the chat completions API at baseURL
+func NewOpenAI(baseURL, apiKey, model string) *OpenAI {
+	return &OpenAI{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		APIKey:  apiKey,
+		Model:   model,
+		HTTP:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+func (c *OpenAI) headers() map[string]string {
+	if c.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + c.APIKey}
+}
+
+// Chat sends one chat completion request and returns the first choice
+func (c *OpenAI) Chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	body := map[string]interface{}{
+		"model":       c.Model,
+		"messages":    messages,
+		"temperature": 0,
+	}
+	if len(tools) > 0 {
+		body["tools"] = tools
+	}
+
+	var out struct {
+		Choices []struct {
+			Message Message `json:"message"`
+		} `json:"choices"`
+	}
+	if err := doJSON(ctx, c.HTTP, http.MethodPost, c.BaseURL+"/chat/completions", c.headers(), body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion response has no choices")
+	}
+	msg := out.Choices[0].Message
+	msg.Role = "assistant"
+	return &msg, nil
+}
+
+// Models lists the models of GET /models
+func (c *OpenAI) Models(ctx context.Context) ([]string, error) {
+	var out struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := doJSON(ctx, c.HTTP, http.MethodGet, c.BaseURL+"/models", c.headers(), nil, &out); err != nil {
+		return nil, err
+	}
+	models := make([]string, len(out.Data))
+	for i, m := range out.Data {
+		models[i] = m.ID
+	}
+	return models, nil
+}
+
+func newOpenAIClient(cfg Config) Client {
+	return NewOpenAI(cfg.BaseURL, cfg.APIKey, cfg.Model)
+}
+
+// Register the OpenAI-compatible providers on package init
+func init() {
+	Register(Provider{
+		Name:           "openai",
+		Title:          "OpenAI",
+		DefaultBaseURL: "https://api.openai.com/v1",
+		KeyEnv:         "OPENAI_API_KEY",
+		KeyRequired:    true,
+		New:            newOpenAIClient,
+	})
+	Register(Provider{
+		Name:           "dmr",
+		Title:          "Docker Model Runner",
+		DefaultBaseURL: "http://localhost:12434/engines/llama.cpp/v1",
+		Local:          true,
+		New:            newOpenAIClient,
+	})
+	// The key goes to whatever base_url is configured, so it is never taken from
+	// OPENAI_API_KEY implicitly
+	Register(Provider{
+		Name:        "openai_compatible",
+		Title:       "OpenAI-compatible gateway",
+		KeyExplicit: true,
+		New:         newOpenAIClient,
+	})
+}
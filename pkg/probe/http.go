@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HTTPProber implements the Prober interface with plain HTTP requests
+type HTTPProber struct {
+	url         string
+	method      string
+	concurrency int
+	interval    time.Duration
+	expect      int // Expected status code; 0 accepts any status below 400
+	client      *http.Client
+}
+
+// NewHTTPProber creates a new HTTP prober
+func NewHTTPProber(cfg Config) (Prober, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("HTTP probe requires 'url'")
+	}
+	p := &HTTPProber{
+		url:         cfg.URL,
+		method:      cfg.Method,
+		concurrency: cfg.Concurrency,
+		interval:    cfg.Interval,
+		client:      &http.Client{Timeout: cfg.Timeout},
+	}
+	if p.method == "" {
+		p.method = http.MethodGet
+	}
+	if p.concurrency < 1 {
+		p.concurrency = 1
+	}
+	if p.interval <= 0 {
+		p.interval = time.Second
+	}
+	if p.client.Timeout <= 0 {
+		p.client.Timeout = 5 * time.Second
+	}
+	if s := cfg.Attributes["expect_status"]; s != "" {
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("HTTP probe: invalid expect_status %q", s)
+		}
+		p.expect = code
+	}
+	return p, nil
+}
+
+// Probe runs the workers for the duration of the window
+func (p *HTTPProber) Probe(ctx context.Context, window time.Duration) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	var (
+		mu  sync.Mutex
+		res = &Result{}
+		wg  sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < p.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				latency, ok := p.request(ctx)
+				if ctx.Err() != nil && !ok {
+					return // Cut off by the end of the window, not a failure
+				}
+				mu.Lock()
+				res.Requests++
+				if ok {
+					res.Latencies = append(res.Latencies, latency)
+				} else {
+					res.Errors++
+				}
+				mu.Unlock()
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(p.interval):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	res.Duration = time.Since(start)
+
+	if res.Requests == 0 {
+		return res, fmt.Errorf("HTTP probe sent no requests to %s within %s", p.url, window)
+	}
+	return res, nil
+}
+
+// request sends one request and reports its latency and whether it succeeded
+func (p *HTTPProber) request(ctx context.Context) (time.Duration, bool) {
+	req, err := http.NewRequestWithContext(ctx, p.method, p.url, nil)
+	if err != nil {
+		return 0, false
+	}
+	req.Header.Set("User-Agent", "docktor-probe")
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	latency := time.Since(start)
+
+	if p.expect != 0 {
+		return latency, resp.StatusCode == p.expect
+	}
+	return latency, resp.StatusCode < 400
+}
+
+func init() {
+	Register("http", NewHTTPProber)
+}
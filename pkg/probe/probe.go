@@ -0,0 +1,91 @@
+package probe
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Config represents probe configuration
+type Config struct {
+	Kind        string            // "http"
+	URL         string            // Target to probe
+	Method      string            // HTTP method (default GET)
+	Concurrency int               // Parallel workers
+	Interval    time.Duration     // Pause between two requests of one worker
+	Timeout     time.Duration     // Per-request timeout
+	Attributes  map[string]string // Kind-specific attributes
+}
+
+// Result summarizes the requests sent during one probe window
+type Result struct {
+	Requests  int             // Requests sent
+	Errors    int             // Failed requests (transport errors or unexpected status)
+	Latencies []time.Duration // Latency of every completed request
+	Duration  time.Duration   // Wall time of the probe
+}
+
+// Percentile returns the p-th percentile latency in milliseconds (0 if there are no samples)
+func (r *Result) Percentile(p float64) float64 {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), r.Latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p/100*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return float64(sorted[idx]) / float64(time.Millisecond)
+}
+
+// ErrorRate returns the fraction of failed requests (0..1)
+func (r *Result) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Requests)
+}
+
+// RPS returns the achieved request rate
+func (r *Result) RPS() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// Prober interface for synthetic probe implementations
+type Prober interface {
+	// Probe sends requests until the window has passed (or ctx is done)
+	Probe(ctx context.Context, window time.Duration) (*Result, error)
+}
+
+// Registry holds all registered probe kinds
+var registry = make(map[string]func(Config) (Prober, error))
+
+// Register adds a probe kind to the registry
+func Register(kind string, factory func(Config) (Prober, error)) {
+	registry[kind] = factory
+}
+
+// NewProber creates a prober instance for the given config
+func NewProber(cfg Config) (Prober, error) {
+	factory, exists := registry[cfg.Kind]
+	if !exists {
+		return nil, &UnsupportedKindError{Kind: cfg.Kind}
+	}
+	return factory(cfg)
+}
+
+// UnsupportedKindError represents an unsupported probe kind
+type UnsupportedKindError struct {
+	Kind string
+}
+
+func (e *UnsupportedKindError) Error() string {
+	return "unsupported probe kind: " + e.Kind
+}
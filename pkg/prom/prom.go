@@ -0,0 +1,266 @@
+package prom
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Sample is one series value from an exposition or a query result
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	Type   string // Metric type from the exposition's # TYPE line ("counter", "gauge", "summary", ...); "" if not declared
+}
+
+// familySuffixes are the sample name suffixes that belong to a declared metric family
+var familySuffixes = []string{"_total", "_sum", "_count", "_bucket", "_created"}
+
+// maxScrapeSize bounds how much of an exposition is read
+const maxScrapeSize = 16 << 20
+
+// Scrape fetches a Prometheus text or OpenMetrics endpoint and parses its samples
+func Scrape(ctx context.Context, client *http.Client, endpoint string) ([]Sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scrape %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scrape %s: %s", endpoint, resp.Status)
+	}
+	return ParseText(io.LimitReader(resp.Body, maxScrapeSize))
+}
+
+// ParseText parses the Prometheus text format (and the compatible subset of OpenMetrics).
+// # TYPE lines set the type of the samples of their family; other comments, timestamps
+// and exemplars are ignored.
+func ParseText(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	types := map[string]string{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if fields := strings.Fields(line); len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+		s, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		s.Type = familyType(types, s.Name)
+		samples = append(samples, s)
+	}
+	return samples, sc.Err()
+}
+
+// familyType returns the declared type of the family a sample name belongs to
+func familyType(types map[string]string, name string) string {
+	if t, ok := types[name]; ok {
+		return t
+	}
+	for _, suffix := range familySuffixes {
+		if family, ok := strings.CutSuffix(name, suffix); ok {
+			if t, ok := types[family]; ok {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// parseLine parses `name{label="value",...} value [timestamp] [# exemplar]`
+func parseLine(line string) (Sample, error) {
+	s := Sample{Labels: map[string]string{}}
+
+	i := strings.IndexAny(line, "{ \t")
+	if i < 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	s.Name = line[:i]
+	rest := line[i:]
+
+	if strings.HasPrefix(rest, "{") {
+		end, err := parseLabels(rest, s.Labels)
+		if err != nil {
+			return s, err
+		}
+		rest = rest[end:]
+	}
+
+	// Drop an OpenMetrics exemplar
+	if j := strings.Index(rest, " # "); j >= 0 {
+		rest = rest[:j]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("missing value for %s", s.Name)
+	}
+	v, err := parseFloat(fields[0])
+	if err != nil {
+		return s, fmt.Errorf("invalid value for %s: %w", s.Name, err)
+	}
+	s.Value = v
+	return s, nil
+}
+
+// parseLabels parses a {...} label set starting at text[0] and returns the index after '}'
+func parseLabels(text string, labels map[string]string) (int, error) {
+	i := 1
+	for {
+		for i < len(text) && (text[i] == ' ' || text[i] == ',') {
+			i++
+		}
+		if i >= len(text) {
+			return 0, fmt.Errorf("unterminated label set")
+		}
+		if text[i] == '}' {
+			return i + 1, nil
+		}
+
+		eq := strings.IndexByte(text[i:], '=')
+		if eq < 0 {
+			return 0, fmt.Errorf("invalid label set")
+		}
+		name := strings.TrimSpace(text[i : i+eq])
+		i += eq + 1
+		if i >= len(text) || text[i] != '"' {
+			return 0, fmt.Errorf("label %s: value must be quoted", name)
+		}
+		i++
+
+		var b strings.Builder
+		for {
+			if i >= len(text) {
+				return 0, fmt.Errorf("label %s: unterminated value", name)
+			}
+			c := text[i]
+			if c == '\\' && i+1 < len(text) {
+				switch text[i+1] {
+				case 'n':
+					b.WriteByte('\n')
+				default:
+					b.WriteByte(text[i+1])
+				}
+				i += 2
+				continue
+			}
+			i++
+			if c == '"' {
+				break
+			}
+			b.WriteByte(c)
+		}
+		labels[name] = b.String()
+	}
+}
+
+// parseFloat parses a sample value, including +Inf, -Inf and NaN
+func parseFloat(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// queryResponse is the envelope of the Prometheus HTTP API
+type queryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Query runs an instant PromQL query against a Prometheus-compatible HTTP API
+// (Prometheus, Thanos, Mimir, VictoriaMetrics, ...) and returns the resulting samples
+func Query(ctx context.Context, client *http.Client, baseURL, query string) ([]Sample, error) {
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var qr queryResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxScrapeSize)).Decode(&qr); err != nil {
+		return nil, fmt.Errorf("query: invalid response (%s): %w", resp.Status, err)
+	}
+	if qr.Status != "success" {
+		return nil, fmt.Errorf("query failed: %s: %s", qr.ErrorType, qr.Error)
+	}
+
+	switch qr.Data.ResultType {
+	case "scalar":
+		var pair [2]interface{}
+		if err := json.Unmarshal(qr.Data.Result, &pair); err != nil {
+			return nil, fmt.Errorf("query: invalid scalar: %w", err)
+		}
+		v, err := pairValue(pair)
+		if err != nil {
+			return nil, err
+		}
+		return []Sample{{Labels: map[string]string{}, Value: v}}, nil
+	case "vector":
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		}
+		if err := json.Unmarshal(qr.Data.Result, &vector); err != nil {
+			return nil, fmt.Errorf("query: invalid vector: %w", err)
+		}
+		samples := make([]Sample, 0, len(vector))
+		for _, el := range vector {
+			v, err := pairValue(el.Value)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, Sample{Name: el.Metric["__name__"], Labels: el.Metric, Value: v})
+		}
+		return samples, nil
+	}
+	return nil, fmt.Errorf("query: unsupported result type %q (use an instant vector or scalar)", qr.Data.ResultType)
+}
+
+// pairValue extracts the value of a [timestamp, "value"] pair
+func pairValue(pair [2]interface{}) (float64, error) {
+	str, ok := pair[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("query: invalid sample value %v", pair[1])
+	}
+	return parseFloat(str)
+}
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -61,33 +62,37 @@ func (n *NATSProvider) Connect() error {
 }
 
 // GetMetrics collects queue metrics from NATS JetStream
-func (n *NATSProvider) GetMetrics(windowSec int) (*Metrics, error) {
+func (n *NATSProvider) GetMetrics(ctx context.Context, windowSec int) (*Metrics, error) {
 	if n.js == nil {
 		return nil, fmt.Errorf("not connected to NATS")
 	}
 
 	// Get stream info (initial sample)
-	streamInfo1, err := n.js.StreamInfo(n.stream)
+	streamInfo1, err := n.js.StreamInfo(n.stream, nats.Context(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get stream info for '%s': %w", n.stream, err)
 	}
 
 	// Get consumer info (initial sample)
-	consumerInfo1, err := n.js.ConsumerInfo(n.stream, n.consumer)
+	consumerInfo1, err := n.js.ConsumerInfo(n.stream, n.consumer, nats.Context(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get consumer info for '%s/%s': %w", n.stream, n.consumer, err)
 	}
 
 	// Wait for window duration to calculate rates
-	time.Sleep(time.Duration(windowSec) * time.Second)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(time.Duration(windowSec) * time.Second):
+	}
 
 	// Get second samples
-	streamInfo2, err := n.js.StreamInfo(n.stream)
+	streamInfo2, err := n.js.StreamInfo(n.stream, nats.Context(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get stream info (second sample): %w", err)
 	}
 
-	consumerInfo2, err := n.js.ConsumerInfo(n.stream, n.consumer)
+	consumerInfo2, err := n.js.ConsumerInfo(n.stream, n.consumer, nats.Context(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get consumer info (second sample): %w", err)
 	}
@@ -1,6 +1,9 @@
 package queue
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Metrics represents queue metrics collected over a time window
 type Metrics struct {
@@ -24,8 +27,9 @@ type Provider interface {
 	// Connect establishes connection to the queue backend
 	Connect() error
 
-	// GetMetrics collects queue metrics over the specified window
-	GetMetrics(windowSec int) (*Metrics, error)
+	// GetMetrics collects queue metrics over the specified window; it returns early
+	// with the context's error when ctx is done
+	GetMetrics(ctx context.Context, windowSec int) (*Metrics, error)
 
 	// Close closes the connection and cleans up resources
 	Close() error
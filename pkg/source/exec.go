@@ -0,0 +1,237 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExecTimeout   = 10 * time.Second
+	defaultExecMaxOutput = 64 << 10
+)
+
+// ExecSource runs a command and parses its output into observations. The output is
+// either a JSON object (nested objects are flattened with dots) or "key value" lines.
+// The exit code is always reported as exit_code; metrics are only reported on success.
+type ExecSource struct {
+	command   []string
+	shell     bool
+	dir       string
+	env       []string
+	timeout   time.Duration
+	maxOutput int
+	format    string // "auto", "json" or "lines"
+}
+
+// NewExecSource creates a new exec source
+func NewExecSource(cfg Config) (Source, error) {
+	var opts struct {
+		Command   interface{}       `yaml:"command"`    // String run by sh -c, or argv list
+		Dir       string            `yaml:"dir"`        // Working directory
+		Env       map[string]string `yaml:"env"`        // Extra environment variables
+		Timeout   int               `yaml:"timeout"`    // Seconds (default: 10)
+		MaxOutput int               `yaml:"max_output"` // Bytes of stdout accepted (default: 64 KiB)
+		Format    string            `yaml:"format"`     // auto (default), json or lines
+	}
+	if err := cfg.Decode(&opts); err != nil {
+		return nil, err
+	}
+
+	s := &ExecSource{
+		dir:       opts.Dir,
+		timeout:   time.Duration(opts.Timeout) * time.Second,
+		maxOutput: opts.MaxOutput,
+		format:    opts.Format,
+	}
+	switch c := opts.Command.(type) {
+	case string:
+		if strings.TrimSpace(c) == "" {
+			return nil, fmt.Errorf("exec source requires 'command'")
+		}
+		s.command, s.shell = []string{c}, true
+	case []interface{}:
+		for _, arg := range c {
+			s.command = append(s.command, fmt.Sprint(arg))
+		}
+		if len(s.command) == 0 {
+			return nil, fmt.Errorf("exec source requires 'command'")
+		}
+	default:
+		return nil, fmt.Errorf("exec source requires 'command' (string or list)")
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultExecTimeout
+	}
+	if s.maxOutput <= 0 {
+		s.maxOutput = defaultExecMaxOutput
+	}
+	switch s.format {
+	case "":
+		s.format = "auto"
+	case "auto", "json", "lines":
+	default:
+		return nil, fmt.Errorf("exec source: format must be auto, json or lines")
+	}
+
+	keys := make([]string, 0, len(opts.Env))
+	for k := range opts.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.env = append(s.env, k+"="+opts.Env[k])
+	}
+	return s, nil
+}
+
+// Collect runs the command once; the target service is passed as DOCKTOR_SERVICE
+func (s *ExecSource) Collect(ctx context.Context, target Target, window time.Duration) (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if s.shell {
+		cmd = exec.CommandContext(ctx, "sh", "-c", s.command[0])
+	} else {
+		cmd = exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	}
+	cmd.Dir = s.dir
+	cmd.Env = append(os.Environ(), s.env...)
+	cmd.Env = append(cmd.Env,
+		"DOCKTOR_PROJECT="+target.Project,
+		"DOCKTOR_SERVICE="+target.Service,
+		"DOCKTOR_REPLICAS="+strconv.Itoa(len(target.Containers)),
+		fmt.Sprintf("DOCKTOR_METRICS_WINDOW=%d", int(window/time.Second)),
+	)
+	stdout := &limitedBuffer{limit: s.maxOutput}
+	stderr := &limitedBuffer{limit: 4 << 10}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = time.Second // Don't wait for grandchildren holding the pipes open
+
+	err := cmd.Run()
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	observations := map[string]float64{"exit_code": float64(exitCode)}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return observations, fmt.Errorf("command timed out after %s", s.timeout)
+	case err != nil:
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return observations, fmt.Errorf("command exited with code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+		}
+		return observations, fmt.Errorf("command failed: %w", err)
+	case stdout.overflow:
+		return observations, fmt.Errorf("command output exceeds %d bytes", s.maxOutput)
+	}
+
+	values, err := s.parse(stdout.Bytes())
+	if err != nil {
+		return observations, err
+	}
+	for k, v := range values {
+		observations[k] = v
+	}
+	return observations, nil
+}
+
+// parse decodes the command output according to the configured format
+func (s *ExecSource) parse(out []byte) (map[string]float64, error) {
+	trimmed := bytes.TrimSpace(out)
+	if s.format == "json" || (s.format == "auto" && bytes.HasPrefix(trimmed, []byte("{"))) {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(trimmed, &obj); err != nil {
+			return nil, fmt.Errorf("invalid JSON output: %w", err)
+		}
+		values := map[string]float64{}
+		flattenJSON("", obj, values)
+		return values, nil
+	}
+	return parseLines(trimmed)
+}
+
+// parseLines parses "key value" lines; blank lines and # comments are skipped
+func parseLines(out []byte) (map[string]float64, error) {
+	values := map[string]float64{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected 'key value', got %q", n, line)
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %q is not a number", n, fields[1])
+		}
+		values[fields[0]] = v
+	}
+	return values, sc.Err()
+}
+
+// flattenJSON collects numeric and boolean leaves of a JSON object as dotted keys
+func flattenJSON(prefix string, obj map[string]interface{}, out map[string]float64) {
+	for k, v := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case float64:
+			out[key] = v
+		case bool:
+			if v {
+				out[key] = 1
+			} else {
+				out[key] = 0
+			}
+		case map[string]interface{}:
+			flattenJSON(key, v, out)
+		}
+	}
+}
+
+// Close is a no-op; nothing is kept between runs
+func (s *ExecSource) Close() error { return nil }
+
+// limitedBuffer keeps up to limit bytes and remembers whether more was written.
+// The buffer is not embedded so io.Copy cannot bypass Write through ReadFrom.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.overflow = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte  { return b.buf.Bytes() }
+func (b *limitedBuffer) String() string { return b.buf.String() }
+
+func init() {
+	Register("exec", "custom", NewExecSource)
+}
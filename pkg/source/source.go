@@ -0,0 +1,217 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hwclass/docktor/pkg/compose"
+	"gopkg.in/yaml.v3"
+)
+
+// collectGrace is how long a source may run past the metrics window before it is cancelled
+const collectGrace = 30 * time.Second
+
+// Config represents one entry of a service's sources list
+type Config struct {
+	Kind      string                 `yaml:"kind" json:"kind"`
+	Namespace string                 `yaml:"namespace,omitempty" json:"namespace,omitempty"` // Observation prefix (default: the kind's namespace)
+	Required  bool                   `yaml:"required,omitempty" json:"required,omitempty"`   // A failure aborts the check instead of being a warning
+	Options   map[string]interface{} `yaml:",inline" json:"-"`                               // Kind-specific settings
+}
+
+// Decode decodes the kind-specific options into v, rejecting unknown keys
+func (c Config) Decode(v interface{}) error {
+	if len(c.Options) == 0 {
+		return nil
+	}
+	data, err := yaml.Marshal(c.Options)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("source %s: %w", c.Kind, err)
+	}
+	return nil
+}
+
+// Target identifies what a source measures
+type Target struct {
+	Project    string
+	Service    string
+	Containers []compose.Container // Running containers of the service
+}
+
+// Source interface for metric source implementations
+type Source interface {
+	// Collect gathers observations over the window; keys are relative to the namespace
+	Collect(ctx context.Context, target Target, window time.Duration) (map[string]float64, error)
+	// Close releases connections held between collections
+	Close() error
+}
+
+type kind struct {
+	namespace string
+	factory   func(Config) (Source, error)
+}
+
+// Registry holds all registered source kinds
+var registry = make(map[string]kind)
+
+// Register adds a source kind and its default namespace to the registry
+func Register(name, namespace string, factory func(Config) (Source, error)) {
+	registry[name] = kind{namespace: namespace, factory: factory}
+}
+
+// Kinds returns the registered source kinds, sorted
+func Kinds() []string {
+	kinds := make([]string, 0, len(registry))
+	for k := range registry {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Resolve fills in the default namespace of a config and checks that its kind exists
+func Resolve(cfg Config) (Config, error) {
+	k, exists := registry[cfg.Kind]
+	if !exists {
+		return cfg, &UnsupportedKindError{Kind: cfg.Kind}
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = k.namespace
+	}
+	if strings.ContainsAny(cfg.Namespace, " \t{}") || strings.HasPrefix(cfg.Namespace, ".") || strings.HasSuffix(cfg.Namespace, ".") {
+		return cfg, fmt.Errorf("source %s: invalid namespace %q", cfg.Kind, cfg.Namespace)
+	}
+	return cfg, nil
+}
+
+// NewSource creates a source instance for the given config
+func NewSource(cfg Config) (Source, error) {
+	cfg, err := Resolve(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return registry[cfg.Kind].factory(cfg)
+}
+
+// UnsupportedKindError represents an unsupported source kind
+type UnsupportedKindError struct {
+	Kind string
+}
+
+func (e *UnsupportedKindError) Error() string {
+	return "unsupported source kind: " + e.Kind
+}
+
+// Error is the failure of one source during a collection
+type Error struct {
+	Source Config
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Source.Namespace, e.Source.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+type member struct {
+	cfg    Config
+	source Source
+}
+
+// Set is the list of sources of one service, collected together
+type Set struct {
+	members []member
+}
+
+// NewSet creates the sources of a service; namespaces must be unique
+func NewSet(cfgs []Config) (*Set, error) {
+	s := &Set{}
+	seen := map[string]bool{}
+	for _, cfg := range cfgs {
+		cfg, err := Resolve(cfg)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if seen[cfg.Namespace] {
+			s.Close()
+			return nil, fmt.Errorf("duplicate source namespace %q", cfg.Namespace)
+		}
+		seen[cfg.Namespace] = true
+
+		src, err := registry[cfg.Kind].factory(cfg)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("source %s: %w", cfg.Namespace, err)
+		}
+		s.members = append(s.members, member{cfg: cfg, source: src})
+	}
+	return s, nil
+}
+
+// Collect runs all sources in parallel over the same window and merges their
+// observations as <namespace>.<key>. Observations of sources that failed are
+// kept when they returned any; every failure is reported as an *Error.
+func (s *Set) Collect(ctx context.Context, target Target, window time.Duration) (map[string]float64, []*Error) {
+	ctx, cancel := context.WithTimeout(ctx, window+collectGrace)
+	defer cancel()
+
+	var (
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		observations = map[string]float64{}
+		errs         []*Error
+	)
+	for _, m := range s.members {
+		wg.Add(1)
+		go func(m member) {
+			defer wg.Done()
+			obs, err := m.source.Collect(ctx, target, window)
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range obs {
+				observations[m.cfg.Namespace+"."+k] = v
+			}
+			if err != nil {
+				errs = append(errs, &Error{Source: m.cfg, Err: err})
+			}
+		}(m)
+	}
+	wg.Wait()
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Source.Namespace < errs[j].Source.Namespace })
+	return observations, errs
+}
+
+// Configs returns the resolved configs of the sources in the set
+func (s *Set) Configs() []Config {
+	cfgs := make([]Config, len(s.members))
+	for i, m := range s.members {
+		cfgs[i] = m.cfg
+	}
+	return cfgs
+}
+
+// Close closes all sources
+func (s *Set) Close() error {
+	var errs []error
+	for _, m := range s.members {
+		if err := m.source.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.members = nil
+	return errors.Join(errs...)
+}